@@ -2,7 +2,11 @@ package main
 
 import (
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -10,6 +14,7 @@ import (
 	"sort"
 
 	"github.com/oriolf/bella-ciao/params"
+	"github.com/oriolf/bella-ciao/verifier"
 )
 
 func Uninitialized(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
@@ -46,19 +51,23 @@ func Initialize(r *http.Request, w http.ResponseWriter, db *sql.Tx, u *User, p p
 		return wrapError(err, 48, "could not register user in db")
 	}
 
-	e := p.Values("election")
-	election := Election{
-		Name:          e.String("name"),
-		Start:         e.Time("start"),
-		End:           e.Time("end"),
-		CountMethod:   e.String("count_method"),
-		MinCandidates: e.Int("min_candidates"),
-		MaxCandidates: e.Int("max_candidates"),
+	election, err := electionFromParams(p.Values("election"))
+	if err != nil {
+		return wrapError(err, 217, "could not get election from params")
 	}
-	if err := createElection(db, election); err != nil {
+
+	if election.ID, err = createElection(db, election); err != nil {
 		return wrapError(err, 49, "could not create election")
 	}
 
+	if err := setupTally(db, election); err != nil {
+		return wrapError(err, 391, "could not set up election tally")
+	}
+
+	if _, err := installationKey(db); err != nil {
+		return wrapError(err, 455, "could not generate installation key")
+	}
+
 	idFormats := p.Values("config").StringList("id_formats")
 	if err := createConfig(db, Config{IDFormats: idFormats}); err != nil {
 		return wrapError(err, 50, "could not create config")
@@ -69,6 +78,47 @@ func Initialize(r *http.Request, w http.ResponseWriter, db *sql.Tx, u *User, p p
 	return nil
 }
 
+// electionFromParams builds an election from the params validated by electionParamsAux, with a new tie break seed
+func electionFromParams(p par.Values) (Election, error) {
+	e := Election{
+		Name:          p.String("name"),
+		Start:         p.Time("start"),
+		End:           p.Time("end"),
+		BallotType:    p.String("ballot_type"),
+		CountMethod:   p.String("count_method"),
+		MinCandidates: p.Int("min_candidates"),
+		MaxCandidates: p.Int("max_candidates"),
+		Seats:         p.Int("seats"),
+		MaxScore:      p.Int("max_score"),
+		Grades:        p.StringList("grades"),
+		Threshold:     p.Float("threshold"),
+		Truncation:    p.String("truncation"),
+		TieBreak:      p.String("tie_break"),
+		AllowRecast:   p.Bool("allow_recast"),
+
+		BlindSignatures: p.Bool("blind_signatures"),
+		Encrypted:       p.Bool("encrypted"),
+		Trustees:        []int{},
+	}
+
+	if e.Encrypted {
+		e.Trustees, e.Quorum = p.IntList("trustees"), p.Int("quorum")
+	}
+
+	if embargo := p.Time("results_embargo"); !embargo.IsZero() {
+		e.ResultsEmbargo = &embargo
+	}
+
+	// the seed of the lot is drawn by the server, so nobody can pick one that favours a candidate
+	seed, err := SafeID()
+	if err != nil {
+		return e, wrapError(err, 186, "could not generate tie break seed")
+	}
+	e.TieBreakSeed = seed
+
+	return e, nil
+}
+
 func UpdateConfig(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
 	c, err := getConfig(db)
 	if err != nil {
@@ -145,6 +195,12 @@ func Logout(r *http.Request, w http.ResponseWriter, db *sql.Tx, u *User, p par.V
 }
 
 func GetSelf(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	participations, err := getUserParticipations(db, user.ID)
+	if err != nil {
+		return wrapError(err, 240, "could not get participations")
+	}
+
+	user.Participations = participations
 	return WriteResult(w, user)
 }
 
@@ -261,12 +317,29 @@ func ValidateUser(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User
 	return nil
 }
 
+// MakeAuditor lets a validated user see the results of elections before they are published
+func MakeAuditor(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	if err := makeAuditor(db, p.Int("id")); err != nil {
+		return wrapError(err, 287, "could not make user auditor")
+	}
+
+	return nil
+}
+
 func GetCandidates(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, params par.Values) error {
-	candidates, err := getCandidates(db, 1)
+	candidates, err := getCandidates(db, params.Int("election_id"))
 	if err != nil {
 		return wrapError(err, 71, "could not get candidates")
 	}
 
+	hide, err := hideResultsFrom(db, user, params.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 288, "could not check if results are hidden")
+	}
+	if hide {
+		hideCandidatesPoints(candidates)
+	}
+
 	if err := WriteResult(w, candidates); err != nil {
 		return wrapError(err, 72, "could not write response")
 	}
@@ -296,7 +369,7 @@ func AddCandidate(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User
 		return wrapError(err, 75, "could not write to file")
 	}
 
-	err = addCandidate(db, Candidate{Name: p.String("name"), Presentation: p.String("presentation"), Image: filename})
+	_, err = addCandidate(db, Candidate{ElectionID: p.Int("election_id"), Name: p.String("name"), Presentation: p.String("presentation"), Image: filename})
 	if err != nil {
 		return wrapError(err, 76, "could not add candidate")
 	}
@@ -322,12 +395,139 @@ func DeleteCandidate(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *U
 	return nil
 }
 
+func GetLists(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	lists, err := getLists(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 168, "could not get lists")
+	}
+
+	hide, err := hideResultsFrom(db, user, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 289, "could not check if results are hidden")
+	}
+	if hide {
+		hideListsResults(lists)
+	}
+
+	if err := WriteResult(w, lists); err != nil {
+		return wrapError(err, 169, "could not write response")
+	}
+
+	return nil
+}
+
+func AddList(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	if _, err := addList(db, CandidateList{ElectionID: p.Int("election_id"), Name: p.String("name")}); err != nil {
+		return wrapError(err, 170, "could not add list")
+	}
+
+	return nil
+}
+
+func DeleteList(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	if err := deleteList(db, p.Int("id")); err != nil {
+		return wrapError(err, 171, "could not delete list")
+	}
+
+	return nil
+}
+
+func GetQuestions(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	questions, err := getQuestions(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 261, "could not get questions")
+	}
+
+	hide, err := hideResultsFrom(db, user, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 290, "could not check if results are hidden")
+	}
+	if hide {
+		hideQuestionsVotes(questions)
+	}
+
+	if err := WriteResult(w, questions); err != nil {
+		return wrapError(err, 262, "could not write response")
+	}
+
+	return nil
+}
+
+func AddQuestion(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	q := Question{ElectionID: p.Int("election_id"), Prompt: p.String("prompt"), Options: p.StringList("options")}
+	if _, err := addQuestion(db, q); err != nil {
+		return wrapError(err, 263, "could not add question")
+	}
+
+	return nil
+}
+
+func DeleteQuestion(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	if err := deleteQuestion(db, p.Int("id")); err != nil {
+		return wrapError(err, 264, "could not delete question")
+	}
+
+	return nil
+}
+
+// SetListCandidates replaces the candidates of a list, in the order they will take its seats
+func SetListCandidates(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	list, err := getList(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 172, "could not get list")
+	}
+
+	candidates := p.IntList("candidates")
+	if hasDuplicates(candidates) {
+		return traceError{id: 173, message: "candidates cannot be repeated in a list"}
+	}
+
+	availableCandidates, err := getAvailableCandidates(db, list.ElectionID)
+	if err != nil {
+		return wrapError(err, 174, "could not get available candidates")
+	}
+
+	lists, err := getLists(db, list.ElectionID)
+	if err != nil {
+		return wrapError(err, 175, "could not get lists")
+	}
+
+	for _, l := range lists {
+		if l.ID == list.ID {
+			continue
+		}
+		for _, c := range l.Candidates {
+			delete(availableCandidates, c) // a candidate can only belong to one list
+		}
+	}
+
+	for _, c := range candidates {
+		if _, ok := availableCandidates[c]; !ok {
+			return traceError{id: 176, message: "candidate not available for the list"}
+		}
+	}
+
+	if err := setListCandidates(db, list.ID, candidates); err != nil {
+		return wrapError(err, 177, "could not set list candidates")
+	}
+
+	return nil
+}
+
 func GetElections(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, params par.Values) error {
 	elections, err := getElections(db, !IsAdmin(user)) // all non-admin get only public elections
 	if err != nil {
 		return wrapError(err, 80, "could not get elections")
 	}
 
+	if !canSeeResults(user) {
+		for i := range elections {
+			if !resultsPublished(elections[i]) {
+				elections[i].hideResults()
+			}
+		}
+	}
+
 	if err := WriteResult(w, elections); err != nil {
 		return wrapError(err, 81, "could not write response")
 	}
@@ -335,102 +535,1026 @@ func GetElections(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User
 	return nil
 }
 
+func CreateElection(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := electionFromParams(p)
+	if err != nil {
+		return wrapError(err, 218, "could not get election from params")
+	}
+
+	e.ID, err = createElection(db, e)
+	if err != nil {
+		return wrapError(err, 219, "could not create election")
+	}
+
+	if err := setupTally(db, e); err != nil {
+		return wrapError(err, 392, "could not set up election tally")
+	}
+
+	if err := WriteResult(w, e.ID); err != nil {
+		return wrapError(err, 220, "could not write response")
+	}
+
+	return nil
+}
+
+// UpdateElection replaces the settings of an election that did not start yet; the tie break seed is kept when a
+// new one is not given, and the tally key when the encryption settings do not change
+func UpdateElection(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	old, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 221, "could not get election")
+	}
+
+	e, err := electionFromParams(p)
+	if err != nil {
+		return wrapError(err, 222, "could not get election from params")
+	}
+
+	e.ID, e.TieBreakSeed = old.ID, old.TieBreakSeed
+
+	if err := updateElection(db, e); err != nil {
+		return wrapError(err, 223, "could not update election")
+	}
+
+	if e.Encrypted != old.Encrypted || e.Quorum != old.Quorum || fmt.Sprint(e.Trustees) != fmt.Sprint(old.Trustees) {
+		if err := setupTally(db, e); err != nil {
+			return wrapError(err, 393, "could not set up election tally")
+		}
+	}
+
+	return nil
+}
+
+// DeleteElection deletes an election with its candidates, lists and votes, unless voting is open
+func DeleteElection(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 224, "could not get election")
+	}
+
+	// once voting opens the election has participations and ballots that must be kept
+	if !stringInSlice(e.State, EDITABLE_ELECTION_STATES) {
+		return traceError{id: 225, message: "cannot delete an election once voting is about to open"}
+	}
+
+	if err := deleteElection(db, e.ID); err != nil {
+		return wrapError(err, 226, "could not delete election")
+	}
+
+	// the images are only removed once the election is gone for good, and one that is missing already does no harm
+	afterCommit(db, func() {
+		for _, c := range e.Candidates {
+			if err := os.Remove(filepath.Join(UPLOADS_FOLDER, c.Image)); err != nil && !os.IsNotExist(err) {
+				log.Printf("Could not delete image of candidate %d: %s\n", c.ID, err)
+			}
+		}
+	})
+
+	return nil
+}
+
+// CloneElection creates a new election with the settings, candidates and lists of another one, and a new tie
+// break seed
+func CloneElection(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 228, "could not get election")
+	}
+
+	clone := Election{
+		Name:          p.String("name"),
+		Start:         p.Time("start"),
+		End:           p.Time("end"),
+		BallotType:    e.BallotType,
+		CountMethod:   e.CountMethod,
+		MinCandidates: e.MinCandidates,
+		MaxCandidates: e.MaxCandidates,
+		Seats:         e.Seats,
+		MaxScore:      e.MaxScore,
+		Grades:        e.Grades,
+		Threshold:     e.Threshold,
+		Truncation:    e.Truncation,
+		TieBreak:      e.TieBreak,
+		AllowRecast:   e.AllowRecast,
+
+		BlindSignatures: e.BlindSignatures,
+		Encrypted:       e.Encrypted,
+		Trustees:        e.Trustees,
+		Quorum:          e.Quorum,
+	}
+
+	if clone.TieBreakSeed, err = SafeID(); err != nil {
+		return wrapError(err, 229, "could not generate tie break seed")
+	}
+
+	clone.ID, err = createElection(db, clone)
+	if err != nil {
+		return wrapError(err, 230, "could not create election")
+	}
+
+	if err := setupTally(db, clone); err != nil {
+		return wrapError(err, 394, "could not set up election tally")
+	}
+
+	candidateIDs := make(map[int]int, len(e.Candidates)) // from the original candidates to the cloned ones
+	for _, c := range e.Candidates {
+		image, err := copyFile(UPLOADS_FOLDER, c.Image)
+		if err != nil {
+			return wrapError(err, 231, "could not copy image of candidate %d", c.ID)
+		}
+
+		candidateIDs[c.ID], err = addCandidate(db, Candidate{ElectionID: clone.ID, Name: c.Name, Presentation: c.Presentation, Image: image})
+		if err != nil {
+			return wrapError(err, 232, "could not add candidate")
+		}
+	}
+
+	for _, l := range e.Lists {
+		id, err := addList(db, CandidateList{ElectionID: clone.ID, Name: l.Name})
+		if err != nil {
+			return wrapError(err, 233, "could not add list")
+		}
+
+		candidates := make([]int, 0, len(l.Candidates))
+		for _, c := range l.Candidates {
+			candidates = append(candidates, candidateIDs[c])
+		}
+		if err := setListCandidates(db, id, candidates); err != nil {
+			return wrapError(err, 234, "could not set list candidates")
+		}
+	}
+
+	for _, q := range e.Questions {
+		if _, err := addQuestion(db, Question{ElectionID: clone.ID, Prompt: q.Prompt, Options: q.Options}); err != nil {
+			return wrapError(err, 265, "could not add question")
+		}
+	}
+
+	if err := WriteResult(w, clone.ID); err != nil {
+		return wrapError(err, 235, "could not write response")
+	}
+
+	return nil
+}
+
 func CheckElections(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, params par.Values) error {
-	checkElectionsCount()
+	advanceElections()
 	return nil
 }
 
+// PublishElection moves a draft election to nomination, which makes it public
 func PublishElection(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
-	if err := publishElection(db, p.Int("id")); err != nil {
-		return wrapError(err, 82, "could not delete candidate")
+	e, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 281, "could not get election")
+	}
+
+	if err := transitionElection(db, &e, ELECTION_NOMINATION, user.ID, ""); err != nil {
+		return wrapError(err, 82, "could not publish election")
 	}
 
 	return nil
 }
 
-func CastVote(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
-	elections, err := getElections(db, true)
+// TransitionElection moves an election to the next state of its lifecycle, for the transitions an admin can trigger
+func TransitionElection(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
 	if err != nil {
-		return wrapError(err, 83, "could not get elections")
+		return wrapError(err, 282, "could not get election")
 	}
 
-	if len(elections) != 1 {
-		return traceError{id: 26, message: "expected just one election"}
+	if err := transitionElection(db, &e, p.String("state"), user.ID, ""); err != nil {
+		return wrapError(err, 283, "could not transition election")
 	}
 
-	e := elections[0]
-	if now().Before(e.Start) || now().After(e.End) {
-		return traceError{id: 27, message: "out of election vote time"}
+	return nil
+}
+
+// PublishResults makes the results of a counted election public before its embargo, if it has one
+func PublishResults(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 291, "could not get election")
 	}
 
-	if user.HasVoted {
-		return traceError{id: 28, message: "user has already voted"}
+	if err := transitionElection(db, &e, ELECTION_RESULTS_PUBLISHED, user.ID, ""); err != nil {
+		return wrapError(err, 292, "could not publish results")
 	}
 
-	candidates := p.IntList("candidates")
-	if len(candidates) < e.MinCandidates || len(candidates) > e.MaxCandidates {
-		return traceError{id: 29, message: "less than min or more than max candidates"}
+	return nil
+}
+
+// ExtendVoting moves the end of an election that is voting or suspended to a later time
+func ExtendVoting(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 303, "could not get election")
 	}
 
-	availableCandidates, err := getAvailableCandidates(db, e.ID)
+	if err := extendVoting(db, &e, p.Time("end"), user.ID, p.String("reason")); err != nil {
+		return wrapError(err, 304, "could not extend voting")
+	}
+
+	return nil
+}
+
+// SuspendVoting stops accepting ballots, and keeps the election from being closed and counted until it is resumed
+func SuspendVoting(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
 	if err != nil {
-		return wrapError(err, 84, "could not get available candidates")
+		return wrapError(err, 305, "could not get election")
 	}
 
-	for _, c := range candidates {
-		if _, ok := availableCandidates[c]; !ok {
-			return traceError{id: 30, message: "trying to vote unexistent candidate"}
-		}
+	if err := transitionElection(db, &e, ELECTION_SUSPENDED, user.ID, p.String("reason")); err != nil {
+		return wrapError(err, 306, "could not suspend voting")
 	}
 
-	voteHash, err := SafeID()
+	return nil
+}
+
+// ResumeVoting accepts ballots again in a suspended election; if it is past its end, it closes on the next check
+func ResumeVoting(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
 	if err != nil {
-		return wrapError(err, 85, "could not generate vote hash")
+		return wrapError(err, 307, "could not get election")
 	}
 
-	if err := setUserVoted(db, user.ID); err != nil {
-		return wrapError(err, 86, "could not set user voted")
+	if err := transitionElection(db, &e, ELECTION_VOTING, user.ID, p.String("reason")); err != nil {
+		return wrapError(err, 308, "could not resume voting")
 	}
 
-	if err := insertVote(db, e.ID, candidates, voteHash); err != nil {
-		return wrapError(err, 87, "could not insert vote")
+	return nil
+}
+
+// CloseVoting closes an election that is voting or suspended before its end, so it is counted on the next check
+func CloseVoting(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
+	if err != nil {
+		return wrapError(err, 309, "could not get election")
 	}
 
-	if err := WriteResult(w, voteHash); err != nil {
-		return wrapError(err, 88, "could not write response")
+	if err := transitionElection(db, &e, ELECTION_CLOSED, user.ID, p.String("reason")); err != nil {
+		return wrapError(err, 310, "could not close voting")
 	}
 
 	return nil
 }
 
-func CheckVote(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
-	vote, err := getVoteFromHash(db, p.String("token"))
+func GetElectionTransitions(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	transitions, err := getElectionTransitions(db, p.Int("id"))
 	if err != nil {
-		return wrapError(err, 89, "could not get vote")
+		return wrapError(err, 284, "could not get election transitions")
 	}
 
-	candidates, err := getCandidatesFromIDs(db, vote.Candidates)
+	if err := WriteResult(w, transitions); err != nil {
+		return wrapError(err, 285, "could not write response")
+	}
+
+	return nil
+}
+
+// ResolveTie sets the order, from best to worst, of candidates tied in a count with the manual tie break policy,
+// and counts the election again
+func ResolveTie(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("id"))
 	if err != nil {
-		return wrapError(err, 90, "could not get candidates")
+		return wrapError(err, 187, "could not get election")
 	}
 
-	if len(candidates) != len(vote.Candidates) {
-		return wrapError(nil, 91, "expected %d candidates, but got %d", len(vote.Candidates), len(candidates))
+	if e.TieBreak != TIE_BREAK_MANUAL {
+		return traceError{id: 188, message: "election ties are not settled manually"}
 	}
 
-	// sort the candidates the same as they where originally voted
-	candidatesRank := make(map[int]int, len(candidates))
-	for i, cID := range vote.Candidates {
-		candidatesRank[cID] = i
+	order := p.IntList("candidates")
+	if e.State != ELECTION_CLOSED || e.Results == nil || !e.Results.pendingTie(order) || hasDuplicates(order) {
+		return traceError{id: 189, message: "no pending tie between the candidates"}
 	}
 
-	sort.Slice(candidates, func(i, j int) bool {
-		iRank, jRank := candidatesRank[candidates[i].ID], candidatesRank[candidates[j].ID]
-		return iRank < jRank
-	})
+	e.TieResolutions = append(e.TieResolutions, order)
+	if err := setTieResolutions(db, e.ID, e.TieResolutions); err != nil {
+		return wrapError(err, 190, "could not set tie resolutions")
+	}
 
-	if err := WriteResult(w, candidates); err != nil {
-		return wrapError(err, 92, "could not write response")
+	if err := countElection(db, e, user.ID); err != nil {
+		return wrapError(err, 191, "could not count election")
+	}
+
+	return nil
+}
+
+func CastVote(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 83, "could not get election")
+	}
+
+	if e.State != ELECTION_VOTING {
+		return traceError{id: 27, message: "election is not open for voting"}
+	}
+
+	voted, err := userVoted(db, user.ID, e.ID)
+	if err != nil {
+		return wrapError(err, 241, "could not check if user voted")
+	}
+
+	if voted && !e.AllowRecast {
+		return traceError{id: 28, message: "user has already voted"}
+	}
+
+	if e.BlindSignatures {
+		return traceError{id: 334, message: "ballots of the election are cast anonymously with a credential"}
+	}
+
+	vote, err := ballotFromParams(db, e, p)
+	if err != nil {
+		return wrapError(err, 198, "invalid ballot")
+	}
+
+	voteHash, err := SafeID()
+	if err != nil {
+		return wrapError(err, 85, "could not generate vote hash")
+	}
+
+	var slot string
+	if voted {
+		// the ballot being replaced is found from the slot credential, so nothing stored links it to the user
+		vote.Slot = hashSecret(p.String("slot"))
+		if !supersedeQueuedBallot(db, e.ID, vote.Slot) {
+			if err := supersedeSlotVote(db, e.ID, vote.Slot); err != nil {
+				return wrapError(err, 311, "could not supersede the previous ballot")
+			}
+		}
+	} else {
+		if err := insertParticipation(db, Participation{UserID: user.ID, ElectionID: e.ID, VotedAt: now()}); err != nil {
+			return wrapError(err, 86, "could not insert participation")
+		}
+
+		if e.AllowRecast {
+			if slot, err = SafeID(); err != nil {
+				return wrapError(err, 312, "could not generate slot credential")
+			}
+			vote.Slot = hashSecret(slot)
+		}
+	}
+
+	vote.Hash = voteHash
+	if err := queueBallot(db, vote); err != nil {
+		return wrapError(err, 87, "could not queue vote")
+	}
+
+	ballot, signature, err := signReceipt(db, vote)
+	if err != nil {
+		return wrapError(err, 458, "could not sign receipt")
+	}
+
+	if err := WriteResult(w, castVote{Token: voteHash, Slot: slot, Ballot: ballot, Signature: signature}); err != nil {
+		return wrapError(err, 88, "could not write response")
+	}
+
+	return nil
+}
+
+// ballotFromParams builds the ballot from the params of the request, and checks that it is valid in the election
+func ballotFromParams(db *sql.Tx, e Election, p par.Values) (Vote, error) {
+	availableCandidates, err := getAvailableCandidates(db, e.ID)
+	if err != nil {
+		return Vote{}, wrapError(err, 84, "could not get available candidates")
+	}
+
+	vote := Vote{ElectionID: e.ID, Candidates: p.IntList("candidates"), Scores: p.IntMap("scores"), Ranks: p.IntMap("ranks"), List: p.Int("list"),
+		Answers: p.IntMap("answers"), Blank: p.Bool("blank")}
+	if encrypted := p.RawJSON("encrypted"); len(encrypted) > 0 {
+		return encryptedBallotFromParams(e, availableCandidates, vote, encrypted)
+	}
+
+	if err := validateBallot(e, availableCandidates, vote); err != nil {
+		return Vote{}, wrapError(err, 335, "invalid ballot")
+	}
+
+	if e.BallotType == BALLOT_APPROVAL {
+		sort.Ints(vote.Candidates) // the order in which candidates were approved is not relevant, and should not be stored
+	}
+
+	if e.Encrypted {
+		// only the ciphertexts are stored, so the database does not tell which candidates were marked
+		key, err := verifier.ParseKey(e.TallyKey)
+		if err != nil {
+			return Vote{}, wrapError(err, 395, "election has no valid tally key")
+		}
+
+		min, max := markedRange(e, vote.Blank)
+		ballot, err := verifier.EncryptBallot(key, e.ID, sortedCandidates(availableCandidates), vote.Candidates, min, max)
+		if err != nil {
+			return Vote{}, wrapError(err, 424, "could not encrypt ballot")
+		}
+		vote.Encrypted, vote.Candidates = &ballot, []int{}
+	}
+
+	return vote, nil
+}
+
+// encryptedBallotFromParams takes a ballot that the voter encrypted, so not even the server sees what it votes; its
+// proofs are checked instead of the candidates
+func encryptedBallotFromParams(e Election, availableCandidates map[int]struct{}, vote Vote, encrypted json.RawMessage) (Vote, error) {
+	if !e.Encrypted {
+		return Vote{}, traceError{id: 425, message: "election is not encrypted"}
+	}
+
+	vote.Encrypted = &verifier.Ballot{}
+	if err := json.Unmarshal(encrypted, vote.Encrypted); err != nil {
+		return Vote{}, wrapError(err, 426, "could not unmarshal encrypted ballot")
+	}
+
+	if err := validateEncryptedBallot(e, availableCandidates, vote); err != nil {
+		return Vote{}, wrapError(err, 427, "invalid ballot")
+	}
+
+	return vote, nil
+}
+
+// GetBlindKey returns the public key that signs the voting credentials of an election with blind signatures
+func GetBlindKey(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 336, "could not get election")
+	}
+
+	if !e.BlindSignatures {
+		return traceError{id: 337, message: "election does not use blind signatures"}
+	}
+
+	key, err := electionBlindKey(db, e.ID)
+	if err != nil {
+		return wrapError(err, 338, "could not get election key")
+	}
+
+	if err := WriteResult(w, publicBlindKey(&key.PublicKey)); err != nil {
+		return wrapError(err, 339, "could not write response")
+	}
+
+	return nil
+}
+
+// SignCredential signs the blinded voting credential of a validated user, once per user and election
+func SignCredential(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 340, "could not get election")
+	}
+
+	if !e.BlindSignatures || e.State != ELECTION_VOTING {
+		return traceError{id: 341, message: "election is not giving out credentials"}
+	}
+
+	voted, err := userVoted(db, user.ID, e.ID)
+	if err != nil {
+		return wrapError(err, 342, "could not check if user voted")
+	}
+
+	if voted {
+		return traceError{id: 343, message: "user already got a credential"}
+	}
+
+	blinded, ok := parseHexInt(p.String("blinded"))
+	if !ok {
+		return traceError{id: 344, message: "blinded credential is not hex encoded"}
+	}
+
+	key, err := electionBlindKey(db, e.ID)
+	if err != nil {
+		return wrapError(err, 345, "could not get election key")
+	}
+
+	signature, err := blindSign(key, blinded)
+	if err != nil {
+		return wrapError(err, 346, "could not sign credential")
+	}
+
+	if err := insertParticipation(db, Participation{UserID: user.ID, ElectionID: e.ID, VotedAt: now()}); err != nil {
+		return wrapError(err, 347, "could not insert participation")
+	}
+
+	if err := WriteResult(w, hex.EncodeToString(signature.Bytes())); err != nil {
+		return wrapError(err, 348, "could not write response")
+	}
+
+	return nil
+}
+
+// CastAnonymousVote stores a ballot sent with no session along with a signed credential that was not used before
+func CastAnonymousVote(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 349, "could not get election")
+	}
+
+	if !e.BlindSignatures || e.State != ELECTION_VOTING {
+		return traceError{id: 350, message: "election is not open for anonymous voting"}
+	}
+
+	key, err := electionBlindKey(db, e.ID)
+	if err != nil {
+		return wrapError(err, 351, "could not get election key")
+	}
+
+	credential := p.String("credential")
+	signature, ok := parseHexInt(p.String("signature"))
+	if !ok || !verifyBlindSignature(&key.PublicKey, []byte(credential), signature) {
+		return traceError{id: 352, message: "credential signature is not valid"}
+	}
+
+	used, err := credentialUsed(db, e.ID, hashSecret(credential))
+	if err != nil {
+		return wrapError(err, 353, "could not check if credential was used")
+	}
+
+	if used {
+		return traceError{id: 354, message: "credential was already used"}
+	}
+
+	vote, err := ballotFromParams(db, e, p)
+	if err != nil {
+		return wrapError(err, 355, "invalid ballot")
+	}
+
+	if err := insertUsedCredential(db, e.ID, hashSecret(credential)); err != nil {
+		return wrapError(err, 356, "could not insert used credential")
+	}
+
+	if vote.Hash, err = SafeID(); err != nil {
+		return wrapError(err, 357, "could not generate vote hash")
+	}
+
+	if err := queueBallot(db, vote); err != nil {
+		return wrapError(err, 358, "could not queue vote")
+	}
+
+	ballot, receiptSignature, err := signReceipt(db, vote)
+	if err != nil {
+		return wrapError(err, 457, "could not sign receipt")
+	}
+
+	if err := WriteResult(w, castVote{Token: vote.Hash, Ballot: ballot, Signature: receiptSignature}); err != nil {
+		return wrapError(err, 359, "could not write response")
+	}
+
+	return nil
+}
+
+// castVote is what a voter gets back when voting: the token to check the ballot, the slot credential needed to
+// vote again in elections that allow it, only given with the first ballot, and the hash of the ballot along with the
+// signature of both with the installation key
+type castVote struct {
+	Token     string `json:"token"`
+	Slot      string `json:"slot,omitempty"`
+	Ballot    string `json:"ballot"`
+	Signature string `json:"signature"`
+}
+
+// checkedVote is what a voter gets back when checking a vote: the candidates race as it was voted, and the option
+// picked in each question
+type checkedVote struct {
+	Race       interface{}     `json:"race"` // nil for blank and encrypted votes
+	Blank      bool            `json:"blank"`
+	Encrypted  bool            `json:"encrypted,omitempty"` // the race cannot be read, only its ciphertexts are stored
+	Superseded bool            `json:"superseded"`          // a later ballot of the voter is counted instead
+	Answers    []checkedAnswer `json:"answers"`
+}
+
+type checkedAnswer struct {
+	QuestionID int    `json:"question_id"`
+	Prompt     string `json:"prompt"`
+	Answer     string `json:"answer"`
+}
+
+func CheckVote(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	vote, queued := queuedBallot(p.String("token"))
+	if !queued {
+		var err error
+		if vote, err = getVoteFromHash(db, p.String("token")); err != nil {
+			return wrapError(err, 89, "could not get vote")
+		}
+	}
+
+	e, err := getElection(db, vote.ElectionID)
+	if err != nil {
+		return wrapError(err, 148, "could not get election")
+	}
+
+	var race interface{}
+	if !vote.Blank && !e.Encrypted {
+		race, err = checkRace(db, e, vote)
+		if err != nil {
+			return wrapError(err, 259, "could not check candidates race")
+		}
+	}
+
+	answers := make([]checkedAnswer, 0, len(e.Questions))
+	for _, q := range e.Questions {
+		option, ok := vote.Answers[q.ID]
+		if !ok || option < 0 || option >= len(q.Options) {
+			return wrapError(nil, 260, "vote has no valid answer for question %d", q.ID)
+		}
+		answers = append(answers, checkedAnswer{QuestionID: q.ID, Prompt: q.Prompt, Answer: q.Options[option]})
+	}
+
+	if err := WriteResult(w, checkedVote{Race: race, Blank: vote.Blank, Encrypted: e.Encrypted, Superseded: vote.Superseded, Answers: answers}); err != nil {
+		return wrapError(err, 92, "could not write response")
+	}
+
+	return nil
+}
+
+// GetBulletinBoard lists every ballot of an election along with their Merkle root, so anyone can count them again
+func GetBulletinBoard(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	board, err := electionBulletinBoard(db, user, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 319, "could not get bulletin board")
+	}
+
+	if err := WriteResult(w, board); err != nil {
+		return wrapError(err, 320, "could not write response")
+	}
+
+	return nil
+}
+
+// GetInclusionProof returns the proof that the ballot of a receipt is in the bulletin board of its election
+func GetInclusionProof(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	vote, err := getVoteFromHash(db, p.String("token"))
+	if err != nil {
+		return wrapError(err, 321, "could not get vote")
+	}
+
+	board, err := electionBulletinBoard(db, user, vote.ElectionID)
+	if err != nil {
+		return wrapError(err, 322, "could not get bulletin board")
+	}
+
+	proof, err := board.inclusionProof(vote.Hash)
+	if err != nil {
+		return wrapError(err, 323, "could not get inclusion proof")
+	}
+
+	if err := WriteResult(w, proof); err != nil {
+		return wrapError(err, 324, "could not write response")
+	}
+
+	return nil
+}
+
+// electionBulletinBoard builds the bulletin board of an election whose voting is closed; as the ballots tell the
+// results, they follow the same embargo, and only admins and auditors see them before the results are published
+func electionBulletinBoard(db *sql.Tx, user *User, electionID int) (BulletinBoard, error) {
+	e, err := getElection(db, electionID)
+	if err != nil {
+		return BulletinBoard{}, wrapError(err, 325, "could not get election")
+	}
+
+	if !resultsPublished(e) && !(canSeeResults(user) && (e.State == ELECTION_CLOSED || e.Counted)) {
+		return BulletinBoard{}, traceError{id: 326, message: "ballots of the election are not public yet"}
+	}
+
+	ballots, err := getBallots(db, e.ID)
+	if err != nil {
+		return BulletinBoard{}, wrapError(err, 327, "could not get ballots")
+	}
+
+	return newBulletinBoard(e.ID, ballots)
+}
+
+// GetTrusteeShare gives a trustee its share of the secret of the tally key of an encrypted election, only once: the
+// share is removed as it is given, so the database alone cannot decrypt the ballots
+func GetTrusteeShare(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	found, share, err := getTrusteeShare(db, p.Int("election_id"), user.ID)
+	if err != nil {
+		return wrapError(err, 396, "could not get trustee share")
+	}
+
+	if !found {
+		return traceError{id: 397, message: "user is not a trustee of the election"}
+	}
+
+	if share.Share == nil {
+		return traceError{id: 398, message: "trustee share was already taken"}
+	}
+
+	if err := takeTrusteeShare(db, share.ElectionID, share.UserID); err != nil {
+		return wrapError(err, 399, "could not take trustee share")
+	}
+
+	if err := WriteResult(w, share); err != nil {
+		return wrapError(err, 400, "could not write response")
+	}
+
+	return nil
+}
+
+// GetEncryptedTally returns the tally that the trustees decrypt, once voting is closed
+func GetEncryptedTally(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 401, "could not get election")
+	}
+
+	if !e.Encrypted {
+		return traceError{id: 402, message: "election is not encrypted"}
+	}
+
+	if e.State != ELECTION_CLOSED && !e.Counted {
+		return traceError{id: 403, message: "voting is not closed yet"}
+	}
+
+	votes, err := getVotes(db, e.ID)
+	if err != nil {
+		return wrapError(err, 404, "could not get votes")
+	}
+
+	tally, err := tallyCiphertexts(e, votes)
+	if err != nil {
+		return wrapError(err, 405, "could not tally ciphertexts")
+	}
+
+	decryptions, err := getPartialDecryptions(db, e.ID)
+	if err != nil {
+		return wrapError(err, 406, "could not get partial decryptions")
+	}
+
+	// with a quorum of partial decryptions anyone could decrypt the tally, so they are embargoed like the results
+	hide, err := hideResultsFrom(db, user, e.ID)
+	if err != nil {
+		return wrapError(err, 468, "could not check if results are hidden")
+	}
+	if hide {
+		decryptions = nil
+	}
+
+	result := EncryptedTally{ElectionID: e.ID, Ballots: len(votes), Quorum: e.Quorum, Ciphertexts: tally, Decryptions: decryptions}
+	if err := WriteResult(w, result); err != nil {
+		return wrapError(err, 407, "could not write response")
+	}
+
+	return nil
+}
+
+// SendPartialDecryption stores the partial decryption of the tally made by a trustee, and counts the election once a
+// quorum of trustees sent theirs
+func SendPartialDecryption(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 408, "could not get election")
+	}
+
+	if !e.Encrypted || e.State != ELECTION_CLOSED {
+		return traceError{id: 409, message: "election is not waiting for partial decryptions"}
+	}
+
+	found, share, err := getTrusteeShare(db, e.ID, user.ID)
+	if err != nil {
+		return wrapError(err, 410, "could not get trustee share")
+	}
+
+	if !found {
+		return traceError{id: 411, message: "user is not a trustee of the election"}
+	}
+
+	decryptions, err := getPartialDecryptions(db, e.ID)
+	if err != nil {
+		return wrapError(err, 412, "could not get partial decryptions")
+	}
+
+	for _, d := range decryptions {
+		if d.Trustee == share.Index {
+			return traceError{id: 413, message: "trustee already sent its partial decryption"}
+		}
+	}
+
+	values := p.IntStringMap("partials")
+	if len(values) != len(e.Candidates) {
+		return traceError{id: 414, message: "partial decryption should have a value for each candidate"}
+	}
+
+	var proofs map[int]verifier.ProofBranch
+	if err := json.Unmarshal(p.RawJSON("proofs"), &proofs); err != nil {
+		return wrapError(err, 475, "could not unmarshal partial decryption proofs")
+	}
+
+	votes, err := getVotes(db, e.ID)
+	if err != nil {
+		return wrapError(err, 476, "could not get votes")
+	}
+
+	tally, err := tallyCiphertexts(e, votes)
+	if err != nil {
+		return wrapError(err, 477, "could not tally ciphertexts")
+	}
+
+	if err := verifier.VerifyTallyDecryption(share.Verification, e.ID, share.Index, tally, values, proofs); err != nil {
+		return wrapError(err, 415, "partial decryption is not valid")
+	}
+
+	d := PartialDecryption{ElectionID: e.ID, Trustee: share.Index, Values: values, Proofs: proofs}
+	if err := insertPartialDecryption(db, d); err != nil {
+		return wrapError(err, 416, "could not insert partial decryption")
+	}
+
+	if err := countElection(db, e, user.ID); err != nil {
+		return wrapError(err, 417, "could not count election")
+	}
+
+	return nil
+}
+
+// checkRace returns what the vote marked in the candidates race, in the way it was marked
+func checkRace(db *sql.Tx, e Election, vote Vote) (interface{}, error) {
+	if e.BallotType == BALLOT_SCORE || e.BallotType == BALLOT_GRADES {
+		return checkScoresVote(db, e, vote)
+	}
+
+	if len(vote.Ranks) > 0 {
+		return checkRanksVote(db, vote)
+	}
+
+	if e.BallotType == BALLOT_LIST {
+		list, err := getList(db, vote.List)
+		if err != nil {
+			return nil, wrapError(err, 181, "could not get list")
+		}
+		return list, nil
+	}
+
+	candidates, err := getCandidatesFromIDs(db, vote.Candidates)
+	if err != nil {
+		return nil, wrapError(err, 90, "could not get candidates")
+	}
+
+	if len(candidates) != len(vote.Candidates) {
+		return nil, wrapError(nil, 91, "expected %d candidates, but got %d", len(vote.Candidates), len(candidates))
+	}
+
+	if e.BallotType == BALLOT_RANKED {
+		// sort the candidates the same as they where originally voted
+		candidatesRank := make(map[int]int, len(candidates))
+		for i, cID := range vote.Candidates {
+			candidatesRank[cID] = i
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			iRank, jRank := candidatesRank[candidates[i].ID], candidatesRank[candidates[j].ID]
+			return iRank < jRank
+		})
+	}
+
+	return candidates, nil
+}
+
+type scoredCandidate struct {
+	Candidate
+	Score int    `json:"score"`
+	Grade string `json:"grade,omitempty"`
+}
+
+func checkScoresVote(db *sql.Tx, e Election, vote Vote) ([]scoredCandidate, error) {
+	candidates, err := getMarkedCandidates(db, vote.Scores)
+	if err != nil {
+		return nil, wrapError(err, 156, "could not get candidates")
+	}
+
+	scored := make([]scoredCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		x := scoredCandidate{Candidate: c, Score: vote.Scores[c.ID]}
+		if e.BallotType == BALLOT_GRADES {
+			x.Grade = e.Grades[x.Score]
+		}
+		scored = append(scored, x)
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].ID < scored[j].ID
+	})
+
+	return scored, nil
+}
+
+type rankedCandidate struct {
+	Candidate
+	Rank int `json:"rank"`
+}
+
+func checkRanksVote(db *sql.Tx, vote Vote) ([]rankedCandidate, error) {
+	candidates, err := getMarkedCandidates(db, vote.Ranks)
+	if err != nil {
+		return nil, wrapError(err, 201, "could not get candidates")
+	}
+
+	ranked := make([]rankedCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, rankedCandidate{Candidate: c, Rank: vote.Ranks[c.ID]})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Rank != ranked[j].Rank {
+			return ranked[i].Rank < ranked[j].Rank
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+
+	return ranked, nil
+}
+
+// getMarkedCandidates returns the candidates that have a score or rank in the vote
+func getMarkedCandidates(db *sql.Tx, marks map[int]int) ([]Candidate, error) {
+	ids := make([]int, 0, len(marks))
+	for c := range marks {
+		ids = append(ids, c)
+	}
+
+	candidates, err := getCandidatesFromIDs(db, ids)
+	if err != nil {
+		return nil, wrapError(err, 203, "could not get candidates from ids")
+	}
+
+	if len(candidates) != len(ids) {
+		return nil, wrapError(nil, 157, "expected %d candidates, but got %d", len(ids), len(candidates))
+	}
+
+	return candidates, nil
+}
+
+// GetAuditLog returns every entry of the audit log, from the first one
+func GetAuditLog(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	entries, err := getAuditLog(db)
+	if err != nil {
+		return wrapError(err, 443, "could not get audit log")
+	}
+
+	if err := WriteResult(w, entries); err != nil {
+		return wrapError(err, 444, "could not write response")
+	}
+
+	return nil
+}
+
+// GetServerKey returns the public key that signs the receipts and results of the installation
+func GetServerKey(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	key, err := installationKey(db)
+	if err != nil {
+		return wrapError(err, 459, "could not get installation key")
+	}
+
+	if err := WriteResult(w, publicServerKey(key)); err != nil {
+		return wrapError(err, 460, "could not write response")
+	}
+
+	return nil
+}
+
+// GetSignedResults returns the signed results document of a counted election, which follows the embargo of the
+// results like the ballots do
+func GetSignedResults(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	e, err := getElection(db, p.Int("election_id"))
+	if err != nil {
+		return wrapError(err, 461, "could not get election")
+	}
+
+	if !resultsPublished(e) && !(canSeeResults(user) && e.Counted) {
+		return traceError{id: 462, message: "results of the election are not public yet"}
+	}
+
+	found, signed, err := getSignedResults(db, e.ID)
+	if err != nil {
+		return wrapError(err, 463, "could not get signed results")
+	}
+
+	if !found {
+		return traceError{id: 464, message: "results of the election are not signed"}
+	}
+
+	if err := WriteResult(w, signed); err != nil {
+		return wrapError(err, 465, "could not write response")
+	}
+
+	return nil
+}
+
+// VerifySignature tells whether the signature of a receipt or a results document was made with the installation key
+func VerifySignature(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+	key, err := installationKey(db)
+	if err != nil {
+		return wrapError(err, 466, "could not get installation key")
+	}
+
+	message := verifier.ResultsMessage([]byte(p.String("document")))
+	if p.String("kind") == SIGNATURE_RECEIPT {
+		message = verifier.ReceiptMessage(p.String("receipt"), p.String("ballot"))
+	}
+
+	err = verifier.VerifySignature(publicServerKey(key).PublicKey, message, p.String("signature"))
+	if err := WriteResult(w, err == nil); err != nil {
+		return wrapError(err, 467, "could not write response")
 	}
 
 	return nil
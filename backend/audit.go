@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/oriolf/bella-ciao/params"
+)
+
+// The audit log records every operation that changes the state of the installation, in the same transaction, so
+// it holds exactly the operations that were committed. Votes, credentials and logins are left out: the participations
+// already record who voted, and the log should not tell when each ballot was cast. Each entry hashes the previous
+// one, so anyone holding the hash of the last entry can tell whether the log was edited afterwards.
+
+// audited wraps the handler so that it appends an entry to the audit log with its parameters, except the hidden ones
+// and any file
+func audited(
+	action string,
+	handleFunc func(*http.Request, http.ResponseWriter, *sql.Tx, *User, par.Values) error,
+	hidden ...string,
+) func(*http.Request, http.ResponseWriter, *sql.Tx, *User, par.Values) error {
+	return func(r *http.Request, w http.ResponseWriter, db *sql.Tx, user *User, p par.Values) error {
+		userID := 0
+		if user != nil {
+			userID = user.ID
+		}
+
+		if err := appendAuditEntry(db, userID, action, p.Without(hidden...)); err != nil {
+			return wrapError(err, 431, "could not append to audit log")
+		}
+
+		return handleFunc(r, w, db, user, p)
+	}
+}
+
+func appendAuditEntry(db *sql.Tx, userID int, action string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return wrapError(err, 432, "could not marshal params")
+	}
+
+	previous, err := getLastAuditHash(db)
+	if err != nil {
+		return wrapError(err, 433, "could not get last audit hash")
+	}
+
+	a := AuditEntry{UserID: userID, Action: action, Params: b, At: now().UTC(), PreviousHash: previous}
+	if a.Hash, err = auditHash(a); err != nil {
+		return wrapError(err, 434, "could not hash audit entry")
+	}
+
+	if err := insertAuditEntry(db, a); err != nil {
+		return wrapError(err, 435, "could not insert audit entry")
+	}
+
+	return nil
+}
+
+// auditHash hashes every field of the entry but the id and the hash itself
+func auditHash(a AuditEntry) (string, error) {
+	b, err := json.Marshal([]interface{}{a.PreviousHash, a.UserID, a.Action, a.Params, a.At.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// checkAuditChain checks that each entry of the log has the right hash and follows the previous one
+func checkAuditChain(entries []AuditEntry) error {
+	previous := ""
+	for _, a := range entries {
+		if a.PreviousHash != previous {
+			return traceError{id: 436, message: fmt.Sprintf("entry %d does not follow the previous entry", a.ID)}
+		}
+
+		hash, err := auditHash(a)
+		if err != nil {
+			return wrapError(err, 437, "could not hash entry %d", a.ID)
+		}
+
+		if hash != a.Hash {
+			return traceError{id: 438, message: fmt.Sprintf("entry %d does not match its hash", a.ID)}
+		}
+		previous = a.Hash
+	}
+
+	return nil
+}
+
+// checkAudit checks the chain of the audit log stored in the database, and writes the hash of its last entry, to be
+// compared with one noted down before; it returns whether the chain is intact
+func checkAudit(args []string, out io.Writer) (bool, error) {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dbFile := flags.String("db", DB_FILE, "database file, opened read only")
+	if err := flags.Parse(args); err != nil {
+		return false, wrapError(err, 439, "could not parse arguments")
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+*dbFile+"?mode=ro")
+	if err != nil {
+		return false, wrapError(err, 440, "error during database connection")
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return false, wrapError(err, 441, "error beginning transaction")
+	}
+	defer tx.Rollback()
+
+	entries, err := getAuditLog(tx)
+	if err != nil {
+		return false, wrapError(err, 442, "could not get audit log")
+	}
+
+	if err := checkAuditChain(entries); err != nil {
+		fmt.Fprintf(out, "Audit log is broken: %s\n", err)
+		return false, nil
+	}
+
+	last := ""
+	if len(entries) > 0 {
+		last = entries[len(entries)-1].Hash
+	}
+	fmt.Fprintf(out, "Audit log of %d entries is intact, last hash %s\n", len(entries), last)
+	return true, nil
+}
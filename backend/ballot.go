@@ -0,0 +1,216 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/oriolf/bella-ciao/verifier"
+)
+
+// ballotValidators check the ballot type specific rules of a vote, and return the candidates marked in it
+var ballotValidators = map[string]func(Election, Vote) ([]int, error){
+	BALLOT_RANKED:    validateRankedBallot,
+	BALLOT_APPROVAL:  validateApprovalBallot,
+	BALLOT_PLURALITY: validatePluralityBallot,
+	BALLOT_SCORE:     validateScoreBallot,
+	BALLOT_GRADES:    validateScoreBallot,
+	BALLOT_LIST:      validateListBallot,
+}
+
+// validateBallot checks that the vote is a valid ballot for the election, given the ids of its candidates; it does
+// not access the database, so stored votes can be checked again at any time
+func validateBallot(e Election, available map[int]struct{}, v Vote) error {
+	validate, ok := ballotValidators[e.BallotType]
+	if !ok {
+		return traceError{id: 192, message: "unknown ballot type"}
+	}
+
+	if err := validateAnswers(e.Questions, v.Answers); err != nil {
+		return err
+	}
+
+	if v.Blank {
+		if len(v.Candidates) > 0 || len(v.Scores) > 0 || len(v.Ranks) > 0 || v.List != 0 {
+			return traceError{id: 267, message: "blank ballots cannot mark candidates or lists"}
+		}
+		return nil // a blank ballot is valid whatever the minimum of candidates
+	}
+
+	if e.BallotType != BALLOT_SCORE && e.BallotType != BALLOT_GRADES && len(v.Scores) > 0 {
+		return traceError{id: 155, message: "only score ballots can have scores"}
+	}
+
+	if e.BallotType != BALLOT_RANKED && len(v.Ranks) > 0 {
+		return traceError{id: 193, message: "only ranked ballots can have ranks"}
+	}
+
+	if e.BallotType != BALLOT_LIST && v.List != 0 {
+		return traceError{id: 180, message: "only list ballots can have a list"}
+	}
+
+	marked, err := validate(e, v)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range marked {
+		if _, ok := available[c]; !ok {
+			return traceError{id: 30, message: "trying to vote unexistent candidate"}
+		}
+	}
+
+	return nil
+}
+
+// validateEncryptedBallot checks a ballot of an encrypted election, which holds a ciphertext of the mark of each
+// candidate instead of the candidates; the marks cannot be read, but the proofs of the ballot show that each of them
+// is a 0 or a 1, and that the ballot marks as many candidates as allowed
+func validateEncryptedBallot(e Election, available map[int]struct{}, v Vote) error {
+	if err := validateAnswers(e.Questions, v.Answers); err != nil {
+		return err
+	}
+
+	if len(v.Candidates) > 0 || len(v.Scores) > 0 || len(v.Ranks) > 0 || v.List != 0 {
+		return traceError{id: 418, message: "encrypted ballots cannot mark candidates in the clear"}
+	}
+
+	if v.Encrypted == nil {
+		return traceError{id: 419, message: "ballot is not encrypted"}
+	}
+
+	key, err := verifier.ParseKey(e.TallyKey)
+	if err != nil {
+		return wrapError(err, 420, "election has no valid tally key")
+	}
+
+	min, max := markedRange(e, v.Blank)
+	if err := verifier.VerifyBallot(key, e.ID, sortedCandidates(available), *v.Encrypted, min, max); err != nil {
+		return wrapError(err, 421, "invalid encrypted ballot")
+	}
+
+	return nil
+}
+
+// markedRange returns how many candidates a ballot of an encrypted election can mark
+func markedRange(e Election, blank bool) (min, max int) {
+	switch {
+	case blank:
+		return 0, 0
+	case e.BallotType == BALLOT_PLURALITY:
+		return 1, 1
+	default:
+		return e.MinCandidates, e.MaxCandidates
+	}
+}
+
+func sortedCandidates(available map[int]struct{}) []int {
+	candidates := make([]int, 0, len(available))
+	for c := range available {
+		candidates = append(candidates, c)
+	}
+	sort.Ints(candidates)
+	return candidates
+}
+
+// validateRankedBallot accepts either an ordered list of candidates, or the rank of each candidate when the count
+// method allows equal rankings; in both cases a candidate can only appear once
+func validateRankedBallot(e Election, v Vote) ([]int, error) {
+	marked := v.Candidates
+	if len(v.Ranks) > 0 {
+		if !stringInSlice(e.CountMethod, EQUAL_RANKS_COUNT_METHODS) {
+			return nil, traceError{id: 194, message: "count method does not allow equal rankings"}
+		}
+		if len(v.Candidates) > 0 {
+			return nil, traceError{id: 195, message: "ballots with ranks cannot have a list of candidates"}
+		}
+
+		marked = make([]int, 0, len(v.Ranks))
+		for c, rank := range v.Ranks {
+			if rank < 1 {
+				return nil, traceError{id: 196, message: "ranks should start at 1"}
+			}
+			marked = append(marked, c)
+		}
+	}
+
+	if hasDuplicates(marked) {
+		return nil, traceError{id: 197, message: "ranked ballots cannot repeat candidates"}
+	}
+
+	return marked, validateMarkedCount(e, marked)
+}
+
+func validateApprovalBallot(e Election, v Vote) ([]int, error) {
+	if hasDuplicates(v.Candidates) {
+		return nil, traceError{id: 145, message: "approval ballots cannot repeat candidates"}
+	}
+
+	return v.Candidates, validateMarkedCount(e, v.Candidates)
+}
+
+func validatePluralityBallot(e Election, v Vote) ([]int, error) {
+	if len(v.Candidates) != 1 {
+		return nil, traceError{id: 144, message: "plurality ballots must have exactly one candidate"}
+	}
+
+	return v.Candidates, nil
+}
+
+func validateScoreBallot(e Election, v Vote) ([]int, error) {
+	if len(v.Candidates) > 0 {
+		return nil, traceError{id: 153, message: "score ballots cannot have a list of candidates"}
+	}
+
+	maxScore := e.MaxScore
+	if e.BallotType == BALLOT_GRADES {
+		maxScore = len(e.Grades) - 1
+	}
+
+	marked := make([]int, 0, len(v.Scores))
+	for c, score := range v.Scores {
+		if score < 0 || score > maxScore {
+			return nil, traceError{id: 154, message: "score out of range"}
+		}
+		marked = append(marked, c)
+	}
+
+	return marked, validateMarkedCount(e, marked)
+}
+
+func validateListBallot(e Election, v Vote) ([]int, error) {
+	if len(v.Candidates) > 0 {
+		return nil, traceError{id: 178, message: "list ballots cannot have a list of candidates"}
+	}
+
+	if !listInElection(v.List, e.Lists) {
+		return nil, traceError{id: 179, message: "trying to vote unexistent list"}
+	}
+
+	return nil, nil
+}
+
+// validateAnswers checks that the vote picks one of the options of each question of the election, and answers nothing
+// else
+func validateAnswers(questions []Question, answers map[int]int) error {
+	if len(answers) != len(questions) {
+		return traceError{id: 245, message: "ballots should answer every question"}
+	}
+
+	for _, q := range questions {
+		option, ok := answers[q.ID]
+		if !ok {
+			return traceError{id: 246, message: "ballots should answer every question"}
+		}
+		if option < 0 || option >= len(q.Options) {
+			return traceError{id: 247, message: "answer out of the question options"}
+		}
+	}
+
+	return nil
+}
+
+func validateMarkedCount(e Election, marked []int) error {
+	if len(marked) < e.MinCandidates || len(marked) > e.MaxCandidates {
+		return traceError{id: 29, message: "less than min or more than max candidates"}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"math/big"
+	"sync"
+)
+
+// Ballots are not written when they are cast: they wait in memory until their election has BALLOT_BATCH_SIZE of them,
+// or until voting closes, and then they are written all together in a random order. The participation of each voter
+// is committed right away, so whoever watches the commits or the database files sees the participations one by one
+// but the ballots only in batches, and cannot tell which ballot of a batch belongs to which participation. Ballots
+// still waiting are lost if the server stops; the signed receipts of their voters prove that they were cast.
+
+var ballotQueue = struct {
+	sync.Mutex
+	ballots map[int][]Vote // by election, in the order they were cast
+}{ballots: make(map[int][]Vote)}
+
+// queuedBallots returns a copy of the ballots of the election waiting to be written
+func queuedBallots(electionID int) []Vote {
+	ballotQueue.Lock()
+	defer ballotQueue.Unlock()
+	return append([]Vote{}, ballotQueue.ballots[electionID]...)
+}
+
+// queueBallot adds the ballot to the ones waiting in its election once the transaction is committed, or writes them
+// all when the ballot completes a batch
+func queueBallot(db *sql.Tx, v Vote) error {
+	if len(queuedBallots(v.ElectionID))+1 >= BALLOT_BATCH_SIZE {
+		return flushBallots(db, v.ElectionID, v)
+	}
+
+	afterCommit(db, func() {
+		ballotQueue.Lock()
+		defer ballotQueue.Unlock()
+		ballotQueue.ballots[v.ElectionID] = append(ballotQueue.ballots[v.ElectionID], v)
+	})
+	return nil
+}
+
+// flushBallots writes the ballots of the election waiting in the queue, along with the given ones, in a random order;
+// they leave the queue once the transaction is committed
+func flushBallots(db *sql.Tx, electionID int, extra ...Vote) error {
+	waiting := queuedBallots(electionID)
+	for _, v := range extra {
+		// a recast in the same slot supersedes the waiting ballot before its mark could reach the queue
+		for i := range waiting {
+			if v.Slot != "" && waiting[i].Slot == v.Slot {
+				waiting[i].Superseded = true
+			}
+		}
+	}
+
+	ballots := append(append([]Vote{}, waiting...), extra...)
+	if err := shuffleVotes(ballots); err != nil {
+		return wrapError(err, 482, "could not shuffle ballots")
+	}
+
+	for _, v := range ballots {
+		if err := insertVote(db, v); err != nil {
+			return wrapError(err, 483, "could not insert ballot")
+		}
+	}
+
+	afterCommit(db, func() {
+		ballotQueue.Lock()
+		defer ballotQueue.Unlock()
+		// ballots queued after the flush began stay for the next one
+		if left := ballotQueue.ballots[electionID][len(waiting):]; len(left) > 0 {
+			ballotQueue.ballots[electionID] = left
+		} else {
+			delete(ballotQueue.ballots, electionID)
+		}
+	})
+	return nil
+}
+
+// queuedBallot returns the ballot with the receipt hash if it is waiting to be written
+func queuedBallot(hash string) (Vote, bool) {
+	ballotQueue.Lock()
+	defer ballotQueue.Unlock()
+	for _, ballots := range ballotQueue.ballots {
+		for _, v := range ballots {
+			if v.Hash == hash {
+				return v, true
+			}
+		}
+	}
+	return Vote{}, false
+}
+
+// supersedeQueuedBallot marks as superseded, once the transaction is committed, the ballot of the election in the
+// slot that is waiting to be written, and tells whether there was one
+func supersedeQueuedBallot(db *sql.Tx, electionID int, slot string) bool {
+	hash := ""
+	for _, v := range queuedBallots(electionID) {
+		if slot != "" && v.Slot == slot && !v.Superseded {
+			hash = v.Hash
+		}
+	}
+
+	if hash == "" {
+		return false
+	}
+
+	afterCommit(db, func() {
+		ballotQueue.Lock()
+		defer ballotQueue.Unlock()
+		for i, v := range ballotQueue.ballots[electionID] {
+			if v.Hash == hash {
+				ballotQueue.ballots[electionID][i].Superseded = true
+			}
+		}
+	})
+	return true
+}
+
+// shuffleVotes puts the votes in a random order, Fisher-Yates with a cryptographic source
+func shuffleVotes(votes []Vote) error {
+	for i := len(votes) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return err
+		}
+		votes[i], votes[j.Int64()] = votes[j.Int64()], votes[i]
+	}
+	return nil
+}
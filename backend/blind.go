@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"math/big"
+)
+
+// Elections with blind signatures separate who can vote from what is voted. A validated user blinds a random
+// credential and gets it signed with the key of the election, which counts as the user participation; the ballot is
+// sent later, with no session, along with the unblinded credential and signature. The server only sees the blinded
+// credential when signing, so it cannot tell which user sent each ballot.
+
+// BLIND_KEY_BITS is the size of the RSA keys of the elections
+const BLIND_KEY_BITS = 2048
+
+// BlindKey is the public part of the key of an election, hex encoded
+type BlindKey struct {
+	N string `json:"n"`
+	E int    `json:"e"`
+}
+
+// electionBlindKey returns the key of the election, generating it the first time it is needed
+func electionBlindKey(db *sql.Tx, electionID int) (*rsa.PrivateKey, error) {
+	found, der, err := getElectionKey(db, electionID)
+	if err != nil {
+		return nil, wrapError(err, 328, "could not get election key")
+	}
+
+	if found {
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, wrapError(err, 329, "could not parse election key")
+		}
+		return key, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, BLIND_KEY_BITS)
+	if err != nil {
+		return nil, wrapError(err, 330, "could not generate election key")
+	}
+
+	if err := insertElectionKey(db, electionID, x509.MarshalPKCS1PrivateKey(key)); err != nil {
+		return nil, wrapError(err, 331, "could not insert election key")
+	}
+
+	return key, nil
+}
+
+func publicBlindKey(key *rsa.PublicKey) BlindKey {
+	return BlindKey{N: hex.EncodeToString(key.N.Bytes()), E: key.E}
+}
+
+// fullDomainHash hashes the message to a number of the size of the modulus, so the signatures cannot be combined
+func fullDomainHash(key *rsa.PublicKey, message []byte) *big.Int {
+	size := (key.N.BitLen() + 7) / 8
+	var digest []byte
+	for counter := byte(0); len(digest) < size; counter++ {
+		h := sha256.Sum256(append([]byte{counter}, message...))
+		digest = append(digest, h[:]...)
+	}
+
+	return new(big.Int).Mod(new(big.Int).SetBytes(digest[:size]), key.N)
+}
+
+// blindSign signs the blinded message; it cannot tell what the message is
+func blindSign(key *rsa.PrivateKey, blinded *big.Int) (*big.Int, error) {
+	if blinded.Sign() <= 0 || blinded.Cmp(key.N) >= 0 {
+		return nil, traceError{id: 332, message: "blinded message out of range"}
+	}
+
+	return new(big.Int).Exp(blinded, key.D, key.N), nil
+}
+
+// verifyBlindSignature tells whether the unblinded signature is the signature of the message
+func verifyBlindSignature(key *rsa.PublicKey, message []byte, signature *big.Int) bool {
+	if signature.Sign() <= 0 || signature.Cmp(key.N) >= 0 {
+		return false
+	}
+
+	e := big.NewInt(int64(key.E))
+	return new(big.Int).Exp(signature, e, key.N).Cmp(fullDomainHash(key, message)) == 0
+}
+
+// blindMessage is what the voter does before asking for the signature: it hides the message multiplying its hash by
+// a random factor, which is needed later to unblind the signature
+func blindMessage(key *rsa.PublicKey, message []byte) (blinded, factor *big.Int, err error) {
+	for {
+		factor, err = rand.Int(rand.Reader, key.N)
+		if err != nil {
+			return nil, nil, wrapError(err, 333, "could not generate blinding factor")
+		}
+		if factor.Sign() > 0 && new(big.Int).GCD(nil, nil, factor, key.N).Cmp(big.NewInt(1)) == 0 {
+			break
+		}
+	}
+
+	e := big.NewInt(int64(key.E))
+	blinded = new(big.Int).Exp(factor, e, key.N)
+	blinded.Mul(blinded, fullDomainHash(key, message)).Mod(blinded, key.N)
+	return blinded, factor, nil
+}
+
+// unblindSignature is what the voter does with the signature of the blinded message to get the signature of the message
+func unblindSignature(key *rsa.PublicKey, blindSignature, factor *big.Int) *big.Int {
+	inverse := new(big.Int).ModInverse(factor, key.N)
+	s := new(big.Int).Mul(blindSignature, inverse)
+	return s.Mod(s, key.N)
+}
+
+// parseHexInt parses a number sent hex encoded
+func parseHexInt(s string) (*big.Int, bool) {
+	return new(big.Int).SetString(s, 16)
+}
@@ -12,17 +12,69 @@ const (
 	ROLE_NONE      = "none"      // the user can log in and see public information
 	ROLE_VALIDATED = "validated" // the user can vote in all elections
 	ROLE_ADMIN     = "admin"     // the user can see and edit everythin
+	ROLE_AUDITOR   = "auditor"   // the user can vote, and see the results of elections before they are published
 
 	// ID_ represent types of identification documents used for a user's unique ID
 	ID_DNI      = "dni"      // spanish DNI
 	ID_NIE      = "nie"      // spanish NIE
 	ID_PASSPORT = "passport" // international passport
 
+	// BALLOT_ represent how voters fill their ballots
+	BALLOT_RANKED    = "ranked"    // an ordered list of candidates, from most to least preferred
+	BALLOT_APPROVAL  = "approval"  // an unordered set of the approved candidates
+	BALLOT_PLURALITY = "plurality" // exactly one candidate
+	BALLOT_SCORE     = "score"     // a score between 0 and the election's max score for each candidate
+	BALLOT_GRADES    = "grades"    // one of the election's named grades for each candidate
+	BALLOT_LIST      = "list"      // exactly one list of candidates
+
 	// COUNT_ represent the available count methods for elections
 	COUNT_BORDA   = "borda"   // https://en.wikipedia.org/wiki/Borda_count
 	COUNT_DOWDALL = "dowdall" // https://en.wikipedia.org/wiki/Borda_count
+	// https://en.wikipedia.org/wiki/Counting_single_transferable_votes
+	COUNT_STV_GREGORY       = "stv_gregory"       // droop quota, surplus transferred at reduced value
+	COUNT_STV_MEEK          = "stv_meek"          // droop quota recalculated each round, elected candidates keep a fraction of each vote
+	COUNT_SCHULZE           = "schulze"           // https://en.wikipedia.org/wiki/Schulze_method
+	COUNT_RANKED_PAIRS      = "ranked_pairs"      // https://en.wikipedia.org/wiki/Ranked_pairs
+	COUNT_IRV               = "irv"               // https://en.wikipedia.org/wiki/Instant-runoff_voting
+	COUNT_APPROVAL          = "approval"          // https://en.wikipedia.org/wiki/Approval_voting
+	COUNT_PLURALITY         = "plurality"         // https://en.wikipedia.org/wiki/Plurality_voting
+	COUNT_SCORE             = "score"             // https://en.wikipedia.org/wiki/Score_voting
+	COUNT_MAJORITY_JUDGMENT = "majority_judgment" // https://en.wikipedia.org/wiki/Majority_judgment
+	COUNT_DHONDT            = "dhondt"            // https://en.wikipedia.org/wiki/D%27Hondt_method
+	COUNT_SAINTE_LAGUE      = "sainte_lague"      // https://en.wikipedia.org/wiki/Webster/Sainte-Lagu%C3%AB_method
+
+	// TIE_BREAK_ represent how the ties of a count are settled
+	TIE_BREAK_FIRST_PREFERENCES = "first_preferences" // more votes putting the candidate first, then lot
+	TIE_BREAK_LOT               = "lot"               // lot drawn from the seed of the election, published before voting opens
+	TIE_BREAK_MANUAL            = "manual"            // the admin gives the order of the tied candidates
+
+	// TRUNCATION_ represent how borda and dowdall count ballots that do not rank every candidate
+	TRUNCATION_STANDARD = "standard" // ranked candidates get the points of their position, unranked ones get nothing
+	TRUNCATION_MODIFIED = "modified" // borda gives ranked candidates the points of the last positions; dowdall, those of their position
+	TRUNCATION_AVERAGED = "averaged" // unranked candidates share the points of the positions left
+
+	// ELECTION_ are the states of the lifecycle of an election, in order
+	ELECTION_DRAFT               = "draft"               // only admins can see it
+	ELECTION_NOMINATION          = "nomination"          // public, and candidates can still be added
+	ELECTION_REGISTRATION_CLOSED = "registration_closed" // candidates are final, waiting for the start
+	ELECTION_VOTING              = "voting"
+	ELECTION_SUSPENDED           = "suspended" // voting stopped by an admin, until resumed or closed; not part of the order
+	ELECTION_CLOSED              = "closed"    // waiting for the count, or for the admin to settle ties
+	ELECTION_COUNTED             = "counted"
+	ELECTION_RESULTS_PUBLISHED   = "results_published"
+	ELECTION_ARCHIVED            = "archived"
+
+	// SIGNATURE_ represent what the installation key signs
+	SIGNATURE_RECEIPT = "receipt" // the receipt of a ballot, along with the hash of the ballot
+	SIGNATURE_RESULTS = "results" // the results document of a counted election
+
+	DEFAULT_MAX_SCORE = 5
 
 	MIN_PASSWORD_LENGTH = 8
+	// voting credentials are random strings chosen by the voter, long enough not to be guessed
+	MIN_CREDENTIAL_LENGTH = 32
+	// ballots wait until their election has this many to be written together in a random order
+	BALLOT_BATCH_SIZE = 10
 
 	UPLOADS_FOLDER  = "uploads"
 	SESSIONS_FOLDER = "sessions"
@@ -33,8 +85,38 @@ var (
 	SQLITE_TIME_FORMAT string
 	NOW_TEST_TIME      time.Time
 
-	COUNT_METHODS       = []string{COUNT_BORDA, COUNT_DOWDALL}
-	ID_VALIDATION_FUNCS = map[string]func(string) error{
+	COUNT_METHODS = []string{COUNT_BORDA, COUNT_DOWDALL, COUNT_STV_GREGORY, COUNT_STV_MEEK, COUNT_SCHULZE, COUNT_RANKED_PAIRS, COUNT_IRV,
+		COUNT_APPROVAL, COUNT_PLURALITY, COUNT_SCORE, COUNT_MAJORITY_JUDGMENT, COUNT_DHONDT, COUNT_SAINTE_LAGUE}
+	BALLOT_TYPES = []string{BALLOT_RANKED, BALLOT_APPROVAL, BALLOT_PLURALITY, BALLOT_SCORE, BALLOT_GRADES, BALLOT_LIST}
+	TIE_BREAKS   = []string{TIE_BREAK_FIRST_PREFERENCES, TIE_BREAK_LOT, TIE_BREAK_MANUAL}
+	TRUNCATIONS  = []string{TRUNCATION_STANDARD, TRUNCATION_MODIFIED, TRUNCATION_AVERAGED}
+	SIGNATURES   = []string{SIGNATURE_RECEIPT, SIGNATURE_RESULTS}
+	// each state can only move to the next one; the scheduler makes the transitions that depend on time and the count
+	ELECTION_STATES = []string{ELECTION_DRAFT, ELECTION_NOMINATION, ELECTION_REGISTRATION_CLOSED, ELECTION_VOTING, ELECTION_CLOSED,
+		ELECTION_COUNTED, ELECTION_RESULTS_PUBLISHED, ELECTION_ARCHIVED}
+	// the states an admin can move an election to
+	ADMIN_ELECTION_STATES = []string{ELECTION_NOMINATION, ELECTION_REGISTRATION_CLOSED, ELECTION_ARCHIVED}
+	// the states in which the settings, candidates, lists and questions of an election can change
+	EDITABLE_ELECTION_STATES = []string{ELECTION_DRAFT, ELECTION_NOMINATION}
+	COUNTED_ELECTION_STATES  = []string{ELECTION_COUNTED, ELECTION_RESULTS_PUBLISHED, ELECTION_ARCHIVED}
+	// the states in which everyone can see the results; before them only admins and auditors can
+	PUBLISHED_ELECTION_STATES = []string{ELECTION_RESULTS_PUBLISHED, ELECTION_ARCHIVED}
+	// the count methods that can be used with each ballot type
+	BALLOT_COUNT_METHODS = map[string][]string{
+		BALLOT_RANKED:    {COUNT_BORDA, COUNT_DOWDALL, COUNT_STV_GREGORY, COUNT_STV_MEEK, COUNT_SCHULZE, COUNT_RANKED_PAIRS, COUNT_IRV},
+		BALLOT_APPROVAL:  {COUNT_APPROVAL},
+		BALLOT_PLURALITY: {COUNT_PLURALITY},
+		BALLOT_SCORE:     {COUNT_SCORE},
+		BALLOT_GRADES:    {COUNT_MAJORITY_JUDGMENT},
+		BALLOT_LIST:      {COUNT_DHONDT, COUNT_SAINTE_LAGUE},
+	}
+	// the count methods that accept ballots ranking several candidates the same
+	EQUAL_RANKS_COUNT_METHODS = []string{COUNT_SCHULZE, COUNT_RANKED_PAIRS}
+	// grades used by default in majority judgment, from worst to best
+	DEFAULT_GRADES = []string{"reject", "poor", "acceptable", "good", "very good", "excellent"}
+	// options of a question when none are given
+	DEFAULT_QUESTION_OPTIONS = []string{"yes", "no", "abstain"}
+	ID_VALIDATION_FUNCS      = map[string]func(string) error{
 		ID_DNI:      validateDNI,
 		ID_NIE:      validateNIE,
 		ID_PASSPORT: validatePassport,
@@ -0,0 +1,1068 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// tolerance used when comparing fractional vote values
+	COUNT_EPSILON = 1e-9
+	// maximum number of iterations allowed to converge the keep values of Meek's method
+	MEEK_MAX_ITERATIONS = 1000
+)
+
+// each vote is a list of candidates, or a map with the score of each candidate
+// the result holds the points of each candidate, the method specific details of the count and the ties settled
+func countVotes(e Election, votes []Vote) (CountResults, error) {
+	if !stringInSlice(e.TieBreak, TIE_BREAKS) {
+		return CountResults{}, traceError{id: 182, message: "unknown tie break policy"}
+	}
+
+	countFunc, ok := map[string]func(Election, []Vote, *tieBreaker) CountResults{
+		COUNT_BORDA:             positionalCount(countBorda),
+		COUNT_DOWDALL:           positionalCount(countDowdall),
+		COUNT_STV_GREGORY:       countSTVGregory,
+		COUNT_STV_MEEK:          countSTVMeek,
+		COUNT_SCHULZE:           countSchulze,
+		COUNT_RANKED_PAIRS:      countRankedPairs,
+		COUNT_IRV:               countIRV,
+		COUNT_APPROVAL:          countMarks,
+		COUNT_PLURALITY:         countMarks,
+		COUNT_SCORE:             countScore,
+		COUNT_MAJORITY_JUDGMENT: countMajorityJudgment,
+		COUNT_DHONDT:            highestAveragesCount(dhondtDivisor),
+		COUNT_SAINTE_LAGUE:      highestAveragesCount(sainteLagueDivisor),
+	}[e.CountMethod]
+	if !ok {
+		return CountResults{}, traceError{id: 19, message: "unknown count method"}
+	}
+
+	valid := make([]Vote, 0, len(votes))
+	for _, v := range votes {
+		if !v.Blank {
+			valid = append(valid, v)
+		}
+	}
+
+	tb := newTieBreaker(e, valid)
+	results := countFunc(e, valid, tb)
+	results.Ties = tb.ties
+	results.setBallots(e, votes)
+	return results, nil
+}
+
+// countTally counts an encrypted election from the decrypted number of marks of each candidate, as its ballots only
+// hold ciphertexts; the marks are also the first preferences used to break ties
+func countTally(e Election, votes []Vote, marks map[int]int) (CountResults, error) {
+	if !stringInSlice(e.TieBreak, TIE_BREAKS) {
+		return CountResults{}, traceError{id: 389, message: "unknown tie break policy"}
+	}
+
+	points := initialPoints(e.Candidates)
+	for c, n := range marks {
+		points[c] = float64(n)
+	}
+
+	tb := &tieBreaker{policy: e.TieBreak, seed: e.TieBreakSeed, firstPreferences: marks, resolutions: e.TieResolutions}
+	results := pointsResults(e, points, tb)
+	results.Ties = tb.ties
+	results.setBallots(e, votes)
+	return results, nil
+}
+
+// setBallots sets the number of ballots and blank ballots counted, and the votes of the questions
+func (r *CountResults) setBallots(e Election, votes []Vote) {
+	r.Ballots = len(votes)
+	for _, v := range votes {
+		if v.Blank {
+			r.Blank++
+		}
+	}
+	if len(votes) > 0 {
+		r.BlankPercentage = float64(r.Blank) * 100 / float64(len(votes))
+	}
+	if len(e.Questions) > 0 {
+		r.QuestionVotes = countQuestions(e.Questions, votes)
+	}
+}
+
+// setTurnout computes the percentage of the electorate that cast a ballot, blank or not
+func (r *CountResults) setTurnout(electorate int) {
+	r.Electorate = electorate
+	if electorate > 0 {
+		r.Turnout = float64(r.Ballots) * 100 / float64(electorate)
+	}
+}
+
+// countQuestions counts the votes of each option of the questions, which are independent of the count method of the
+// candidates race
+func countQuestions(questions []Question, votes []Vote) map[int][]int {
+	counts := make(map[int][]int, len(questions))
+	for _, q := range questions {
+		counts[q.ID] = make([]int, len(q.Options))
+	}
+
+	for _, vote := range votes {
+		for q, option := range vote.Answers {
+			if c, ok := counts[q]; ok && option >= 0 && option < len(c) {
+				c[option]++
+			}
+		}
+	}
+
+	return counts
+}
+
+// positionalCount gives points to the candidates depending on their position in each vote; votes that do not rank
+// every candidate are counted following the truncation option of the election
+func positionalCount(pointsFunc func(int, int) float64) func(Election, []Vote, *tieBreaker) CountResults {
+	return func(e Election, votes []Vote, tb *tieBreaker) CountResults {
+		n := len(e.Candidates)
+		points := initialPoints(e.Candidates)
+		for _, vote := range votes {
+			var offset int
+			// ranked candidates take the last positions; dowdall points do not depend on the number of candidates,
+			// so they stay at one over the position
+			if e.Truncation == TRUNCATION_MODIFIED && e.CountMethod == COUNT_BORDA {
+				offset = n - len(vote.Candidates)
+			}
+
+			ranked := make(map[int]bool, len(vote.Candidates))
+			for index, candidate := range vote.Candidates {
+				// the puntuation depends on the index inside the list and possibly on the number of candidates
+				points[candidate] += pointsFunc(index+offset, n)
+				ranked[candidate] = true
+			}
+
+			if e.Truncation == TRUNCATION_AVERAGED && len(vote.Candidates) < n {
+				var left float64
+				for index := len(vote.Candidates); index < n; index++ {
+					left += pointsFunc(index, n)
+				}
+				for c := range points {
+					if !ranked[c] {
+						points[c] += left / float64(n-len(vote.Candidates))
+					}
+				}
+			}
+		}
+
+		results := pointsResults(e, points, tb)
+		results.Truncation = e.Truncation
+		return results
+	}
+}
+
+// countMarks gives a point to each candidate every time it appears in a vote, used for approval and plurality ballots
+func countMarks(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	points := initialPoints(e.Candidates)
+	for _, vote := range votes {
+		for _, candidate := range vote.Candidates {
+			points[candidate]++
+		}
+	}
+
+	return pointsResults(e, points, tb)
+}
+
+// countScore adds the scores of each candidate; candidates with the same total are sorted by the number of
+// votes that gave them the highest score, then the next one, and so on
+func countScore(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	results := CountResults{Distributions: scoreDistributions(e.Candidates, votes, e.MaxScore)}
+	results.Points = initialPoints(e.Candidates)
+	for c, dist := range results.Distributions {
+		for score, n := range dist {
+			results.Points[c] += float64(score * n)
+		}
+	}
+
+	results.Ranking = rankCandidates(e.Candidates, e.Seats, func(a, b int) int {
+		if x := compareVotes(results.Points[a], results.Points[b]); x != 0 {
+			return x
+		}
+		x, y := results.Distributions[a], results.Distributions[b]
+		for score := len(x) - 1; score >= 0; score-- {
+			if x[score] != y[score] {
+				return x[score] - y[score]
+			}
+		}
+		return 0
+	}, tb)
+	results.Elected = topOfRanking(results.Ranking, e.Seats)
+	return results
+}
+
+// countMajorityJudgment gives each candidate its median grade; candidates with the same median are sorted by
+// their majority gauge, the sequence of medians obtained removing the median grade one vote at a time
+func countMajorityJudgment(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	results := CountResults{Distributions: scoreDistributions(e.Candidates, votes, len(e.Grades)-1)}
+	gauges := make(map[int][]int, len(results.Distributions))
+	results.Points = initialPoints(e.Candidates)
+	for c, dist := range results.Distributions {
+		gauges[c] = majorityGauge(dist)
+		if len(gauges[c]) > 0 {
+			results.Points[c] = float64(gauges[c][0])
+		}
+	}
+
+	results.Ranking = rankCandidates(e.Candidates, e.Seats, func(a, b int) int {
+		x, y := gauges[a], gauges[b]
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if x[i] != y[i] {
+				return x[i] - y[i]
+			}
+		}
+		return 0
+	}, tb)
+	results.Elected = topOfRanking(results.Ranking, e.Seats)
+	return results
+}
+
+// highestAveragesCount gives each seat to the list with the highest quotient between its votes and the divisor
+// of the seats it already won, or with more votes when the quotients are equal; lists below the election threshold
+// get no seats, lists with no candidates left cannot take more, and the candidates of each list take its seats in order
+func highestAveragesCount(divisor func(int) float64) func(Election, []Vote, *tieBreaker) CountResults {
+	return func(e Election, votes []Vote, tb *tieBreaker) CountResults {
+		existing := candidateSet(e.Candidates)
+		results := CountResults{ListVotes: make(map[int]int, len(e.Lists)), ListSeats: make(map[int]int, len(e.Lists))}
+		available := make(map[int]int, len(e.Lists))
+		for _, l := range e.Lists {
+			results.ListVotes[l.ID] = 0
+			results.ListSeats[l.ID] = 0
+			for _, c := range l.Candidates {
+				if existing[c] {
+					available[l.ID]++
+				}
+			}
+		}
+
+		var total int
+		for _, v := range votes {
+			if _, ok := results.ListVotes[v.List]; ok {
+				results.ListVotes[v.List]++
+				total++
+			}
+		}
+
+		var qualified []int
+		for _, l := range e.Lists {
+			if total > 0 && float64(results.ListVotes[l.ID])*100 >= e.Threshold*float64(total) && results.ListVotes[l.ID] > 0 && available[l.ID] > 0 {
+				qualified = append(qualified, l.ID)
+			}
+		}
+
+		for seat := 0; seat < e.Seats && len(qualified) > 0; seat++ {
+			best := bestOf(qualified, func(a, b int) int {
+				x := float64(results.ListVotes[a]) / divisor(results.ListSeats[a])
+				y := float64(results.ListVotes[b]) / divisor(results.ListSeats[b])
+				if c := compareVotes(x, y); c != 0 {
+					return c
+				}
+				return results.ListVotes[a] - results.ListVotes[b]
+			}, tb)
+			results.ListSeats[best]++
+			if results.ListSeats[best] == available[best] {
+				qualified = removeInt(qualified, best)
+			}
+		}
+
+		results.Points = initialPoints(e.Candidates)
+		for _, l := range e.Lists {
+			seats := results.ListSeats[l.ID]
+			for _, c := range l.Candidates {
+				if seats == 0 {
+					break
+				}
+				if existing[c] {
+					results.Elected = append(results.Elected, c)
+					results.Points[c] = 1
+					seats--
+				}
+			}
+		}
+
+		return results
+	}
+}
+
+func dhondtDivisor(seats int) float64 {
+	return float64(seats + 1) // 1, 2, 3, 4...
+}
+
+func sainteLagueDivisor(seats int) float64 {
+	return float64(2*seats + 1) // 1, 3, 5, 7...
+}
+
+// scoreDistributions counts how many votes gave each score to each candidate; not scoring a candidate is
+// the same as giving it the lowest score
+func scoreDistributions(candidates []Candidate, votes []Vote, maxScore int) map[int][]int {
+	dists := make(map[int][]int, len(candidates))
+	for _, c := range candidates {
+		dists[c.ID] = make([]int, maxScore+1)
+	}
+
+	for _, v := range votes {
+		for c, dist := range dists {
+			score, ok := v.Scores[c]
+			if !ok || score < 0 || score > maxScore {
+				score = 0
+			}
+			dist[score]++
+		}
+	}
+
+	return dists
+}
+
+// majorityGauge returns the lower median of the grades, then the lower median once it is removed, and so on
+func majorityGauge(dist []int) []int {
+	counts := append([]int{}, dist...)
+	var total int
+	for _, n := range counts {
+		total += n
+	}
+
+	gauge := make([]int, 0, total)
+	for ; total > 0; total-- {
+		position := (total - 1) / 2 // zero based position of the lower median
+		for grade, n := range counts {
+			if position < n {
+				gauge = append(gauge, grade)
+				counts[grade]--
+				break
+			}
+			position -= n
+		}
+	}
+
+	return gauge
+}
+
+// rankCandidates sorts the candidates from best to worst given a comparison function that returns a positive
+// number when a is better than b, a negative one when it is worse and zero when they are tied; only a tie across
+// the last seat is settled by the tie breaker
+func rankCandidates(candidates []Candidate, seats int, compare func(a, b int) int, tb *tieBreaker) []int {
+	ranking := make([]int, 0, len(candidates))
+	for _, c := range candidates {
+		ranking = append(ranking, c.ID)
+	}
+	return settleTies(ranking, seats, compare, tb)
+}
+
+// settleTies sorts ids from best to worst given a comparison function like the one of rankCandidates; the group of
+// tied ids that straddles the cutoff, taking some of the first cutoff places but not all, is sorted by the tie
+// breaker, and the others by lower id first because their order decides nothing, as when the tie breaker is nil
+func settleTies(ids []int, cutoff int, compare func(a, b int) int, tb *tieBreaker) []int {
+	sort.Ints(ids)
+	sort.SliceStable(ids, func(i, j int) bool {
+		return compare(ids[i], ids[j]) > 0
+	})
+
+	if tb == nil {
+		return ids
+	}
+
+	for i := 0; i < len(ids); {
+		j := i + 1
+		for j < len(ids) && compare(ids[i], ids[j]) == 0 {
+			j++
+		}
+		if i < cutoff && cutoff < j {
+			copy(ids[i:j], tb.order(ids[i:j]))
+		}
+		i = j
+	}
+	return ids
+}
+
+// bestOf returns the best of ids given a comparison function like the one of rankCandidates, settling a tie for
+// the first place with the tie breaker
+func bestOf(ids []int, compare func(a, b int) int, tb *tieBreaker) int {
+	tied := []int{ids[0]}
+	for _, id := range ids[1:] {
+		if x := compare(id, tied[0]); x > 0 {
+			tied = []int{id}
+		} else if x == 0 {
+			tied = append(tied, id)
+		}
+	}
+
+	if len(tied) == 1 {
+		return tied[0]
+	}
+	return tb.order(tied)[0]
+}
+
+func topOfRanking(ranking []int, seats int) []int {
+	if len(ranking) > seats {
+		return append([]int{}, ranking[:seats]...)
+	}
+	return ranking
+}
+
+func countBorda(index, totalCandidates int) float64 {
+	return float64(totalCandidates - index) // if there are 12 candidates, 12 for the first, 11 the second... 1 for the last
+}
+
+func countDowdall(index, totalCandidates int) float64 {
+	return 1.0 / float64(index+1) // 1 for the first, 0.5 for the second, 0.333... for the third, etc.
+}
+
+// countSTVGregory transfers the whole surplus of each elected candidate at a reduced weight (weighted inclusive
+// Gregory method), one candidate per round, and excludes the candidate with fewer votes when nobody reaches the quota
+func countSTVGregory(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	ballots := newSTVBallots(votes)
+	hopeful := candidateSet(e.Candidates)
+	quota := math.Floor(float64(len(ballots))/float64(e.Seats+1)) + 1 // Droop quota
+	results := CountResults{Quota: quota}
+	elected := make(map[int]bool)
+
+	for len(results.Elected) < e.Seats && len(hopeful) > 0 {
+		round := CountRound{Votes: make(map[int]float64, len(e.Candidates))}
+		for c := range hopeful {
+			round.Votes[c] = 0
+		}
+		for c := range elected {
+			round.Votes[c] = quota
+		}
+
+		for i := range ballots {
+			b := &ballots[i]
+			b.current = b.firstIn(hopeful)
+			if b.current == 0 {
+				round.Exhausted += b.weight
+			} else {
+				round.Votes[b.current] += b.weight
+			}
+		}
+
+		if len(hopeful) <= e.Seats-len(results.Elected) {
+			round.Elected = sortedByVotes(hopeful, round.Votes, 0, nil)
+			results.addRound(round)
+			break
+		}
+
+		reached := sortedByVotes(reachingQuota(hopeful, round.Votes, quota), round.Votes, 1, tb)
+		if len(reached) > 0 {
+			c := reached[0]
+			round.Elected = []int{c}
+			round.Surplus = round.Votes[c] - quota
+			ratio := round.Surplus / round.Votes[c]
+			for i := range ballots {
+				if ballots[i].current == c {
+					ballots[i].weight *= ratio
+				}
+			}
+			delete(hopeful, c)
+			elected[c] = true
+			results.addRound(round)
+			continue
+		}
+
+		c := fewestVotes(hopeful, round.Votes, tb)
+		round.Excluded = []int{c}
+		delete(hopeful, c)
+		results.addRound(round)
+	}
+
+	results.Points = decisionPoints(e.Candidates, results.Rounds)
+	return results
+}
+
+// countSTVMeek gives each elected candidate a keep value, the fraction of each vote reaching it that it retains, and
+// iterates them until every elected candidate holds exactly the quota, which is recalculated with the exhausted votes
+func countSTVMeek(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	ballots := newSTVBallots(votes)
+	keep := make(map[int]float64, len(e.Candidates))
+	hopeful := candidateSet(e.Candidates)
+	for c := range hopeful {
+		keep[c] = 1
+	}
+
+	var results CountResults
+	for len(results.Elected) < e.Seats && len(hopeful) > 0 {
+		var round CountRound
+		for i := 0; i < MEEK_MAX_ITERATIONS; i++ {
+			round.Votes, round.Exhausted = meekDistribute(ballots, keep)
+			round.Quota = (float64(len(ballots)) - round.Exhausted) / float64(e.Seats+1)
+
+			converged := true
+			for _, c := range results.Elected {
+				if round.Votes[c] > COUNT_EPSILON && math.Abs(round.Votes[c]-round.Quota) > COUNT_EPSILON {
+					keep[c] *= round.Quota / round.Votes[c]
+					converged = false
+				}
+			}
+			if converged {
+				break
+			}
+		}
+
+		round.KeepValues = make(map[int]float64, len(results.Elected))
+		for _, c := range results.Elected {
+			round.KeepValues[c] = keep[c]
+		}
+
+		if len(hopeful) <= e.Seats-len(results.Elected) {
+			round.Elected = sortedByVotes(hopeful, round.Votes, 0, nil)
+			results.addRound(round)
+			break
+		}
+
+		if reached := reachingQuota(hopeful, round.Votes, round.Quota); len(reached) > 0 {
+			round.Elected = sortedByVotes(reached, round.Votes, 0, nil)
+			if remaining := e.Seats - len(results.Elected); len(reached) > remaining {
+				// only the order of the candidates that do not fit in the remaining seats decides anything
+				round.Elected = sortedByVotes(reached, round.Votes, remaining, tb)[:remaining]
+			}
+			for _, c := range round.Elected {
+				delete(hopeful, c)
+			}
+			results.addRound(round)
+			continue
+		}
+
+		c := fewestVotes(hopeful, round.Votes, tb)
+		round.Excluded = []int{c}
+		keep[c] = 0
+		delete(hopeful, c)
+		results.addRound(round)
+	}
+
+	if len(results.Rounds) > 0 {
+		results.Quota = results.Rounds[len(results.Rounds)-1].Quota
+	}
+	results.Points = decisionPoints(e.Candidates, results.Rounds)
+	return results
+}
+
+func meekDistribute(ballots []stvBallot, keep map[int]float64) (map[int]float64, float64) {
+	votes := make(map[int]float64, len(keep))
+	for c, k := range keep {
+		if k > 0 {
+			votes[c] = 0
+		}
+	}
+
+	var exhausted float64
+	for _, b := range ballots {
+		weight := 1.0
+		for _, c := range b.candidates {
+			k := keep[c]
+			if k == 0 {
+				continue
+			}
+			votes[c] += weight * k
+			weight *= 1 - k
+			if weight < COUNT_EPSILON {
+				weight = 0
+				break
+			}
+		}
+		exhausted += weight
+	}
+
+	return votes, exhausted
+}
+
+// countIRV counts the first preferences of the ballots among the remaining candidates and excludes the one
+// with fewer votes, until a candidate has the majority of the ballots that are not exhausted yet
+func countIRV(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	ballots := newSTVBallots(votes)
+	hopeful := candidateSet(e.Candidates)
+
+	var results CountResults
+	for len(hopeful) > 0 {
+		round := CountRound{Votes: make(map[int]float64, len(hopeful))}
+		for c := range hopeful {
+			round.Votes[c] = 0
+		}
+
+		for _, b := range ballots {
+			if c := b.firstIn(hopeful); c == 0 {
+				round.Exhausted++
+			} else {
+				round.Votes[c]++
+			}
+		}
+
+		round.Quota = math.Floor((float64(len(ballots))-round.Exhausted)/2) + 1
+		leader := sortedByVotes(hopeful, round.Votes, 0, nil)[0]
+		if len(hopeful) == 1 || round.Votes[leader] >= round.Quota {
+			round.Elected = []int{leader}
+			results.addRound(round)
+			break
+		}
+
+		c := fewestVotes(hopeful, round.Votes, tb)
+		round.Excluded = []int{c}
+		delete(hopeful, c)
+		results.addRound(round)
+	}
+
+	results.Points = decisionPoints(e.Candidates, results.Rounds)
+	return results
+}
+
+// countSchulze ranks the candidates by the number of rivals they beat through the strongest paths of the pairwise
+// preferences graph, where the strength of a path is its weakest link, measured in winning votes
+func countSchulze(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	ids, d := pairwiseMatrix(e.Candidates, votes)
+	n := len(ids)
+	p := make([][]int, n)
+	for i := range p {
+		p[i] = make([]int, n)
+		for j := range p[i] {
+			if i != j && d[i][j] > d[j][i] {
+				p[i][j] = d[i][j]
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			if i == k {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if j != i && j != k {
+					p[i][j] = maxInt(p[i][j], minInt(p[i][k], p[k][j]))
+				}
+			}
+		}
+	}
+
+	beats := make([][]bool, n)
+	for i := range beats {
+		beats[i] = make([]bool, n)
+		for j := range beats[i] {
+			beats[i][j] = p[i][j] > p[j][i]
+		}
+	}
+
+	results := pairwiseResults(e, ids, d, beats, tb)
+	results.StrongestPaths = p
+	return results
+}
+
+// countRankedPairs locks the pairwise victories from the largest to the smallest, skipping the ones that would
+// create a cycle, and ranks the candidates by the number of rivals they precede in the locked graph
+func countRankedPairs(e Election, votes []Vote, tb *tieBreaker) CountResults {
+	ids, d := pairwiseMatrix(e.Candidates, votes)
+	n := len(ids)
+	var pairs [][2]int
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if d[i][j] > d[j][i] {
+				pairs = append(pairs, [2]int{i, j})
+			}
+		}
+	}
+
+	sort.SliceStable(pairs, func(a, b int) bool {
+		x, y := pairs[a], pairs[b]
+		if d[x[0]][x[1]] != d[y[0]][y[1]] {
+			return d[x[0]][x[1]] > d[y[0]][y[1]] // larger winning votes first
+		}
+		return d[x[1]][x[0]] < d[y[1]][y[0]] // smaller losing votes first
+	})
+
+	locked := make([][]bool, n)
+	for i := range locked {
+		locked[i] = make([]bool, n)
+	}
+
+	var lockedPairs [][2]int
+	for _, pair := range pairs {
+		if reachable(locked, pair[1], pair[0]) {
+			continue
+		}
+		locked[pair[0]][pair[1]] = true
+		lockedPairs = append(lockedPairs, [2]int{ids[pair[0]], ids[pair[1]]})
+	}
+
+	beats := make([][]bool, n)
+	for i := range beats {
+		beats[i] = make([]bool, n)
+		for j := range beats[i] {
+			beats[i][j] = i != j && reachable(locked, i, j)
+		}
+	}
+
+	results := pairwiseResults(e, ids, d, beats, tb)
+	results.LockedPairs = lockedPairs
+	return results
+}
+
+// pairwiseMatrix returns the candidate ids sorted, and a matrix where d[i][j] is the number of votes that prefer
+// the candidate i to the candidate j; ranked candidates are preferred to the ones left out of the vote, and
+// candidates with the same rank are not preferred to each other
+func pairwiseMatrix(candidates []Candidate, votes []Vote) ([]int, [][]int) {
+	ids := make([]int, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.ID)
+	}
+	sort.Ints(ids)
+
+	index := make(map[int]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	d := make([][]int, len(ids))
+	for i := range d {
+		d[i] = make([]int, len(ids))
+	}
+
+	for _, vote := range votes {
+		ranks := ballotRanks(vote)
+		for c, rank := range ranks {
+			i, ok := index[c]
+			if !ok {
+				continue
+			}
+			for j, id := range ids {
+				if other, ranked := ranks[id]; j != i && (!ranked || rank < other) {
+					d[i][j]++
+				}
+			}
+		}
+	}
+
+	return ids, d
+}
+
+// pairwiseResults builds the results of a pairwise method, given which candidates beat which
+func pairwiseResults(e Election, ids []int, d [][]int, beats [][]bool, tb *tieBreaker) CountResults {
+	points := make(map[int]float64, len(ids))
+	for i, id := range ids {
+		points[id] = 0
+		for j := range ids {
+			if beats[i][j] {
+				points[id]++
+			}
+		}
+	}
+
+	results := pointsResults(e, points, tb)
+	results.MatrixCandidates, results.Pairwise = ids, d
+	for i, id := range ids {
+		isWinner := len(ids) > 1
+		for j := range ids {
+			if i != j && d[i][j] <= d[j][i] {
+				isWinner = false
+			}
+		}
+		if isWinner {
+			results.CondorcetWinner = id
+		}
+	}
+
+	return results
+}
+
+// pointsResults ranks the candidates by their points, and elects the first ones
+func pointsResults(e Election, points map[int]float64, tb *tieBreaker) CountResults {
+	results := CountResults{Points: points}
+	results.Ranking = rankCandidates(e.Candidates, e.Seats, func(a, b int) int {
+		return compareVotes(points[a], points[b])
+	}, tb)
+	results.Elected = topOfRanking(results.Ranking, e.Seats)
+	return results
+}
+
+func reachable(graph [][]bool, from, to int) bool {
+	visited := make([]bool, len(graph))
+	stack := []int{from}
+	for len(stack) > 0 {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if x == to {
+			return true
+		}
+		if visited[x] {
+			continue
+		}
+		visited[x] = true
+		for y, edge := range graph[x] {
+			if edge && !visited[y] {
+				stack = append(stack, y)
+			}
+		}
+	}
+	return false
+}
+
+// ballotRanks returns the rank of each candidate in a ranked vote, from 1, given by its position in the list of
+// candidates unless the vote has equal rankings
+func ballotRanks(v Vote) map[int]int {
+	if len(v.Ranks) > 0 {
+		return v.Ranks
+	}
+
+	ranks := make(map[int]int, len(v.Candidates))
+	for i, c := range v.Candidates {
+		if _, ok := ranks[c]; !ok {
+			ranks[c] = i + 1
+		}
+	}
+	return ranks
+}
+
+type stvBallot struct {
+	candidates []int
+	weight     float64
+	current    int
+}
+
+func newSTVBallots(votes []Vote) []stvBallot {
+	ballots := make([]stvBallot, 0, len(votes))
+	for _, v := range votes {
+		if len(v.Candidates) > 0 {
+			ballots = append(ballots, stvBallot{candidates: v.Candidates, weight: 1})
+		}
+	}
+	return ballots
+}
+
+func (b stvBallot) firstIn(set map[int]bool) int {
+	if b.weight < COUNT_EPSILON {
+		return 0
+	}
+
+	for _, c := range b.candidates {
+		if set[c] {
+			return c
+		}
+	}
+	return 0
+}
+
+func (r *CountResults) addRound(round CountRound) {
+	round.NewlyExhausted = round.Exhausted
+	if len(r.Rounds) > 0 {
+		round.NewlyExhausted -= r.Rounds[len(r.Rounds)-1].Exhausted
+	}
+	r.Elected = append(r.Elected, round.Elected...)
+	r.Rounds = append(r.Rounds, round)
+}
+
+// decisionPoints gives each candidate the votes it had in the round it was elected or excluded, or in the last
+// round for the ones that were not decided
+func decisionPoints(candidates []Candidate, rounds []CountRound) map[int]float64 {
+	points := initialPoints(candidates)
+	decided := make(map[int]bool, len(candidates))
+	for _, round := range rounds {
+		for c, v := range round.Votes {
+			if !decided[c] {
+				points[c] = v
+			}
+		}
+		for _, c := range round.Elected {
+			decided[c] = true
+		}
+		for _, c := range round.Excluded {
+			decided[c] = true
+		}
+	}
+	return points
+}
+
+func initialPoints(candidates []Candidate) map[int]float64 {
+	points := make(map[int]float64, len(candidates))
+	for _, candidate := range candidates {
+		points[candidate.ID] = 0
+	}
+	return points
+}
+
+func candidateSet(candidates []Candidate) map[int]bool {
+	set := make(map[int]bool, len(candidates))
+	for _, c := range candidates {
+		set[c.ID] = true
+	}
+	return set
+}
+
+func reachingQuota(set map[int]bool, votes map[int]float64, quota float64) map[int]bool {
+	reached := make(map[int]bool)
+	for c := range set {
+		if votes[c] >= quota-COUNT_EPSILON {
+			reached[c] = true
+		}
+	}
+	return reached
+}
+
+// sortedByVotes returns the candidates in set from most to fewer votes, ties settled as in settleTies
+func sortedByVotes(set map[int]bool, votes map[int]float64, cutoff int, tb *tieBreaker) []int {
+	l := make([]int, 0, len(set))
+	for c := range set {
+		l = append(l, c)
+	}
+
+	return settleTies(l, cutoff, func(a, b int) int {
+		return compareVotes(votes[a], votes[b])
+	}, tb)
+}
+
+// fewestVotes returns the candidate in set with fewer votes, a tie settled by excluding the last one in the order
+// given by the tie breaker
+func fewestVotes(set map[int]bool, votes map[int]float64, tb *tieBreaker) int {
+	l := sortedByVotes(set, votes, 0, nil)
+	var tied []int
+	for _, c := range l {
+		if compareVotes(votes[c], votes[l[len(l)-1]]) == 0 {
+			tied = append(tied, c)
+		}
+	}
+
+	if len(tied) == 1 {
+		return tied[0]
+	}
+	order := tb.order(tied)
+	return order[len(order)-1]
+}
+
+// compareVotes returns 1 when x is greater than y, -1 when it is lower, and 0 when they are equal within COUNT_EPSILON
+func compareVotes(x, y float64) int {
+	if math.Abs(x-y) <= COUNT_EPSILON {
+		return 0
+	}
+	return int(math.Copysign(1, x-y))
+}
+
+// tieBreaker settles the ties of a count following the tie break policy of the election, and keeps every tie
+// with the order used so the count can be reproduced; ties are between candidates, or lists in list elections
+type tieBreaker struct {
+	policy           string
+	seed             string
+	firstPreferences map[int]int
+	resolutions      [][]int
+	ties             []Tie
+}
+
+func newTieBreaker(e Election, votes []Vote) *tieBreaker {
+	return &tieBreaker{
+		policy:           e.TieBreak,
+		seed:             e.TieBreakSeed,
+		firstPreferences: firstPreferences(e.BallotType, votes),
+		resolutions:      e.TieResolutions,
+	}
+}
+
+// order returns the tied ids from best to worst
+func (tb *tieBreaker) order(tied []int) []int {
+	tie := Tie{Candidates: append([]int{}, tied...), Policy: tb.policy}
+	sort.Ints(tie.Candidates)
+
+	switch tb.policy {
+	case TIE_BREAK_MANUAL:
+		tie.Order = tb.resolution(tie.Candidates)
+		if tie.Order == nil {
+			// the count goes on with the lower ids first, but it will not be final until the admin settles the tie
+			tie.Order, tie.Pending = append([]int{}, tie.Candidates...), true
+		}
+	case TIE_BREAK_FIRST_PREFERENCES:
+		tie.Order = tb.lot(tie.Candidates)
+		sort.SliceStable(tie.Order, func(i, j int) bool {
+			return tb.firstPreferences[tie.Order[i]] > tb.firstPreferences[tie.Order[j]]
+		})
+		for i := 1; i < len(tie.Order); i++ {
+			if tb.firstPreferences[tie.Order[i]] == tb.firstPreferences[tie.Order[i-1]] {
+				tie.Policy = TIE_BREAK_LOT // first preferences were not enough
+			}
+		}
+	default:
+		tie.Order = tb.lot(tie.Candidates)
+	}
+
+	tb.ties = append(tb.ties, tie)
+	return append([]int{}, tie.Order...)
+}
+
+// resolution returns the order given by the admin to the tied ids, or nil if there is none
+func (tb *tieBreaker) resolution(tied []int) []int {
+	for _, r := range tb.resolutions {
+		if sameCandidates(r, tied) {
+			return append([]int{}, r...)
+		}
+	}
+	return nil
+}
+
+// lot sorts the ids by the hash of the seed followed by the id, so anybody that knows the seed can repeat the draw
+func (tb *tieBreaker) lot(ids []int) []int {
+	draws := make(map[int]string, len(ids))
+	for _, id := range ids {
+		h := sha256.Sum256([]byte(tb.seed + ":" + strconv.Itoa(id)))
+		draws[id] = hex.EncodeToString(h[:])
+	}
+
+	l := append([]int{}, ids...)
+	sort.Slice(l, func(i, j int) bool {
+		return draws[l[i]] < draws[l[j]]
+	})
+	return l
+}
+
+// firstPreferences counts the votes that put each candidate first: the first one of a ranked vote, every approved
+// candidate, the candidates with the highest score of a score or grades vote, or the list of a list vote
+func firstPreferences(ballotType string, votes []Vote) map[int]int {
+	first := make(map[int]int)
+	for _, v := range votes {
+		switch ballotType {
+		case BALLOT_APPROVAL:
+			for _, c := range v.Candidates {
+				first[c]++
+			}
+		case BALLOT_SCORE, BALLOT_GRADES:
+			var best int
+			for _, score := range v.Scores {
+				best = maxInt(best, score)
+			}
+			for c, score := range v.Scores {
+				if best > 0 && score == best {
+					first[c]++
+				}
+			}
+		case BALLOT_LIST:
+			first[v.List]++
+		default:
+			ranks := ballotRanks(v)
+			best := math.MaxInt32
+			for _, rank := range ranks {
+				best = minInt(best, rank)
+			}
+			for c, rank := range ranks {
+				if rank == best {
+					first[c]++
+				}
+			}
+		}
+	}
+	return first
+}
+
+// pendingTies tells whether a tie is waiting for the admin to settle it, so the results are not final
+func (r CountResults) pendingTies() bool {
+	for _, t := range r.Ties {
+		if t.Pending {
+			return true
+		}
+	}
+	return false
+}
+
+func (r CountResults) pendingTie(candidates []int) bool {
+	for _, t := range r.Ties {
+		if t.Pending && sameCandidates(t.Candidates, candidates) {
+			return true
+		}
+	}
+	return false
+}
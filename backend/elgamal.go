@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/oriolf/bella-ciao/verifier"
+)
+
+// Encrypted elections keep the marks of approval and plurality ballots encrypted with exponential ElGamal, one
+// ciphertext for each candidate, so the database does not tell what each ballot voted. Multiplying ciphertexts adds up
+// the numbers they hold, so the count only decrypts the product of the ciphertexts of each candidate. The secret key is
+// split among the trustees when the election is created, and is not stored anywhere; decrypting the tally needs a
+// quorum of trustees, each sending the partial decryption made with its share and the proof that it did. Every ballot
+// comes with the proofs that it is valid, which anyone can check with the verifier package.
+
+// EncryptedTally is what the trustees decrypt: the product of the ciphertexts of every ballot for each candidate,
+// along with the partial decryptions sent so far
+type EncryptedTally struct {
+	ElectionID  int                         `json:"election_id"`
+	Ballots     int                         `json:"ballots"`
+	Quorum      int                         `json:"quorum"`
+	Ciphertexts map[int]verifier.Ciphertext `json:"ciphertexts"`
+	Decryptions []PartialDecryption         `json:"decryptions"`
+}
+
+// setupTally generates the tally key of an encrypted election, and splits its secret among the trustees, who should
+// be admins or auditors; the shares of an election that was set up before are replaced
+func setupTally(db *sql.Tx, e Election) error {
+	if err := deleteTrusteeShares(db, e.ID); err != nil {
+		return wrapError(err, 365, "could not delete previous trustee shares")
+	}
+
+	if !e.Encrypted {
+		return setTallyKey(db, e.ID, "")
+	}
+
+	for _, userID := range e.Trustees {
+		user, err := getUser(db, userID)
+		if err != nil {
+			return wrapError(err, 366, "could not get trustee %d", userID)
+		}
+		if !canSeeResults(&user) {
+			return traceError{id: 367, message: fmt.Sprintf("user %d cannot be a trustee", userID)}
+		}
+	}
+
+	secret, shares, err := splitSecret(e.Quorum, len(e.Trustees))
+	if err != nil {
+		return wrapError(err, 368, "could not split tally secret")
+	}
+
+	if err := setTallyKey(db, e.ID, hex.EncodeToString(new(big.Int).Exp(verifier.G, secret, verifier.P).Bytes())); err != nil {
+		return wrapError(err, 369, "could not set tally key")
+	}
+
+	for i, userID := range e.Trustees {
+		share := hex.EncodeToString(shares[i].Bytes())
+		verification := hex.EncodeToString(new(big.Int).Exp(verifier.G, shares[i], verifier.P).Bytes())
+		t := TrusteeShare{ElectionID: e.ID, UserID: userID, Index: i + 1, Share: &share, Verification: verification}
+		if err := insertTrusteeShare(db, t); err != nil {
+			return wrapError(err, 370, "could not insert share of trustee %d", userID)
+		}
+	}
+
+	return nil
+}
+
+// splitSecret generates a secret and the shares of n trustees, such that any quorum of them can rebuild it: the
+// shares are the points 1 to n of a random polynomial of degree quorum-1 whose value at 0 is the secret
+func splitSecret(quorum, n int) (*big.Int, []*big.Int, error) {
+	coefficients := make([]*big.Int, quorum)
+	for i := range coefficients {
+		c, err := verifier.RandomExponent()
+		if err != nil {
+			return nil, nil, wrapError(err, 371, "could not generate coefficient")
+		}
+		coefficients[i] = c
+	}
+
+	shares := make([]*big.Int, n)
+	for i := range shares {
+		x, share := big.NewInt(int64(i+1)), new(big.Int)
+		for j := len(coefficients) - 1; j >= 0; j-- {
+			share.Mul(share, x).Add(share, coefficients[j]).Mod(share, verifier.Q)
+		}
+		shares[i] = share
+	}
+
+	return coefficients[0], shares, nil
+}
+
+// lagrangeCoefficient is the weight of the share with the index when rebuilding the secret from the shares of the
+// indexes
+func lagrangeCoefficient(index int, indexes []int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, j := range indexes {
+		if j == index {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(j))).Mod(num, verifier.Q)
+		den.Mul(den, big.NewInt(int64(j-index))).Mod(den, verifier.Q)
+	}
+	return num.Mul(num, den.ModInverse(den, verifier.Q)).Mod(num, verifier.Q)
+}
+
+// tallyCiphertexts multiplies the ciphertexts of the votes for each candidate, which encrypts the number of marks
+func tallyCiphertexts(e Election, votes []Vote) (map[int]verifier.Ciphertext, error) {
+	tally := make(map[int]verifier.Ciphertext, len(e.Candidates))
+	for _, c := range e.Candidates {
+		ciphertexts := make([]verifier.Ciphertext, 0, len(votes))
+		for _, v := range votes {
+			if v.Encrypted == nil {
+				return nil, traceError{id: 423, message: fmt.Sprintf("ballot %s is not encrypted", v.Hash)}
+			}
+			ciphertexts = append(ciphertexts, v.Encrypted.Ciphertexts[c.ID])
+		}
+
+		product, err := verifier.Multiply(ciphertexts...)
+		if err != nil {
+			return nil, wrapError(err, 374, "a ballot has no valid ciphertext for candidate %d", c.ID)
+		}
+		tally[c.ID] = product
+	}
+	return tally, nil
+}
+
+// decryptTally returns the number of marks of each candidate once a quorum of trustees sent their partial
+// decryptions, and false while they did not
+func decryptTally(db *sql.Tx, e Election, votes []Vote) (map[int]int, bool, error) {
+	decryptions, err := getPartialDecryptions(db, e.ID)
+	if err != nil {
+		return nil, false, wrapError(err, 375, "could not get partial decryptions")
+	}
+
+	if len(decryptions) < e.Quorum {
+		return nil, false, nil
+	}
+
+	decryptions = decryptions[:e.Quorum]
+	tally, err := tallyCiphertexts(e, votes)
+	if err != nil {
+		return nil, false, wrapError(err, 376, "could not tally ciphertexts")
+	}
+
+	marks := make(map[int]int, len(tally))
+	for c, ciphertext := range tally {
+		partials := make(map[int]*big.Int, len(decryptions))
+		for _, d := range decryptions {
+			partial, ok := parseHexInt(d.Values[c])
+			if !ok {
+				return nil, false, traceError{id: 377, message: fmt.Sprintf("trustee %d sent no partial decryption for candidate %d", d.Trustee, c)}
+			}
+			partials[d.Trustee] = partial
+		}
+
+		m, ok := combinePartials(ciphertext, partials, len(votes))
+		if !ok {
+			return nil, false, traceError{id: 378, message: fmt.Sprintf("tally of candidate %d could not be decrypted", c)}
+		}
+		marks[c] = m
+	}
+
+	return marks, true, nil
+}
+
+// combinePartials decrypts a ciphertext that holds a number up to the maximum with the partial decryptions of a
+// quorum of trustees, by the index of their shares: a^secret is rebuilt from them, and g^m is what is left of b
+func combinePartials(c verifier.Ciphertext, partials map[int]*big.Int, max int) (int, bool) {
+	_, b, err := c.Values()
+	if err != nil {
+		return 0, false
+	}
+
+	indexes := make([]int, 0, len(partials))
+	for i := range partials {
+		indexes = append(indexes, i)
+	}
+
+	shared := big.NewInt(1)
+	for i, partial := range partials {
+		shared.Mul(shared, new(big.Int).Exp(partial, lagrangeCoefficient(i, indexes), verifier.P)).Mod(shared, verifier.P)
+	}
+
+	gm := shared.ModInverse(shared, verifier.P)
+	if gm == nil {
+		return 0, false
+	}
+	return smallDiscreteLog(gm.Mul(gm, b).Mod(gm, verifier.P), max)
+}
+
+// smallDiscreteLog finds m such that g^m is the number, trying every m up to the maximum
+func smallDiscreteLog(x *big.Int, max int) (int, bool) {
+	power := big.NewInt(1)
+	for m := 0; m <= max; m++ {
+		if power.Cmp(x) == 0 {
+			return m, true
+		}
+		power.Mul(power, verifier.G).Mod(power, verifier.P)
+	}
+	return 0, false
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// nextElectionState returns the state that follows the given one in the lifecycle of an election
+func nextElectionState(state string) (string, bool) {
+	for i, s := range ELECTION_STATES[:len(ELECTION_STATES)-1] {
+		if s == state {
+			return ELECTION_STATES[i+1], true
+		}
+	}
+	return "", false
+}
+
+// setElectionFlags sets the fields that follow from the state of the election
+func (e *Election) setElectionFlags() {
+	e.Public = e.State != ELECTION_DRAFT
+	e.Counted = stringInSlice(e.State, COUNTED_ELECTION_STATES)
+}
+
+// resultsPublished tells whether everyone can see the results of the election
+func resultsPublished(e Election) bool {
+	return stringInSlice(e.State, PUBLISHED_ELECTION_STATES)
+}
+
+// hideResults removes everything the count wrote to the election and its candidates, lists and questions
+func (e *Election) hideResults() {
+	e.Results = nil
+	hideCandidatesPoints(e.Candidates)
+	hideListsResults(e.Lists)
+	hideQuestionsVotes(e.Questions)
+}
+
+func hideCandidatesPoints(candidates []Candidate) {
+	for i := range candidates {
+		candidates[i].Points = 0
+	}
+}
+
+func hideListsResults(lists []CandidateList) {
+	for i := range lists {
+		lists[i].Votes, lists[i].Seats = 0, 0
+	}
+}
+
+func hideQuestionsVotes(questions []Question) {
+	for i := range questions {
+		questions[i].Votes = []int{}
+	}
+}
+
+// validTransition tells whether an election can move between the states: to the next state of its lifecycle, or
+// between voting and suspended, or closing the voting early while suspended
+func validTransition(from, to string) bool {
+	if next, ok := nextElectionState(from); ok && next == to {
+		return true
+	}
+
+	switch from {
+	case ELECTION_VOTING:
+		return to == ELECTION_SUSPENDED
+	case ELECTION_SUSPENDED:
+		return to == ELECTION_VOTING || to == ELECTION_CLOSED
+	}
+	return false
+}
+
+// sharesStored tells whether the server still holds shares of the tally key of the election that the trustees did not
+// take; voting does not open until they all did, so no ballot is cast while the server could decrypt it
+func sharesStored(db *sql.Tx, e Election) (bool, error) {
+	if !e.Encrypted {
+		return false, nil
+	}
+
+	count, err := countStoredTrusteeShares(db, e.ID)
+	if err != nil {
+		return false, wrapError(err, 469, "could not count stored trustee shares")
+	}
+
+	return count > 0, nil
+}
+
+// transitionElection moves the election to another state, and records when, who and why did it, along with the root
+// of the ballots when voting closes; userID is zero and reason is empty when the scheduler does it
+func transitionElection(db *sql.Tx, e *Election, to string, userID int, reason string) error {
+	if !validTransition(e.State, to) {
+		return traceError{id: 269, message: fmt.Sprintf("election cannot move from %s to %s", e.State, to)}
+	}
+
+	if e.State == ELECTION_REGISTRATION_CLOSED && to == ELECTION_VOTING {
+		stored, err := sharesStored(db, *e)
+		if err != nil {
+			return wrapError(err, 470, "could not check trustee shares")
+		}
+		if stored {
+			return traceError{id: 471, message: "voting cannot open until all trustees take their shares"}
+		}
+	}
+
+	t := ElectionTransition{ElectionID: e.ID, From: e.State, To: to, At: now(), UserID: userID, Reason: reason}
+	if to == ELECTION_CLOSED {
+		if err := flushBallots(db, e.ID); err != nil {
+			return wrapError(err, 484, "could not write queued ballots")
+		}
+
+		root, err := ballotsRoot(db, e.ID)
+		if err != nil {
+			return wrapError(err, 480, "could not get root of the ballots")
+		}
+		t.BallotsRoot = root
+	}
+
+	if err := setElectionState(db, t); err != nil {
+		return wrapError(err, 270, "could not set election state")
+	}
+
+	if err := insertElectionTransition(db, t); err != nil {
+		return wrapError(err, 271, "could not insert election transition")
+	}
+
+	e.State, e.StateChangedAt = to, t.At
+	e.setElectionFlags()
+	return nil
+}
+
+// extendVoting moves the end of an election that is voting, or suspended, to a later time; the extension is recorded
+// as a transition that keeps the state
+func extendVoting(db *sql.Tx, e *Election, end time.Time, userID int, reason string) error {
+	if e.State != ELECTION_VOTING && e.State != ELECTION_SUSPENDED {
+		return traceError{id: 298, message: fmt.Sprintf("election cannot be extended while %s", e.State)}
+	}
+
+	if !end.After(e.End) {
+		return traceError{id: 299, message: "election should end later than before"}
+	}
+
+	if e.ResultsEmbargo != nil && e.ResultsEmbargo.Before(end) {
+		return traceError{id: 300, message: "results embargo should not be before the election ends"}
+	}
+
+	if err := setElectionEnd(db, e.ID, end); err != nil {
+		return wrapError(err, 301, "could not set election end")
+	}
+
+	t := ElectionTransition{ElectionID: e.ID, From: e.State, To: e.State, At: now(), UserID: userID, Reason: reason}
+	if err := insertElectionTransition(db, t); err != nil {
+		return wrapError(err, 302, "could not insert election transition")
+	}
+
+	e.End = end
+	return nil
+}
+
+// advanceElection makes the transitions that depend on time, counts the election once voting is closed, and
+// publishes its results once the embargo is over; an election in draft does not advance until an admin publishes it,
+// and a suspended one until an admin resumes or closes it
+func advanceElection(db *sql.Tx, e Election) error {
+	if e.State == ELECTION_NOMINATION && !now().Before(e.Start) {
+		if err := transitionElection(db, &e, ELECTION_REGISTRATION_CLOSED, 0, ""); err != nil {
+			return wrapError(err, 272, "could not close registration")
+		}
+	}
+
+	if e.State == ELECTION_REGISTRATION_CLOSED && !now().Before(e.Start) {
+		stored, err := sharesStored(db, e)
+		if err != nil {
+			return wrapError(err, 472, "could not check trustee shares")
+		}
+		if !stored {
+			if err := transitionElection(db, &e, ELECTION_VOTING, 0, ""); err != nil {
+				return wrapError(err, 273, "could not open voting")
+			}
+		}
+	}
+
+	if e.State == ELECTION_VOTING && now().After(e.End) {
+		if err := transitionElection(db, &e, ELECTION_CLOSED, 0, ""); err != nil {
+			return wrapError(err, 274, "could not close voting")
+		}
+	}
+
+	if e.State == ELECTION_CLOSED && (e.Results == nil || !e.Results.pendingTies()) {
+		if err := countElection(db, e, 0); err != nil {
+			return wrapError(err, 275, "could not count election")
+		}
+		counted, err := getElection(db, e.ID)
+		if err != nil {
+			return wrapError(err, 295, "could not get counted election")
+		}
+		e = counted
+	}
+
+	if e.State == ELECTION_COUNTED && e.ResultsEmbargo != nil && !now().Before(*e.ResultsEmbargo) {
+		if err := transitionElection(db, &e, ELECTION_RESULTS_PUBLISHED, 0, ""); err != nil {
+			return wrapError(err, 296, "could not publish results")
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"log"
 	"net/http"
 	"os"
@@ -20,11 +21,11 @@ var (
 	commitHash string
 
 	// TODO use this to manage secret https://diogomonica.com/2017/03/27/why-you-shouldnt-use-env-variables-for-secret-data/
-	store          = sessions.NewFilesystemStore(SESSIONS_FOLDER, []byte("my_secret"))
-	queryCount     uint64
-	globalTesting  bool
-	electionsCount sync.Mutex
-	requestMutex   sync.Mutex
+	store            = sessions.NewFilesystemStore(SESSIONS_FOLDER, []byte("my_secret"))
+	queryCount       uint64
+	globalTesting    bool
+	electionsAdvance sync.Mutex
+	requestMutex     sync.Mutex
 
 	idParams = par.P("query").Int("id", par.PositiveInt).End()
 	noParams = par.None()
@@ -40,11 +41,36 @@ var (
 				String("name", par.NonEmpty).
 				Time("start", par.NonZeroTime).
 				Time("end", par.NonZeroTime).
+				String("ballot_type", par.StringIn(BALLOT_TYPES)).Default("ballot_type", BALLOT_RANKED).
 				String("count_method", par.StringIn(COUNT_METHODS)).
 				Int("min_candidates", par.PositiveInt).
 				Int("max_candidates", par.PositiveInt).
+				Int("seats", par.PositiveInt).Default("seats", 1).
+				Int("max_score", par.PositiveInt).Default("max_score", DEFAULT_MAX_SCORE).
+				StringList("grades", par.ListMinLength(2)).Default("grades", DEFAULT_GRADES).
+				Float("threshold").Default("threshold", 0.0).
+				String("truncation", par.StringIn(TRUNCATIONS)).Default("truncation", TRUNCATION_STANDARD).
+				String("tie_break", par.StringIn(TIE_BREAKS)).Default("tie_break", TIE_BREAK_FIRST_PREFERENCES).
+				Time("results_embargo").Default("results_embargo", time.Time{}).
+				Bool("allow_recast").Default("allow_recast", false).
+				Bool("blind_signatures").Default("blind_signatures", false).
+				Bool("encrypted").Default("encrypted", false).
+				IntList("trustees").Default("trustees", []int{}).
+				Int("quorum").Default("quorum", 0).
 				ValidateFunc(validateElectionParams)
 
+	createElectionParams = electionParamsAux.End()
+	updateElectionParams = electionParamsAux.Copy().Int("id", par.PositiveInt).End()
+
+	cloneElectionParams = par.P("json").
+				Int("id", par.PositiveInt).
+				String("name", par.NonEmpty).
+				Time("start", par.NonZeroTime).
+				Time("end", par.NonZeroTime).
+				ValidateFunc(validateElectionDates).End()
+
+	electionQueryParams = par.P("query").Int("election_id", par.PositiveInt).End()
+
 	globalConfigParamsAux = par.P("json").
 				StringList("id_formats", par.ListMinLength(1), par.StringsIn(ID_FORMATS))
 
@@ -71,50 +97,145 @@ var (
 				String("content", par.NonEmpty).End()
 
 	addCandidateParams = par.P("form").
+				Int("election_id", par.PositiveInt).
 				File("image").
 				String("name", par.NonEmpty).
 				String("presentation", par.NonEmpty).End()
 
-	voteParams = par.P("json").
-			IntList("candidates").End()
+	voteParamsAux = par.P("json").
+			Int("election_id", par.PositiveInt).
+			IntList("candidates").Default("candidates", []int{}).
+			IntMap("scores").Default("scores", map[int]int{}).
+			IntMap("ranks").Default("ranks", map[int]int{}).
+			Int("list", par.PositiveInt).Default("list", 0).
+			IntMap("answers").Default("answers", map[int]int{}).
+			Bool("blank").Default("blank", false).
+			RawJSON("encrypted").Default("encrypted", json.RawMessage(nil))
+
+	voteParams          = voteParamsAux.Copy().String("slot").Default("slot", "").End()
+	anonymousVoteParams = voteParamsAux.Copy().
+				String("credential", par.MinLength(MIN_CREDENTIAL_LENGTH)).
+				String("signature", par.NonEmpty).End()
+
+	signCredentialParams = par.P("json").
+				Int("election_id", par.PositiveInt).
+				String("blinded", par.NonEmpty).End()
+
+	electionJSONParams = par.P("json").Int("election_id", par.PositiveInt).End()
+
+	partialDecryptionParams = par.P("json").
+				Int("election_id", par.PositiveInt).
+				IntStringMap("partials").
+				RawJSON("proofs").End()
+
+	addListParams = par.P("json").
+			Int("election_id", par.PositiveInt).
+			String("name", par.NonEmpty).End()
+
+	addQuestionParams = par.P("json").
+				Int("election_id", par.PositiveInt).
+				String("prompt", par.NonEmpty).
+				StringList("options", par.ListMinLength(2)).Default("options", DEFAULT_QUESTION_OPTIONS).End()
+
+	listCandidatesParams = par.P("json").
+				Int("id", par.PositiveInt).
+				IntList("candidates").End()
+
+	transitionElectionParams = par.P("json").
+					Int("id", par.PositiveInt).
+					String("state", par.StringIn(ADMIN_ELECTION_STATES)).End()
+
+	votingChangeParams = par.P("json").
+				Int("id", par.PositiveInt).
+				String("reason", par.NonEmpty).End()
+
+	extendVotingParams = par.P("json").
+				Int("id", par.PositiveInt).
+				Time("end", par.NonZeroTime).
+				String("reason", par.NonEmpty).End()
+
+	resolveTieParams = par.P("json").
+				Int("id", par.PositiveInt).
+				IntList("candidates").End()
 
 	checkVoteParams = par.P("json").
 			String("token", par.NonEmpty).End()
 
+	verifySignatureParams = par.P("json").
+				String("kind", par.StringIn(SIGNATURES)).
+				String("receipt").Default("receipt", "").
+				String("ballot").Default("ballot", "").
+				String("document").Default("document", ""). // as it was signed, byte for byte
+				String("signature", par.NonEmpty).End()
+
 	appHandlers = map[string]func(http.ResponseWriter, *http.Request){
 		"/uninitialized": handler(noParams, noLogin, Uninitialized),
-		"/initialize":    handler(initializeParams, noLogin, Initialize),
-		"/config/update": handler(globalConfigParamsAux.End(), authFuncs(requireLogin, adminUser), UpdateConfig),
+		"/initialize":    handler(initializeParams, noLogin, audited("initialize", Initialize, "admin")),
+		"/config/update": handler(globalConfigParamsAux.End(), authFuncs(requireLogin, adminUser), audited("update_config", UpdateConfig)),
+		"/audit/get":     handler(noParams, authFuncs(requireLogin, adminOrAuditorUser), GetAuditLog),
+
+		"/signatures/key":    handler(noParams, noLogin, GetServerKey),
+		"/signatures/verify": handler(verifySignatureParams, noLogin, VerifySignature),
 
-		"/auth/register": handler(registerParams, authFuncs(noLogin, validIDFormats), Register),
+		"/auth/register": handler(registerParams, authFuncs(noLogin, validIDFormats), audited("register", Register, "password")),
 		"/auth/login":    handler(loginParams, noLogin, Login),
 		"/auth/logout":   handler(noParams, noLogin, Logout),
 
 		"/users/whoami":         handler(noParams, requireLogin, GetSelf),
 		"/users/files/own":      handler(noParams, requireLogin, GetOwnFiles),
-		"/users/files/delete":   handler(idParams, authFuncs(requireLogin, fileOwnerOrAdminUser), DeleteFile),
+		"/users/files/delete":   handler(idParams, authFuncs(requireLogin, fileOwnerOrAdminUser), audited("delete_file", DeleteFile)),
 		"/users/files/download": handler(idParams, authFuncs(requireLogin, fileOwnerOrAdminUser), DownloadFile),
-		"/users/files/upload":   handler(uploadFileParams, requireLogin, UploadFile),
+		"/users/files/upload":   handler(uploadFileParams, requireLogin, audited("upload_file", UploadFile)),
 
 		"/users/unvalidated/get": handler(userListParams, authFuncs(requireLogin, adminUser), GetUnvalidatedUsers),
 		"/users/validated/get":   handler(userListParams, authFuncs(requireLogin, adminUser), GetValidatedUsers),
-		"/users/messages/add":    handler(addMessageParams, authFuncs(requireLogin, adminUser), AddMessage),
+		"/users/messages/add":    handler(addMessageParams, authFuncs(requireLogin, adminUser), audited("add_message", AddMessage)),
 		"/users/messages/own":    handler(noParams, requireLogin, GetOwnMessages),
-		"/users/messages/solve":  handler(idParams, authFuncs(requireLogin, messageOwnerOrAdminUser), SolveMessage),
+		"/users/messages/solve":  handler(idParams, authFuncs(requireLogin, messageOwnerOrAdminUser), audited("solve_message", SolveMessage)),
 		// TODO push notification on validation
-		"/users/validate": handler(idParams, authFuncs(requireLogin, adminUser), ValidateUser),
+		"/users/validate": handler(idParams, authFuncs(requireLogin, adminUser), audited("validate_user", ValidateUser)),
+		"/users/auditor":  handler(idParams, authFuncs(requireLogin, adminUser), audited("make_auditor", MakeAuditor)),
 
-		"/candidates/get":    handler(noParams, noLogin, GetCandidates),
+		"/candidates/get":    handler(electionQueryParams, noLogin, GetCandidates),
 		"/candidates/image":  handler(idParams, noLogin, GetCandidateImage),
-		"/candidates/add":    handler(addCandidateParams, authFuncs(requireLogin, adminUser, electionDidNotStart), AddCandidate),
-		"/candidates/delete": handler(idParams, authFuncs(requireLogin, adminUser, electionDidNotStart), DeleteCandidate),
-
-		"/elections/get":        handler(noParams, noLogin, GetElections),
-		"/elections/check":      handler(noParams, noLogin, CheckElections),
-		"/elections/publish":    handler(idParams, authFuncs(requireLogin, adminUser), PublishElection),
-		"/elections/vote":       handler(voteParams, authFuncs(requireLogin, validatedUser), CastVote),
-		"/elections/vote/check": handler(checkVoteParams, noLogin, CheckVote),
-		// TODO implement /elections/update, test only valid params are accepted
+		"/candidates/add":    handler(addCandidateParams, authFuncs(requireLogin, adminUser, electionEditable(electionParam("election_id"))), audited("add_candidate", AddCandidate)),
+		"/candidates/delete": handler(idParams, authFuncs(requireLogin, adminUser, electionEditable(candidateElection)), audited("delete_candidate", DeleteCandidate)),
+
+		"/lists/get":        handler(electionQueryParams, noLogin, GetLists),
+		"/lists/add":        handler(addListParams, authFuncs(requireLogin, adminUser, electionEditable(electionParam("election_id"))), audited("add_list", AddList)),
+		"/lists/delete":     handler(idParams, authFuncs(requireLogin, adminUser, electionEditable(listElection)), audited("delete_list", DeleteList)),
+		"/lists/candidates": handler(listCandidatesParams, authFuncs(requireLogin, adminUser, electionEditable(listElection)), audited("set_list_candidates", SetListCandidates)),
+
+		"/questions/get":    handler(electionQueryParams, noLogin, GetQuestions),
+		"/questions/add":    handler(addQuestionParams, authFuncs(requireLogin, adminUser, electionEditable(electionParam("election_id"))), audited("add_question", AddQuestion)),
+		"/questions/delete": handler(idParams, authFuncs(requireLogin, adminUser, electionEditable(questionElection)), audited("delete_question", DeleteQuestion)),
+
+		"/elections/get":              handler(noParams, noLogin, GetElections),
+		"/elections/create":           handler(createElectionParams, authFuncs(requireLogin, adminUser), audited("create_election", CreateElection)),
+		"/elections/update":           handler(updateElectionParams, authFuncs(requireLogin, adminUser, electionEditable(electionParam("id"))), audited("update_election", UpdateElection)),
+		"/elections/delete":           handler(idParams, authFuncs(requireLogin, adminUser), audited("delete_election", DeleteElection)),
+		"/elections/clone":            handler(cloneElectionParams, authFuncs(requireLogin, adminUser), audited("clone_election", CloneElection)),
+		"/elections/check":            handler(noParams, noLogin, CheckElections),
+		"/elections/publish":          handler(idParams, authFuncs(requireLogin, adminUser), audited("publish_election", PublishElection)),
+		"/elections/transition":       handler(transitionElectionParams, authFuncs(requireLogin, adminUser), audited("transition_election", TransitionElection)),
+		"/elections/transitions":      handler(idParams, authFuncs(requireLogin, adminUser), GetElectionTransitions),
+		"/elections/results/signed":   handler(electionQueryParams, noLogin, GetSignedResults),
+		"/elections/results/publish":  handler(idParams, authFuncs(requireLogin, adminUser), audited("publish_results", PublishResults)),
+		"/elections/voting/extend":    handler(extendVotingParams, authFuncs(requireLogin, adminUser), audited("extend_voting", ExtendVoting)),
+		"/elections/voting/suspend":   handler(votingChangeParams, authFuncs(requireLogin, adminUser), audited("suspend_voting", SuspendVoting)),
+		"/elections/voting/resume":    handler(votingChangeParams, authFuncs(requireLogin, adminUser), audited("resume_voting", ResumeVoting)),
+		"/elections/voting/close":     handler(votingChangeParams, authFuncs(requireLogin, adminUser), audited("close_voting", CloseVoting)),
+		"/elections/ties/resolve":     handler(resolveTieParams, authFuncs(requireLogin, adminUser), audited("resolve_tie", ResolveTie)),
+		"/elections/vote":             handler(voteParams, authFuncs(requireLogin, validatedUser), CastVote),
+		"/elections/vote/check":       handler(checkVoteParams, noLogin, CheckVote),
+		"/elections/vote/anonymous":   handler(anonymousVoteParams, noLogin, CastAnonymousVote),
+		"/elections/credentials/key":  handler(electionQueryParams, noLogin, GetBlindKey),
+		"/elections/credentials/sign": handler(signCredentialParams, authFuncs(requireLogin, validatedUser), SignCredential),
+		"/elections/ballots":          handler(electionQueryParams, noLogin, GetBulletinBoard),
+		"/elections/ballots/proof":    handler(checkVoteParams, noLogin, GetInclusionProof),
+		"/elections/trustees/share":   handler(electionJSONParams, requireLogin, audited("take_trustee_share", GetTrusteeShare)),
+		"/elections/tally":            handler(electionQueryParams, noLogin, GetEncryptedTally),
+		"/elections/tally/decrypt":    handler(partialDecryptionParams, requireLogin, audited("send_partial_decryption", SendPartialDecryption, "partials")),
 	}
 
 	initialized struct {
@@ -124,6 +245,28 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "recount" {
+		same, err := recount(os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatalln("Could not recount:", err)
+		}
+		if !same {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		intact, err := checkAudit(os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatalln("Could not check audit log:", err)
+		}
+		if !intact {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := bootstrap(); err != nil {
 		log.Fatalln("Could not bootstrap:", err)
 	}
@@ -148,9 +291,9 @@ func bootstrap() error {
 		return wrapError(err, 128, "error during database initialization")
 	}
 
-	count, err := countElections(tx)
+	count, err := countAdminUsers(tx) // elections can be deleted, so they do not tell whether it was initialized
 	if err != nil {
-		return wrapError(err, 129, "could not count elections in check initialized")
+		return wrapError(err, 129, "could not count admin users in check initialized")
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -176,7 +319,7 @@ func bootstrap() error {
 
 	http.Handle("/", http.FileServer(http.Dir("website")))
 
-	go periodicFunc(checkElectionsCount, time.Minute)
+	go periodicFunc(advanceElections, time.Minute)
 
 	return nil
 }
@@ -239,6 +382,7 @@ func handler(
 			http.Error(w, frontendError(err), http.StatusInternalServerError)
 			return
 		}
+		defer discardAfterCommit(tx)
 
 		user, err := getRequestUser(r, w, tx)
 		if err := authFunc(tx, user, params, err); err != nil { // auth func validates permissions too
@@ -259,7 +403,9 @@ func handler(
 			log.Printf("[%d] Error commiting transaction: %s.", n, err)
 			rollback(n, tx)
 			http.Error(w, frontendError(err), http.StatusInternalServerError)
+			return
 		}
+		committed(tx)
 	}
 }
 
@@ -269,6 +415,37 @@ func rollback(n uint64, tx *sql.Tx) {
 	}
 }
 
+// afterCommitFuncs holds, for each open transaction, what has to be done once it is committed
+var afterCommitFuncs = struct {
+	sync.Mutex
+	funcs map[*sql.Tx][]func()
+}{funcs: make(map[*sql.Tx][]func())}
+
+// afterCommit runs f once the transaction is committed, and never if it is rolled back; whoever begins the
+// transaction calls committed after committing it, and discardAfterCommit when done with it
+func afterCommit(tx *sql.Tx, f func()) {
+	afterCommitFuncs.Lock()
+	defer afterCommitFuncs.Unlock()
+	afterCommitFuncs.funcs[tx] = append(afterCommitFuncs.funcs[tx], f)
+}
+
+func committed(tx *sql.Tx) {
+	afterCommitFuncs.Lock()
+	funcs := afterCommitFuncs.funcs[tx]
+	delete(afterCommitFuncs.funcs, tx)
+	afterCommitFuncs.Unlock()
+
+	for _, f := range funcs {
+		f()
+	}
+}
+
+func discardAfterCommit(tx *sql.Tx) {
+	afterCommitFuncs.Lock()
+	defer afterCommitFuncs.Unlock()
+	delete(afterCommitFuncs.funcs, tx)
+}
+
 func authFuncs(fs ...func(*sql.Tx, *User, par.Values, error) error) func(*sql.Tx, *User, par.Values, error) error {
 	return func(db *sql.Tx, user *User, values par.Values, err error) error {
 		for _, f := range fs {
@@ -281,16 +458,16 @@ func authFuncs(fs ...func(*sql.Tx, *User, par.Values, error) error) func(*sql.Tx
 	}
 }
 
-func checkElectionsCount() {
-	electionsCount.Lock()
-	defer electionsCount.Unlock()
+func advanceElections() {
+	electionsAdvance.Lock()
+	defer electionsAdvance.Unlock()
 
-	if err := checkElectionsCountAux(); err != nil {
-		log.Printf("Error during checkElectionsCount: %s\n", err)
+	if err := advanceElectionsAux(); err != nil {
+		log.Printf("Error during advanceElections: %s\n", err)
 	}
 }
 
-func checkElectionsCountAux() error {
+func advanceElectionsAux() error {
 	db, err := sql.Open("sqlite3", DB_FILE)
 	if err != nil {
 		return wrapError(err, 132, "could not open connection to db")
@@ -301,6 +478,7 @@ func checkElectionsCountAux() error {
 	if err != nil {
 		return wrapError(err, 133, "could not begin transaction")
 	}
+	defer discardAfterCommit(tx)
 
 	elections, err := getElections(tx, true)
 	if err != nil {
@@ -309,11 +487,9 @@ func checkElectionsCountAux() error {
 	}
 
 	for _, e := range elections {
-		if now().After(e.End) && !e.Counted {
-			if err := countElection(tx, e); err != nil {
-				tx.Rollback()
-				return wrapError(err, 135, "could not count election %d", e.ID)
-			}
+		if err := advanceElection(tx, e); err != nil {
+			tx.Rollback()
+			return wrapError(err, 135, "could not advance election %d", e.ID)
 		}
 	}
 
@@ -321,34 +497,80 @@ func checkElectionsCountAux() error {
 		tx.Rollback()
 		return wrapError(err, 136, "could not commit transaction")
 	}
+	committed(tx)
 
 	return nil
 }
 
-func countElection(tx *sql.Tx, e Election) error {
-	vs, err := getVotes(tx, e.ID)
+// countElection stores the results of the election, and moves it to counted unless there are ties for the admin to
+// settle; userID is the admin that settled the last tie, or zero for the scheduler
+func countElection(tx *sql.Tx, e Election, userID int) error {
+	votes, err := getVotes(tx, e.ID)
 	if err != nil {
 		return wrapError(err, 137, "could not get votes")
 	}
 
-	votes := make([][]int, 0, len(vs))
-	for _, v := range vs {
-		votes = append(votes, v.Candidates)
+	var results CountResults
+	if e.Encrypted {
+		var marks map[int]int
+		var decrypted bool
+		marks, decrypted, err = decryptTally(tx, e, votes)
+		if err != nil {
+			return wrapError(err, 390, "could not decrypt tally")
+		}
+		if !decrypted {
+			return nil // waiting for a quorum of trustees
+		}
+		results, err = countTally(e, votes, marks)
+	} else {
+		results, err = countVotes(e, votes)
 	}
-
-	results, err := countVotes(e.Candidates, votes, e.CountMethod)
 	if err != nil {
 		return wrapError(err, 138, "could not count votes")
 	}
 
-	for candidateID, points := range results {
+	electorate, err := countValidatedUsers(tx)
+	if err != nil {
+		return wrapError(err, 268, "could not count validated users")
+	}
+	results.setTurnout(electorate)
+
+	if results.pendingTies() {
+		// keep the results so the admin can see the ties, and count again once they are settled
+		if err := setElectionResults(tx, e.ID, results); err != nil {
+			return wrapError(err, 185, "could not set results with pending ties for election %d", e.ID)
+		}
+		return nil
+	}
+
+	for candidateID, points := range results.Points {
 		if err := updateCandidatePoints(tx, candidateID, points); err != nil {
 			return wrapError(err, 139, "could not update points for candidate %d", candidateID)
 		}
 	}
 
-	if err := setElectionCounted(tx, e.ID); err != nil {
-		return wrapError(err, 140, "could not set election %d as counted", e.ID)
+	for listID, seats := range results.ListSeats {
+		if err := updateListResults(tx, listID, results.ListVotes[listID], seats); err != nil {
+			return wrapError(err, 166, "could not update results for list %d", listID)
+		}
+	}
+
+	for questionID, votes := range results.QuestionVotes {
+		if err := updateQuestionVotes(tx, questionID, votes); err != nil {
+			return wrapError(err, 266, "could not update votes for question %d", questionID)
+		}
+	}
+
+	if err := setElectionResults(tx, e.ID, results); err != nil {
+		return wrapError(err, 140, "could not set results of election %d", e.ID)
+	}
+
+	if err := signResults(tx, e, results); err != nil {
+		return wrapError(err, 456, "could not sign results of election %d", e.ID)
+	}
+
+	if err := transitionElection(tx, &e, ELECTION_COUNTED, userID, ""); err != nil {
+		return wrapError(err, 280, "could not set election %d as counted", e.ID)
 	}
 
 	return nil
@@ -2,20 +2,27 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/oriolf/bella-ciao/verifier"
 )
 
 type testOptions struct {
@@ -27,6 +34,8 @@ type testOptions struct {
 	resCookies *[]*http.Cookie
 	candidate  Candidate
 	voteToken  *string
+	voteSlot   *string
+	response   interface{} // unmarshalled from the response body, for checks done afterwards
 
 	file                     expectedFile
 	fileContent              string
@@ -36,6 +45,17 @@ type testOptions struct {
 	expectedUnsolvedMessages []string
 	expectedCandidates       []Candidate
 	expectedElections        []Election
+	expectedLists            []CandidateList
+	expectedQuestions        []Question
+	expectedVote             expectedVote
+	expectedTransitions      []ElectionTransition
+}
+
+type expectedVote struct {
+	candidates []Candidate
+	blank      bool
+	superseded bool
+	answers    []string
 }
 
 type expectedUsersResponse struct {
@@ -47,6 +67,7 @@ type expectedUser struct {
 	uniqueID         string
 	role             string
 	unsolvedMessages []string
+	votedElections   []int
 }
 
 type expectedFile struct {
@@ -111,8 +132,15 @@ func TestAPI(t *testing.T) {
 	t.Run("Empty site cannot be initialized with wrong parameters",
 		testEndpoint("/initialize", 400, to{method: "POST", params: m{"admin": admin, "election": election, "config": appConfig}}))
 
+	// count method that does not match the ballot type
+	election = newElection("election", COUNT_BORDA, electionStart, electionEnd, 2, 3)
+	election.BallotType = BALLOT_APPROVAL
+	t.Run("Empty site cannot be initialized with wrong parameters",
+		testEndpoint("/initialize", 400, to{method: "POST", params: m{"admin": admin, "election": election, "config": appConfig}}))
+
 	// empty id formats list
 	election = newElection("election", COUNT_BORDA, electionStart, electionEnd, 2, 3)
+	election.TieBreak = TIE_BREAK_MANUAL // its only tie decides no seat, so it should be counted anyway
 	t.Run("Empty site cannot be initialized with wrong parameters",
 		testEndpoint("/initialize", 400, to{method: "POST", params: m{"admin": admin, "election": election, "config": m{"id_formats": []string{}}}}))
 
@@ -301,9 +329,9 @@ func TestAPI(t *testing.T) {
 		testEndpoint("/users/validated/get", 200, to{cookies: cookies1, query: "?page=1&items_per_page=5", expectedUsers: expectedUsersResponse{Total: 2, Users: []expectedUser{
 			{uniqueID: uniqueID1}, {uniqueID: uniqueID2, unsolvedMessages: []string{"message content user 2"}}}}}))
 
-	candidate1 := Candidate{Name: "candidate 1", Presentation: "candidate 1 presentation", Image: "candidate.jpg"}
-	candidate2 := Candidate{Name: "candidate 2", Presentation: "candidate 2 presentation", Image: "candidate.jpg"}
-	candidateWrong := Candidate{Name: "", Presentation: "candidate wrong presentation", Image: "candidate.jpg"}
+	candidate1 := Candidate{ElectionID: 1, Name: "candidate 1", Presentation: "candidate 1 presentation", Image: "candidate.jpg"}
+	candidate2 := Candidate{ElectionID: 1, Name: "candidate 2", Presentation: "candidate 2 presentation", Image: "candidate.jpg"}
+	candidateWrong := Candidate{ElectionID: 1, Name: "", Presentation: "candidate wrong presentation", Image: "candidate.jpg"}
 
 	t.Run("Non-logged users should not be able to add candidates",
 		testEndpoint("/candidates/add", 401, to{candidate: candidate1}))
@@ -318,9 +346,9 @@ func TestAPI(t *testing.T) {
 
 	candidate2.Image = "candidate_1.jpg"
 	t.Run("Non-logged users should be able to get candidates",
-		testEndpoint("/candidates/get", 200, to{expectedCandidates: []Candidate{candidate1, candidate2}}))
+		testEndpoint("/candidates/get", 200, to{query: "?election_id=1", expectedCandidates: []Candidate{candidate1, candidate2}}))
 	t.Run("Logged users should be able to get candidates",
-		testEndpoint("/candidates/get", 200, to{cookies: cookies2, expectedCandidates: []Candidate{candidate1, candidate2}}))
+		testEndpoint("/candidates/get", 200, to{cookies: cookies2, query: "?election_id=1", expectedCandidates: []Candidate{candidate1, candidate2}}))
 	t.Run("Candidate images should appear in uploads folder", checkUploadsFolder([]string{"testfile.txt", "testfile_2.txt", "candidate.jpg", "candidate_1.jpg"}))
 
 	t.Run("Non-logged users should not be able to delete candidates",
@@ -331,11 +359,27 @@ func TestAPI(t *testing.T) {
 		testEndpoint("/candidates/delete", 200, to{cookies: cookies1, query: "?id=2"}))
 
 	t.Run("Deleted candidate should not appear anymore",
-		testEndpoint("/candidates/get", 200, to{expectedCandidates: []Candidate{candidate1}}))
+		testEndpoint("/candidates/get", 200, to{query: "?election_id=1", expectedCandidates: []Candidate{candidate1}}))
 	t.Run("Deleted candidate image should not appear anymore", checkUploadsFolder([]string{"testfile.txt", "testfile_2.txt", "candidate.jpg"}))
 
+	t.Run("Non-admin users should not be able to add lists",
+		testEndpoint("/lists/add", 401, to{cookies: cookies2, params: m{"election_id": 1, "name": "list 1"}}))
+	t.Run("Admin users should be able to add lists",
+		testEndpoint("/lists/add", 200, to{cookies: cookies1, params: m{"election_id": 1, "name": "list 1"}}))
+	t.Run("Admin users should be able to set the candidates of a list",
+		testEndpoint("/lists/candidates", 200, to{cookies: cookies1, params: m{"id": 1, "candidates": []int{1}}}))
+	t.Run("Admin users should not be able to add unexisting candidates to a list",
+		testEndpoint("/lists/candidates", 500, to{cookies: cookies1, params: m{"id": 1, "candidates": []int{1, 2}}}))
+	t.Run("Admin users should not be able to repeat candidates in a list",
+		testEndpoint("/lists/candidates", 500, to{cookies: cookies1, params: m{"id": 1, "candidates": []int{1, 1}}}))
+	t.Run("Non-logged users should be able to get lists",
+		testEndpoint("/lists/get", 200, to{query: "?election_id=1", expectedLists: []CandidateList{{ID: 1, ElectionID: 1, Name: "list 1", Candidates: []int{1}}}}))
+	t.Run("Admin users should be able to delete lists",
+		testEndpoint("/lists/delete", 200, to{cookies: cookies1, query: "?id=1"}))
+	t.Run("Deleted lists should not appear anymore",
+		testEndpoint("/lists/get", 200, to{query: "?election_id=1", expectedLists: []CandidateList{}}))
+
 	candidate1.ID = 1
-	candidate1.ElectionID = 1
 	election.ID = 1
 	election.Candidates = []Candidate{candidate1}
 	t.Run("Non-logged user should be able to see any elections yet",
@@ -353,6 +397,7 @@ func TestAPI(t *testing.T) {
 		testEndpoint("/elections/publish", 200, to{cookies: cookies1, query: "?id=1"}))
 
 	election.Public = true
+	election.State, election.StateChangedAt = ELECTION_NOMINATION, now()
 	t.Run("Non-logged user should be able to see elections",
 		testEndpoint("/elections/get", 200, to{expectedElections: []Election{election}}))
 
@@ -381,8 +426,10 @@ func TestAPI(t *testing.T) {
 	election.Candidates = append(election.Candidates, candidate4)
 
 	t.Run("Admin user should not be able to vote before election start",
-		testEndpoint("/elections/vote", 500, to{cookies: cookies1, params: m{"candidates": []int{1, 4}}}))
+		testEndpoint("/elections/vote", 500, to{cookies: cookies1, params: m{"election_id": 1, "candidates": []int{1, 4}}}))
 	timeTravel(90 * time.Minute)
+	advanceElections()
+	election.State, election.StateChangedAt = ELECTION_VOTING, now()
 
 	t.Run("Candidates should not be added after election starts",
 		testEndpoint("/candidates/add", 401, to{cookies: cookies1, candidate: candidate1}))
@@ -391,50 +438,650 @@ func TestAPI(t *testing.T) {
 
 	var voteToken string
 	t.Run("Admin user should be able to vote in time",
-		testEndpoint("/elections/vote", 200, to{cookies: cookies1, params: m{"candidates": []int{1, 4}}, voteToken: &voteToken}))
+		testEndpoint("/elections/vote", 200, to{cookies: cookies1, params: m{"election_id": 1, "candidates": []int{1, 4}}, voteToken: &voteToken}))
 	t.Run("Admin user should not be able to vote twice",
-		testEndpoint("/elections/vote", 500, to{cookies: cookies1, params: m{"candidates": []int{1, 4}}}))
+		testEndpoint("/elections/vote", 500, to{cookies: cookies1, params: m{"election_id": 1, "candidates": []int{1, 4}}}))
 	t.Run("Admin user should be able to validate its vote",
-		testEndpoint("/elections/vote/check", 200, to{params: m{"token": voteToken}, expectedCandidates: []Candidate{candidate1, candidate3}}))
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": voteToken}, expectedVote: expectedVote{candidates: []Candidate{candidate1, candidate3}, answers: []string{}}}))
 
 	t.Run("Unvalidated user should not be able to vote",
-		testEndpoint("/elections/vote", 401, to{cookies: cookies3, params: m{"candidates": []int{1, 4}}}))
+		testEndpoint("/elections/vote", 401, to{cookies: cookies3, params: m{"election_id": 1, "candidates": []int{1, 4}}}))
 	t.Run("Validated user should not be able to vote more than the maximum allowed candidates",
-		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"candidates": []int{1, 4, 5, 6}}}))
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 1, "candidates": []int{1, 4, 5, 6}}}))
 	t.Run("Validated user should not be able to vote less than the minimum allowed candidates",
-		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"candidates": []int{1}}}))
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 1, "candidates": []int{1}}}))
 	t.Run("Validated user should not be able to vote unexisting candidates",
-		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"candidates": []int{-1, -2}}}))
-
-	t.Run("Validated user should be able to vote just once", testVoteOnce(to{cookies: cookies2, params: m{"candidates": []int{3, 4}}}))
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 1, "candidates": []int{-1, -2}}}))
+	t.Run("Validated user should not be able to vote the same candidate twice",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 1, "candidates": []int{3, 3}}}))
+	t.Run("Validated user should not be able to rank candidates equally if the count method does not allow it",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 1, "ranks": map[int]int{3: 1, 4: 1}}}))
+
+	t.Run("Validated user should be able to vote just once", testVoteOnce(to{cookies: cookies2, params: m{"election_id": 1, "candidates": []int{3, 4}}}))
+	t.Run("User should see the elections in which has voted",
+		testEndpoint("/users/whoami", 200, to{cookies: cookies2, expectedUser: expectedUser{uniqueID: uniqueID2, role: ROLE_VALIDATED, votedElections: []int{1}}}))
+	t.Run("User should not see elections in which has not voted",
+		testEndpoint("/users/whoami", 200, to{cookies: cookies3, expectedUser: expectedUser{uniqueID: uniqueID3, role: ROLE_NONE, votedElections: []int{}}}))
+	t.Run("Admin user should see the elections in which validated users have voted",
+		testEndpoint("/users/validated/get", 200, to{cookies: cookies1, query: "?page=1&items_per_page=5", expectedUsers: expectedUsersResponse{Total: 2, Users: []expectedUser{
+			{uniqueID: uniqueID1, votedElections: []int{1}}, {uniqueID: uniqueID2, unsolvedMessages: []string{"message content user 2"}, votedElections: []int{1}}}}}))
 
 	t.Run("Admin user should be able to validate users",
 		testEndpoint("/users/validate", 200, to{cookies: cookies1, query: "?id=3"}))
 	t.Run("Admin user should be able to validate users",
 		testEndpoint("/users/validate", 200, to{cookies: cookies1, query: "?id=4"})) // user with ID 4 has uniqueID5
 	t.Run("Two users should be able to vote concurrently", testVoteConcurrent(
-		to{cookies: cookies3, params: m{"candidates": []int{4, 5, 3}}},
-		to{cookies: cookies5, params: m{"candidates": []int{5, 1, 3}}}))
+		to{cookies: cookies3, params: m{"election_id": 1, "candidates": []int{4, 5, 3}}},
+		to{cookies: cookies5, params: m{"election_id": 1, "candidates": []int{5, 1, 3}}}))
 
 	// see that elections can have its votes counted
 	t.Run("The election should not have its votes counted yet",
 		testEndpoint("/elections/get", 200, to{cookies: cookies1, expectedElections: []Election{election}}))
-	checkElectionsCount()
+	advanceElections()
 	t.Run("The election should not have its votes counted yet",
 		testEndpoint("/elections/get", 200, to{cookies: cookies1, expectedElections: []Election{election}}))
 
 	timeTravel(60 * time.Minute) // election ended
-	checkElectionsCount()
+	advanceElections()
 	election.Counted = true
+	election.State, election.StateChangedAt = ELECTION_COUNTED, now()
+	election.Results = &CountResults{
+		Ballots:    4,
+		Electorate: 4,
+		Turnout:    100,
+		Truncation: TRUNCATION_STANDARD,
+		Elected:    []int{4},
+		// candidates 1 and 5 have the same points, but the tie is below the only seat, so the admin does not need to
+		// settle it and they keep the order of their ids
+		Ranking: []int{4, 3, 1, 5},
+	}
 	election.Candidates[0].Points = 7
 	election.Candidates[1].Points = 8
 	election.Candidates[2].Points = 10
 	election.Candidates[3].Points = 7
 	t.Run("The election should have its votes counted",
 		testEndpoint("/elections/get", 200, to{cookies: cookies1, expectedElections: []Election{election}}))
-	checkElectionsCount()
+	advanceElections()
 	t.Run("The election should have its votes counted",
 		testEndpoint("/elections/get", 200, to{cookies: cookies1, expectedElections: []Election{election}}))
+	t.Run("Non-admin user should not see results that are not published",
+		testEndpoint("/elections/get", 200, to{cookies: cookies2, expectedElections: []Election{withoutResults(election)}}))
+	t.Run("Candidates should not show points that are not published",
+		testEndpoint("/candidates/get", 200, to{query: "?election_id=1", expectedCandidates: withoutResults(election).Candidates}))
+	t.Run("Non-admin user should not be able to make auditors",
+		testEndpoint("/users/auditor", 401, to{cookies: cookies2, query: "?id=3"}))
+	t.Run("Admin user should be able to make auditors",
+		testEndpoint("/users/auditor", 200, to{cookies: cookies1, query: "?id=3"}))
+	t.Run("Auditor user should see results that are not published",
+		testEndpoint("/elections/get", 200, to{cookies: cookies3, expectedElections: []Election{election}}))
+
+	t.Run("Recounting the election should give the same results", testRecount([]string{"-election", "1"}, true))
+	t.Run("Recounting all the counted elections should give the same results", testRecount(nil, true))
+	t.Run("Recounting with another method should give different results", testRecount([]string{"-method", COUNT_DOWDALL}, false))
+
+	// manage more elections
+	election2 := newElection("election 2", COUNT_BORDA, now().Add(1*time.Hour), now().Add(2*time.Hour), 1, 2)
+	election2.AllowRecast = true
+	embargo := now().Add(1 * time.Hour)
+	election2.ResultsEmbargo = &embargo
+	t.Run("Admin user should not be able to create elections with an embargo before they end",
+		testEndpoint("/elections/create", 400, to{cookies: cookies1, params: election2}))
+	embargo = now().Add(3 * time.Hour)
+	t.Run("Non-admin user should not be able to create elections",
+		testEndpoint("/elections/create", 401, to{cookies: cookies2, params: election2}))
+	election2.MinCandidates = 3
+	t.Run("Admin user should not be able to create elections with invalid parameters",
+		testEndpoint("/elections/create", 400, to{cookies: cookies1, params: election2}))
+	election2.MinCandidates = 1
+	t.Run("Admin user should be able to create elections",
+		testEndpoint("/elections/create", 200, to{cookies: cookies1, params: election2}))
+
+	election2.ID = 2
+	election2.Name = "election 2 updated"
+	election2.CountMethod = COUNT_DOWDALL
+	t.Run("Non-admin user should not be able to update elections",
+		testEndpoint("/elections/update", 401, to{cookies: cookies2, params: election2}))
+	t.Run("Admin user should be able to update elections that did not start",
+		testEndpoint("/elections/update", 200, to{cookies: cookies1, params: election2}))
+	startedElection := election2
+	startedElection.ID = 1
+	t.Run("Admin user should not be able to update elections that started",
+		testEndpoint("/elections/update", 401, to{cookies: cookies1, params: startedElection}))
+	t.Run("Admin user should see the updated election",
+		testEndpoint("/elections/get", 200, to{cookies: cookies1, expectedElections: []Election{election, election2}}))
+
+	cloneParams := m{"id": 1, "name": "election 3", "start": now().Add(1 * time.Hour), "end": now().Add(2 * time.Hour)}
+	t.Run("Non-admin user should not be able to clone elections",
+		testEndpoint("/elections/clone", 401, to{cookies: cookies2, params: cloneParams}))
+	t.Run("Admin user should be able to clone elections",
+		testEndpoint("/elections/clone", 200, to{cookies: cookies1, params: cloneParams}))
+	clonedCandidates := make([]Candidate, 0, len(election.Candidates))
+	for _, c := range election.Candidates {
+		clonedCandidates = append(clonedCandidates, Candidate{Name: c.Name, Presentation: c.Presentation, Image: strings.Replace(c.Image, ".jpg", "_1.jpg", 1)})
+	}
+	clonedCandidates[0].Image = "candidate_4.jpg"
+	t.Run("Cloned election should have copies of the candidates",
+		testEndpoint("/candidates/get", 200, to{query: "?election_id=3", expectedCandidates: clonedCandidates}))
+	t.Run("Cloned candidate images should appear in uploads folder", checkUploadsFolder([]string{"testfile.txt", "testfile_2.txt",
+		"candidate.jpg", "candidate_1.jpg", "candidate_2.jpg", "candidate_3.jpg",
+		"candidate_4.jpg", "candidate_1_1.jpg", "candidate_2_1.jpg", "candidate_3_1.jpg"}))
+
+	t.Run("Non-admin user should not be able to delete elections",
+		testEndpoint("/elections/delete", 401, to{cookies: cookies2, query: "?id=3"}))
+	t.Run("Admin user should be able to delete elections",
+		testEndpoint("/elections/delete", 200, to{cookies: cookies1, query: "?id=3"}))
+	t.Run("Deleted election should not have candidates",
+		testEndpoint("/candidates/get", 200, to{query: "?election_id=3", expectedCandidates: []Candidate{}}))
+	t.Run("Deleted election candidate images should not appear anymore", checkUploadsFolder([]string{"testfile.txt", "testfile_2.txt",
+		"candidate.jpg", "candidate_1.jpg", "candidate_2.jpg", "candidate_3.jpg"}))
+
+	candidate5 := Candidate{ElectionID: 2, Name: "candidate 5", Presentation: "candidate 5 presentation", Image: "candidate.jpg"}
+	t.Run("Admin users should be able to add candidates to other elections",
+		testEndpoint("/candidates/add", 200, to{cookies: cookies1, candidate: candidate5}))
+	candidate5.Image = "candidate_4.jpg"
+	t.Run("Non-admin users should not be able to add questions",
+		testEndpoint("/questions/add", 401, to{cookies: cookies2, params: m{"election_id": 2, "prompt": "approve the statutes?"}}))
+	t.Run("Admin users should not be able to add questions with less than two options",
+		testEndpoint("/questions/add", 400, to{cookies: cookies1, params: m{"election_id": 2, "prompt": "approve the statutes?", "options": []string{"yes"}}}))
+	t.Run("Admin users should be able to add questions",
+		testEndpoint("/questions/add", 200, to{cookies: cookies1, params: m{"election_id": 2, "prompt": "approve the statutes?"}}))
+	t.Run("Admin users should be able to add questions with their own options",
+		testEndpoint("/questions/add", 200, to{cookies: cookies1, params: m{"election_id": 2, "prompt": "meeting day?", "options": []string{"monday", "friday"}}}))
+	t.Run("Admin users should be able to add questions",
+		testEndpoint("/questions/add", 200, to{cookies: cookies1, params: m{"election_id": 2, "prompt": "question to delete"}}))
+	t.Run("Admin users should be able to delete questions",
+		testEndpoint("/questions/delete", 200, to{cookies: cookies1, query: "?id=3"}))
+	question1 := Question{ID: 1, ElectionID: 2, Prompt: "approve the statutes?", Options: DEFAULT_QUESTION_OPTIONS, Votes: []int{}}
+	question2 := Question{ID: 2, ElectionID: 2, Prompt: "meeting day?", Options: []string{"monday", "friday"}, Votes: []int{}}
+	t.Run("Users should see the questions of an election",
+		testEndpoint("/questions/get", 200, to{query: "?election_id=2", expectedQuestions: []Question{question1, question2}}))
+
+	t.Run("Admin user should be able to publish other elections",
+		testEndpoint("/elections/publish", 200, to{cookies: cookies1, query: "?id=2"}))
+	t.Run("Admin user should not be able to publish elections twice",
+		testEndpoint("/elections/publish", 500, to{cookies: cookies1, query: "?id=2"}))
+	t.Run("Admin user should not be able to skip states of an election",
+		testEndpoint("/elections/transition", 500, to{cookies: cookies1, params: m{"id": 2, "state": ELECTION_ARCHIVED}}))
+	t.Run("Admin user should not be able to publish results of elections not counted",
+		testEndpoint("/elections/results/publish", 500, to{cookies: cookies1, query: "?id=2"}))
+	t.Run("Admin user should not be able to move elections to states driven by time",
+		testEndpoint("/elections/transition", 400, to{cookies: cookies1, params: m{"id": 2, "state": ELECTION_VOTING}}))
+	t.Run("Non-admin user should not be able to close the registration of candidates",
+		testEndpoint("/elections/transition", 401, to{cookies: cookies2, params: m{"id": 2, "state": ELECTION_REGISTRATION_CLOSED}}))
+	t.Run("Admin user should be able to close the registration of candidates before the election starts",
+		testEndpoint("/elections/transition", 200, to{cookies: cookies1, params: m{"id": 2, "state": ELECTION_REGISTRATION_CLOSED}}))
+	t.Run("Questions should not be added after the registration is closed",
+		testEndpoint("/questions/add", 401, to{cookies: cookies1, params: m{"election_id": 2, "prompt": "late question"}}))
+
+	timeTravel(90 * time.Minute)
+	advanceElections()
+	t.Run("Admin user should not be able to delete elections while voting is open",
+		testEndpoint("/elections/delete", 500, to{cookies: cookies1, query: "?id=2"}))
+	t.Run("Non-admin user should not be able to suspend voting",
+		testEndpoint("/elections/voting/suspend", 401, to{cookies: cookies2, params: m{"id": 2, "reason": "outage"}}))
+	t.Run("Admin user should not be able to suspend voting without a reason",
+		testEndpoint("/elections/voting/suspend", 400, to{cookies: cookies1, params: m{"id": 2, "reason": ""}}))
+	t.Run("Admin user should be able to suspend voting",
+		testEndpoint("/elections/voting/suspend", 200, to{cookies: cookies1, params: m{"id": 2, "reason": "outage"}}))
+	t.Run("Validated user should not be able to vote while voting is suspended",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 0, 2: 1}}}))
+	t.Run("Admin user should not be able to delete elections while voting is suspended",
+		testEndpoint("/elections/delete", 500, to{cookies: cookies1, query: "?id=2"}))
+	t.Run("Admin user should be able to resume voting",
+		testEndpoint("/elections/voting/resume", 200, to{cookies: cookies1, params: m{"id": 2, "reason": "outage solved"}}))
+	t.Run("Admin user should not be able to resume voting that is not suspended",
+		testEndpoint("/elections/voting/resume", 500, to{cookies: cookies1, params: m{"id": 2, "reason": "outage solved"}}))
+	t.Run("Admin user should not be able to extend voting past the results embargo",
+		testEndpoint("/elections/voting/extend", 500, to{cookies: cookies1, params: m{"id": 2, "end": now().Add(2 * time.Hour), "reason": "outage"}}))
+	t.Run("Admin user should not be able to shorten voting",
+		testEndpoint("/elections/voting/extend", 500, to{cookies: cookies1, params: m{"id": 2, "end": now().Add(15 * time.Minute), "reason": "outage"}}))
+	t.Run("Admin user should be able to extend voting",
+		testEndpoint("/elections/voting/extend", 200, to{cookies: cookies1, params: m{"id": 2, "end": now().Add(45 * time.Minute), "reason": "outage"}}))
+	t.Run("Validated user should not be able to vote without answering every question",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 0}}}))
+	t.Run("Validated user should not be able to vote answers out of the question options",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 0, 2: 2}}}))
+	var voteSlot, supersededToken string
+	var supersededReceipt castVote
+	t.Run("Validated user should be able to vote in another election",
+		testEndpoint("/elections/vote", 200, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 0, 2: 1}}, voteToken: &supersededToken, voteSlot: &voteSlot, response: &supersededReceipt}))
+	t.Run("Validated user should not be able to vote twice without the slot credential",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 0, 2: 1}}}))
+	t.Run("Validated user should not be able to vote twice with a wrong slot credential",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 0, 2: 1}, "slot": supersededToken}}))
+	t.Run("Validated user should be able to validate its answers",
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": supersededToken}, expectedVote: expectedVote{candidates: []Candidate{candidate5}, answers: []string{"yes", "friday"}}}))
+	t.Run("Validated user should be able to vote again with the slot credential",
+		testEndpoint("/elections/vote", 200, to{cookies: cookies2, params: m{"election_id": 2, "candidates": []int{10}, "answers": map[int]int{1: 1, 2: 1}, "slot": voteSlot}, voteToken: &voteToken}))
+	t.Run("Validated user should see its previous vote as superseded",
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": supersededToken}, expectedVote: expectedVote{candidates: []Candidate{candidate5}, superseded: true, answers: []string{"yes", "friday"}}}))
+	t.Run("Validated user should see its last vote",
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": voteToken}, expectedVote: expectedVote{candidates: []Candidate{candidate5}, answers: []string{"no", "friday"}}}))
+	t.Run("Validated user should not be able to vote candidates of another election",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies3, params: m{"election_id": 2, "candidates": []int{1}, "answers": map[int]int{1: 2, 2: 0}}}))
+	t.Run("Validated user should not be able to mark candidates in a blank vote",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies3, params: m{"election_id": 2, "blank": true, "candidates": []int{10}, "answers": map[int]int{1: 2, 2: 0}}}))
+	t.Run("Validated user should be able to vote blank, even if the election has a minimum of candidates",
+		testEndpoint("/elections/vote", 200, to{cookies: cookies3, params: m{"election_id": 2, "blank": true, "answers": map[int]int{1: 2, 2: 0}}, voteToken: &voteToken}))
+	t.Run("Validated user should be able to validate its blank vote",
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": voteToken}, expectedVote: expectedVote{blank: true, answers: []string{"abstain", "monday"}}}))
+	t.Run("User should see every election in which has voted",
+		testEndpoint("/users/whoami", 200, to{cookies: cookies2, expectedUser: expectedUser{uniqueID: uniqueID2, role: ROLE_VALIDATED, votedElections: []int{1, 2}}}))
+
+	t.Run("Admin user should be able to suspend voting again",
+		testEndpoint("/elections/voting/suspend", 200, to{cookies: cookies1, params: m{"id": 2, "reason": "irregularity"}}))
+
+	timeTravel(60 * time.Minute) // past the extended end
+	advanceElections()
+	t.Run("Suspended elections should not be counted",
+		testEndpoint("/questions/get", 200, to{cookies: cookies1, query: "?election_id=2", expectedQuestions: []Question{question1, question2}}))
+	t.Run("Admin user should not be able to close voting without a reason",
+		testEndpoint("/elections/voting/close", 400, to{cookies: cookies1, params: m{"id": 2}}))
+	t.Run("Admin user should be able to close suspended voting",
+		testEndpoint("/elections/voting/close", 200, to{cookies: cookies1, params: m{"id": 2, "reason": "irregularity dismissed"}}))
+	advanceElections()
+	t.Run("Admin user should see the reasons of the changes to the voting",
+		testEndpoint("/elections/transitions", 200, to{cookies: cookies1, query: "?id=2", expectedTransitions: []ElectionTransition{
+			{ElectionID: 2, From: ELECTION_DRAFT, To: ELECTION_NOMINATION, UserID: 1},
+			{ElectionID: 2, From: ELECTION_NOMINATION, To: ELECTION_REGISTRATION_CLOSED, UserID: 1},
+			{ElectionID: 2, From: ELECTION_REGISTRATION_CLOSED, To: ELECTION_VOTING},
+			{ElectionID: 2, From: ELECTION_VOTING, To: ELECTION_SUSPENDED, UserID: 1, Reason: "outage"},
+			{ElectionID: 2, From: ELECTION_SUSPENDED, To: ELECTION_VOTING, UserID: 1, Reason: "outage solved"},
+			{ElectionID: 2, From: ELECTION_VOTING, To: ELECTION_VOTING, UserID: 1, Reason: "outage"},
+			{ElectionID: 2, From: ELECTION_VOTING, To: ELECTION_SUSPENDED, UserID: 1, Reason: "irregularity"},
+			{ElectionID: 2, From: ELECTION_SUSPENDED, To: ELECTION_CLOSED, UserID: 1, Reason: "irregularity dismissed"},
+			{ElectionID: 2, From: ELECTION_CLOSED, To: ELECTION_COUNTED}}}))
+
+	question1.Votes, question2.Votes = []int{0, 1, 1}, []int{1, 1} // only the last ballot of the recast vote counts
+	t.Run("Admin user should see the votes of questions before the embargo",
+		testEndpoint("/questions/get", 200, to{cookies: cookies1, query: "?election_id=2", expectedQuestions: []Question{question1, question2}}))
+	t.Run("Questions should not show votes before the embargo",
+		testEndpoint("/questions/get", 200, to{query: "?election_id=2", expectedQuestions: []Question{withoutVotes(question1), withoutVotes(question2)}}))
+	t.Run("Ballots should not be public before the embargo",
+		testEndpoint("/elections/ballots", 500, to{query: "?election_id=2"}))
+	t.Run("Admin user should see the ballots before the embargo",
+		testEndpoint("/elections/ballots", 200, to{cookies: cookies1, query: "?election_id=2"}))
+
+	timeTravel(60 * time.Minute) // embargo over
+	advanceElections()
+	t.Run("Questions should show their votes after the embargo",
+		testEndpoint("/questions/get", 200, to{query: "?election_id=2", expectedQuestions: []Question{question1, question2}}))
+	var board BulletinBoard
+	var proof InclusionProof
+	t.Run("Everyone should see the ballots after the embargo",
+		testEndpoint("/elections/ballots", 200, to{query: "?election_id=2", response: &board}))
+	t.Run("Voters should get the inclusion proof of their ballot",
+		testEndpoint("/elections/ballots/proof", 200, to{params: m{"token": voteToken}, response: &proof}))
+	t.Run("The bulletin board should include every ballot, and prove the inclusion of the voter ballot", func(t *testing.T) {
+		checkBulletinBoard(t, board, proof, voteToken, 3)
+	})
+	if diff := cmp.Diff([]string{supersededToken}, board.Superseded); diff != "" {
+		t.Errorf("Expected the bulletin board to list the superseded ballot, but got: %s", diff)
+	}
+	var supersededProof InclusionProof
+	t.Run("Voters should get the inclusion proof of their superseded ballot",
+		testEndpoint("/elections/ballots/proof", 200, to{params: m{"token": supersededToken}, response: &supersededProof}))
+	if supersededProof.Leaf != supersededReceipt.Ballot {
+		t.Errorf("Expected the leaf signed in the receipt %s to stay after recasting, but got %s.", supersededReceipt.Ballot, supersededProof.Leaf)
+	}
+	if err := verifier.VerifyInclusion(supersededReceipt.Ballot, supersededProof.Steps, board.Root); err != nil {
+		t.Errorf("Expected the receipt of the superseded ballot to be included, but got: %s", err)
+	}
+	t.Run("Recounting the election with questions should give the same results", testRecount([]string{"-election", "2"}, true))
+
+	t.Run("Admin user should not be able to delete elections that ended",
+		testEndpoint("/elections/delete", 500, to{cookies: cookies1, query: "?id=2"}))
+	var endedElections []Election
+	t.Run("Elections that ended should still appear",
+		testEndpoint("/elections/get", 200, to{cookies: cookies1, response: &endedElections}))
+	if len(endedElections) != 2 || endedElections[1].ID != 2 {
+		t.Fatalf("Expected elections 1 and 2, but got %+v.", endedElections)
+	}
+	t.Run("Non-admin user should not be able to publish results",
+		testEndpoint("/elections/results/publish", 401, to{cookies: cookies2, query: "?id=1"}))
+	t.Run("Admin user should not be able to publish results through the generic transitions",
+		testEndpoint("/elections/transition", 400, to{cookies: cookies1, params: m{"id": 1, "state": ELECTION_RESULTS_PUBLISHED}}))
+	t.Run("Admin user should not be able to archive elections before publishing their results",
+		testEndpoint("/elections/transition", 500, to{cookies: cookies1, params: m{"id": 1, "state": ELECTION_ARCHIVED}}))
+	t.Run("Admin user should be able to publish results",
+		testEndpoint("/elections/results/publish", 200, to{cookies: cookies1, query: "?id=1"}))
+	election.State, election.StateChangedAt = ELECTION_RESULTS_PUBLISHED, now()
+	t.Run("Everyone should see published results",
+		testEndpoint("/elections/get", 200, to{expectedElections: []Election{election, endedElections[1]}}))
+	t.Run("Admin user should be able to archive elections",
+		testEndpoint("/elections/transition", 200, to{cookies: cookies1, params: m{"id": 1, "state": ELECTION_ARCHIVED}}))
+	t.Run("Admin user should see every transition of an election",
+		testEndpoint("/elections/transitions", 200, to{cookies: cookies1, query: "?id=1", expectedTransitions: []ElectionTransition{
+			{ElectionID: 1, From: ELECTION_DRAFT, To: ELECTION_NOMINATION, UserID: 1},
+			{ElectionID: 1, From: ELECTION_NOMINATION, To: ELECTION_REGISTRATION_CLOSED},
+			{ElectionID: 1, From: ELECTION_REGISTRATION_CLOSED, To: ELECTION_VOTING},
+			{ElectionID: 1, From: ELECTION_VOTING, To: ELECTION_CLOSED},
+			{ElectionID: 1, From: ELECTION_CLOSED, To: ELECTION_COUNTED},
+			{ElectionID: 1, From: ELECTION_COUNTED, To: ELECTION_RESULTS_PUBLISHED, UserID: 1},
+			{ElectionID: 1, From: ELECTION_RESULTS_PUBLISHED, To: ELECTION_ARCHIVED, UserID: 1}}}))
+	t.Run("Non-admin user should not see the transitions of an election",
+		testEndpoint("/elections/transitions", 401, to{cookies: cookies2, query: "?id=1"}))
+
+	t.Run("Elections that ended should appear in the user participations",
+		testEndpoint("/users/whoami", 200, to{cookies: cookies2, expectedUser: expectedUser{uniqueID: uniqueID2, role: ROLE_VALIDATED, votedElections: []int{1, 2}}}))
+
+	// anonymous voting with blind signatures
+	election4 := newElection("election 4", COUNT_BORDA, now().Add(1*time.Hour), now().Add(2*time.Hour), 1, 2)
+	election4.BlindSignatures, election4.AllowRecast = true, true
+	t.Run("Admin user should not be able to create elections with anonymous ballots that can be recast",
+		testEndpoint("/elections/create", 400, to{cookies: cookies1, params: election4}))
+	election4.AllowRecast = false
+	t.Run("Admin user should be able to create elections with blind signatures",
+		testEndpoint("/elections/create", 200, to{cookies: cookies1, params: election4}))
+	t.Run("Admin user should be able to publish elections with blind signatures",
+		testEndpoint("/elections/publish", 200, to{cookies: cookies1, query: "?id=4"}))
+	t.Run("Credentials should not be signed before voting starts",
+		testEndpoint("/elections/credentials/sign", 500, to{cookies: cookies2, params: m{"election_id": 4, "blinded": "01"}}))
+
+	timeTravel(90 * time.Minute)
+	advanceElections()
+	var blindKey BlindKey
+	t.Run("Everyone should get the key that signs the credentials",
+		testEndpoint("/elections/credentials/key", 200, to{query: "?election_id=4", response: &blindKey}))
+	t.Run("Elections without blind signatures should not have a key",
+		testEndpoint("/elections/credentials/key", 500, to{query: "?election_id=1"}))
+
+	n, _ := new(big.Int).SetString(blindKey.N, 16)
+	key := &rsa.PublicKey{N: n, E: blindKey.E}
+	credential := strings.Repeat("c", MIN_CREDENTIAL_LENGTH)
+	blinded, factor, err := blindMessage(key, []byte(credential))
+	if err != nil {
+		t.Fatalf("Could not blind credential: %s", err)
+	}
+
+	var blindSignature string
+	t.Run("Non logged user should not get credentials signed",
+		testEndpoint("/elections/credentials/sign", 401, to{params: m{"election_id": 4, "blinded": blinded.Text(16)}}))
+	t.Run("Validated user should get its blinded credential signed",
+		testEndpoint("/elections/credentials/sign", 200, to{cookies: cookies2, params: m{"election_id": 4, "blinded": blinded.Text(16)}, response: &blindSignature}))
+	t.Run("Validated user should not get a second credential signed",
+		testEndpoint("/elections/credentials/sign", 500, to{cookies: cookies2, params: m{"election_id": 4, "blinded": blinded.Text(16)}}))
+	t.Run("Validated user should not be able to vote with its session in elections with blind signatures",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies3, params: m{"election_id": 4, "blank": true}}))
+
+	s, _ := new(big.Int).SetString(blindSignature, 16)
+	signature := unblindSignature(key, s, factor).Text(16)
+	t.Run("Ballots with a credential that was not signed should be rejected",
+		testEndpoint("/elections/vote/anonymous", 500, to{params: m{"election_id": 4, "blank": true, "credential": strings.Repeat("d", MIN_CREDENTIAL_LENGTH), "signature": signature}}))
+	t.Run("Ballots with a signed credential should be accepted with no session",
+		testEndpoint("/elections/vote/anonymous", 200, to{params: m{"election_id": 4, "blank": true, "credential": credential, "signature": signature}, voteToken: &voteToken}))
+	t.Run("Anonymous ballots should be checked as any other",
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": voteToken}, expectedVote: expectedVote{blank: true, answers: []string{}}}))
+	t.Run("Credentials should not be used twice",
+		testEndpoint("/elections/vote/anonymous", 500, to{params: m{"election_id": 4, "blank": true, "credential": credential, "signature": signature}}))
+	t.Run("Getting a credential should count as participating",
+		testEndpoint("/users/whoami", 200, to{cookies: cookies2, expectedUser: expectedUser{uniqueID: uniqueID2, role: ROLE_VALIDATED, votedElections: []int{1, 2, 4}}}))
+
+	// encrypted tally
+	election5 := newElection("election 5", COUNT_APPROVAL, now().Add(1*time.Hour), now().Add(2*time.Hour), 1, 2)
+	election5.BallotType, election5.Encrypted, election5.Trustees, election5.Quorum = BALLOT_APPROVAL, true, []int{1, 3}, 3
+	t.Run("Admin user should not be able to create encrypted elections with a quorum greater than the trustees",
+		testEndpoint("/elections/create", 400, to{cookies: cookies1, params: election5}))
+	election5.Trustees, election5.Quorum = []int{1, 2}, 2
+	t.Run("Admin user should not be able to create encrypted elections with trustees that are not auditors",
+		testEndpoint("/elections/create", 500, to{cookies: cookies1, params: election5}))
+	election5.Trustees = []int{1, 3}
+	t.Run("Admin user should be able to create encrypted elections",
+		testEndpoint("/elections/create", 200, to{cookies: cookies1, params: election5}))
+
+	var share1, share3 TrusteeShare
+	t.Run("Users that are not trustees should not get a share",
+		testEndpoint("/elections/trustees/share", 500, to{cookies: cookies2, params: m{"election_id": 5}}))
+	t.Run("Trustees should get their share",
+		testEndpoint("/elections/trustees/share", 200, to{cookies: cookies1, params: m{"election_id": 5}, response: &share1}))
+	t.Run("Trustees should not get their share twice",
+		testEndpoint("/elections/trustees/share", 500, to{cookies: cookies1, params: m{"election_id": 5}}))
+
+	candidate6 := Candidate{ElectionID: 5, Name: "candidate 6", Presentation: "candidate 6 presentation", Image: "candidate.jpg"}
+	candidate7 := Candidate{ElectionID: 5, Name: "candidate 7", Presentation: "candidate 7 presentation", Image: "candidate.jpg"}
+	t.Run("Admin users should be able to add candidates to encrypted elections",
+		testEndpoint("/candidates/add", 200, to{cookies: cookies1, candidate: candidate6}))
+	t.Run("Admin users should be able to add candidates to encrypted elections",
+		testEndpoint("/candidates/add", 200, to{cookies: cookies1, candidate: candidate7}))
+	t.Run("Admin user should be able to publish encrypted elections",
+		testEndpoint("/elections/publish", 200, to{cookies: cookies1, query: "?id=5"}))
+
+	var candidates5 []Candidate
+	t.Run("Users should see the candidates of encrypted elections",
+		testEndpoint("/candidates/get", 200, to{query: "?election_id=5", response: &candidates5}))
+	sort.Slice(candidates5, func(i, j int) bool { return candidates5[i].ID < candidates5[j].ID })
+	c6, c7 := candidates5[0].ID, candidates5[1].ID
+
+	timeTravel(90 * time.Minute)
+	advanceElections()
+	t.Run("Voting should not open while a trustee has not taken their share",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies1, params: m{"election_id": 5, "candidates": []int{c6, c7}}}))
+	t.Run("Trustees should get their share",
+		testEndpoint("/elections/trustees/share", 200, to{cookies: cookies3, params: m{"election_id": 5}, response: &share3}))
+	advanceElections()
+	var checked checkedVote
+	t.Run("Validated user should be able to vote in encrypted elections",
+		testEndpoint("/elections/vote", 200, to{cookies: cookies1, params: m{"election_id": 5, "candidates": []int{c6, c7}}, voteToken: &voteToken}))
+	t.Run("Encrypted ballots should not show their candidates when checked",
+		testEndpoint("/elections/vote/check", 200, to{params: m{"token": voteToken}, response: &checked}))
+	if !checked.Encrypted || checked.Race != nil {
+		t.Errorf("Expected an encrypted ballot with no race, but got %+v.", checked)
+	}
+
+	var elections []Election
+	t.Run("Users should see the tally key of encrypted elections",
+		testEndpoint("/elections/get", 200, to{cookies: cookies2, response: &elections}))
+	var tallyKey *big.Int
+	for _, e := range elections {
+		if e.ID == 5 {
+			tallyKey, _ = new(big.Int).SetString(e.TallyKey, 16)
+		}
+	}
+	if tallyKey == nil {
+		t.Fatalf("Expected the tally key of election 5, but got %+v.", elections)
+	}
+
+	encryptBallot := func(marked []int, min, max int) verifier.Ballot {
+		ballot, err := verifier.EncryptBallot(tallyKey, 5, []int{c6, c7}, marked, min, max)
+		if err != nil {
+			t.Fatalf("Could not encrypt ballot: %s", err)
+		}
+		return ballot
+	}
+	t.Run("Ballots encrypted by the voter should not be accepted with less marks than allowed",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 5, "encrypted": encryptBallot([]int{}, 0, 2)}}))
+	wrongElection, err := verifier.EncryptBallot(tallyKey, 4, []int{c6, c7}, []int{c6}, 1, 2)
+	if err != nil {
+		t.Fatalf("Could not encrypt ballot: %s", err)
+	}
+	t.Run("Ballots encrypted by the voter should not be accepted with the proofs of another election",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 5, "encrypted": wrongElection}}))
+	t.Run("Ballots encrypted by the voter should not mark candidates in the clear",
+		testEndpoint("/elections/vote", 500, to{cookies: cookies2, params: m{"election_id": 5, "candidates": []int{c6}, "encrypted": encryptBallot([]int{c6}, 1, 2)}}))
+	var receipt castVote
+	t.Run("Validated user should be able to send a ballot encrypted by themselves",
+		testEndpoint("/elections/vote", 200, to{cookies: cookies2, params: m{"election_id": 5, "encrypted": encryptBallot([]int{c6}, 1, 2)}, response: &receipt}))
+	t.Run("Validated user should be able to vote blank in encrypted elections",
+		testEndpoint("/elections/vote", 200, to{cookies: cookies3, params: m{"election_id": 5, "blank": true}}))
+	t.Run("The tally should not be given while voting",
+		testEndpoint("/elections/tally", 500, to{query: "?election_id=5"}))
+
+	timeTravel(1 * time.Hour)
+	advanceElections()
+	var tally EncryptedTally
+	t.Run("Everyone should get the tally once voting is closed",
+		testEndpoint("/elections/tally", 200, to{query: "?election_id=5", response: &tally}))
+	if tally.Ballots != 3 || tally.Quorum != 2 || len(tally.Ciphertexts) != 2 {
+		t.Errorf("Expected a tally of 3 ballots for 2 candidates with a quorum of 2, but got %+v.", tally)
+	}
+
+	partials := func(share TrusteeShare, index int) m {
+		s, _ := new(big.Int).SetString(*share.Share, 16)
+		values, proofs, err := verifier.DecryptTally(s, 5, index, tally.Ciphertexts)
+		if err != nil {
+			t.Fatalf("Could not decrypt partially: %s", err)
+		}
+		return m{"election_id": 5, "partials": values, "proofs": proofs}
+	}
+
+	t.Run("Users that are not trustees should not send partial decryptions",
+		testEndpoint("/elections/tally/decrypt", 500, to{cookies: cookies2, params: partials(share1, share1.Index)}))
+	t.Run("Partial decryptions should not be accepted without their proofs",
+		testEndpoint("/elections/tally/decrypt", 400, to{cookies: cookies1, params: m{"election_id": 5, "partials": partials(share1, share1.Index)["partials"]}}))
+	t.Run("Trustees should send their partial decryption",
+		testEndpoint("/elections/tally/decrypt", 200, to{cookies: cookies1, params: partials(share1, share1.Index)}))
+	t.Run("Trustees should not send their partial decryption twice",
+		testEndpoint("/elections/tally/decrypt", 500, to{cookies: cookies1, params: partials(share1, share1.Index)}))
+	t.Run("Recounting an election waiting for the trustees should not compare anything", testRecount([]string{"-election", "5"}, true))
+	t.Run("Partial decryptions made with the share of another trustee should not be accepted",
+		testEndpoint("/elections/tally/decrypt", 500, to{cookies: cookies3, params: partials(share1, share3.Index)}))
+	t.Run("Partial decryptions with the proofs of another trustee should not be accepted",
+		testEndpoint("/elections/tally/decrypt", 500, to{cookies: cookies3, params: partials(share3, share1.Index)}))
+	t.Run("The last partial decryption of the quorum should count the election",
+		testEndpoint("/elections/tally/decrypt", 200, to{cookies: cookies3, params: partials(share3, share3.Index)}))
+	t.Run("Non logged users should get the tally without the partial decryptions before the results are published",
+		testEndpoint("/elections/tally", 200, to{query: "?election_id=5", response: &tally}))
+	if len(tally.Decryptions) != 0 {
+		t.Errorf("Expected no partial decryptions before the results are published, but got %+v.", tally.Decryptions)
+	}
+	t.Run("Admin user should get the partial decryptions of the tally",
+		testEndpoint("/elections/tally", 200, to{cookies: cookies1, query: "?election_id=5", response: &tally}))
+	if len(tally.Decryptions) != 2 {
+		t.Errorf("Expected the 2 partial decryptions of the quorum, but got %+v.", tally.Decryptions)
+	}
+	for _, d := range tally.Decryptions {
+		if err := verifier.VerifyTallyDecryption(d.Verification, 5, d.Trustee, tally.Ciphertexts, d.Values, d.Proofs); err != nil {
+			t.Errorf("Expected the partial decryption of trustee %d to be verified, but got: %s", d.Trustee, err)
+		}
+	}
+
+	var counted []Candidate
+	t.Run("Admin user should see the points of the decrypted tally",
+		testEndpoint("/candidates/get", 200, to{cookies: cookies1, query: "?election_id=5", response: &counted}))
+	for _, c := range counted {
+		if expected := map[int]float64{c6: 2, c7: 1}[c.ID]; c.Points != expected {
+			t.Errorf("Expected %g points for candidate %d, but got %g.", expected, c.ID, c.Points)
+		}
+	}
+	t.Run("Recounting the encrypted election should give the same results", testRecount([]string{"-election", "5"}, true))
+
+	// audit log
+	t.Run("Unvalidated users should not get the audit log",
+		testEndpoint("/audit/get", 401, to{}))
+	t.Run("Validated users should not get the audit log",
+		testEndpoint("/audit/get", 401, to{cookies: cookies2}))
+	var auditLog []AuditEntry
+	t.Run("Auditor users should get the audit log",
+		testEndpoint("/audit/get", 200, to{cookies: cookies3, response: &auditLog}))
+	if err := checkAuditChain(auditLog); err != nil {
+		t.Errorf("Expected the audit log chain to be intact, but got: %s", err)
+	}
+	validated := false
+	for _, a := range auditLog {
+		if a.Action == "validate_user" && a.UserID == 1 && string(a.Params) == `{"id":2}` {
+			validated = true
+		}
+		if a.Action == "initialize" && strings.Contains(string(a.Params), "password") {
+			t.Errorf("Expected the audit log not to hold passwords, but got %s.", a.Params)
+		}
+		if strings.Contains(a.Action, "vote") {
+			t.Errorf("Expected the audit log not to record votes, but got %+v.", a)
+		}
+	}
+	if !validated {
+		t.Errorf("Expected the audit log to record the validation of user 2 by user 1.")
+	}
+	t.Run("Checking the audit log should find it intact", testCheckAudit(true))
+
+	// signed receipts and results
+	var serverKey ServerKey
+	t.Run("Everyone should get the public key of the installation",
+		testEndpoint("/signatures/key", 200, to{response: &serverKey}))
+	if err := verifier.VerifyReceipt(serverKey.PublicKey, receipt.Token, receipt.Ballot, receipt.Signature); err != nil {
+		t.Errorf("Expected the receipt signature to be valid, but got: %s", err)
+	}
+	var inclusion InclusionProof
+	t.Run("Admin user should get the inclusion proof of a receipt",
+		testEndpoint("/elections/ballots/proof", 200, to{cookies: cookies1, params: m{"token": receipt.Token}, response: &inclusion}))
+	if inclusion.Leaf != receipt.Ballot {
+		t.Errorf("Expected the signed ballot hash %s to be the leaf of the ballot, but got %s.", receipt.Ballot, inclusion.Leaf)
+	}
+
+	var valid bool
+	t.Run("Receipts given by the server should be verified",
+		testEndpoint("/signatures/verify", 200, to{params: m{"kind": SIGNATURE_RECEIPT, "receipt": receipt.Token, "ballot": receipt.Ballot, "signature": receipt.Signature}, response: &valid}))
+	if !valid {
+		t.Errorf("Expected the receipt to be verified.")
+	}
+	t.Run("Receipts with another ballot should not be verified",
+		testEndpoint("/signatures/verify", 200, to{params: m{"kind": SIGNATURE_RECEIPT, "receipt": receipt.Token, "ballot": inclusion.Root, "signature": receipt.Signature}, response: &valid}))
+	if valid {
+		t.Errorf("Expected the receipt with another ballot not to be verified.")
+	}
+
+	t.Run("Validated users should not get the signed results before they are published",
+		testEndpoint("/elections/results/signed", 500, to{cookies: cookies2, query: "?election_id=5"}))
+	var signed SignedResults
+	t.Run("Admin user should get the signed results of counted elections",
+		testEndpoint("/elections/results/signed", 200, to{cookies: cookies1, query: "?election_id=5", response: &signed}))
+	if err := verifier.VerifyResults(serverKey.PublicKey, signed.Document, signed.Signature); err != nil {
+		t.Errorf("Expected the results signature to be valid, but got: %s", err)
+	}
+	var document ResultsDocument
+	if err := json.Unmarshal(signed.Document, &document); err != nil || document.Points[c6] != 2 || document.Points[c7] != 1 {
+		t.Errorf("Expected the signed results to give 2 points to candidate %d and 1 to candidate %d, but got %s (%v).", c6, c7, signed.Document, err)
+	}
+	if err := verifier.VerifyInclusion(receipt.Ballot, inclusion.Steps, document.BallotsRoot); err != nil {
+		t.Errorf("Expected the ballot of the receipt to be included in the signed root, but got: %s", err)
+	}
+	var transitions5 []ElectionTransition
+	t.Run("Admin user should see the root of the ballots in the transition that closed voting",
+		testEndpoint("/elections/transitions", 200, to{cookies: cookies1, query: "?id=5", response: &transitions5}))
+	for _, tr := range transitions5 {
+		if tr.To == ELECTION_CLOSED && tr.BallotsRoot != document.BallotsRoot {
+			t.Errorf("Expected the closing transition to record root %s, but got %s.", document.BallotsRoot, tr.BallotsRoot)
+		}
+		if tr.To != ELECTION_CLOSED && tr.BallotsRoot != "" {
+			t.Errorf("Expected only the closing transition to record a root, but got %+v.", tr)
+		}
+	}
+	t.Run("Results signed by the server should be verified",
+		testEndpoint("/signatures/verify", 200, to{params: m{"kind": SIGNATURE_RESULTS, "document": string(signed.Document), "signature": signed.Signature}, response: &valid}))
+	if !valid {
+		t.Errorf("Expected the results to be verified.")
+	}
+	tampered := strings.Replace(string(signed.Document), fmt.Sprintf(`"%d":2`, c6), fmt.Sprintf(`"%d":3`, c6), 1)
+	t.Run("Tampered results should not be verified",
+		testEndpoint("/signatures/verify", 200, to{params: m{"kind": SIGNATURE_RESULTS, "document": tampered, "signature": signed.Signature}, response: &valid}))
+	if valid || tampered == string(signed.Document) {
+		t.Errorf("Expected the tampered results not to be verified.")
+	}
+}
+
+func testCheckAudit(expectedIntact bool) func(*testing.T) {
+	return func(t *testing.T) {
+		var out bytes.Buffer
+		intact, err := checkAudit(nil, &out)
+		if err != nil {
+			t.Fatalf("Unexpected error checking audit log: %s", err)
+		}
+		if intact != expectedIntact {
+			t.Errorf("Expected the audit log to be intact %t, but got %t:\n%s", expectedIntact, intact, out.String())
+		}
+	}
+}
+
+func testRecount(args []string, expectedSame bool) func(*testing.T) {
+	return func(t *testing.T) {
+		var out bytes.Buffer
+		same, err := recount(args, &out)
+		if err != nil {
+			t.Fatalf("Unexpected error recounting: %s", err)
+		}
+		if same != expectedSame {
+			t.Errorf("Expected the recount to give the same results %t, but got %t:\n%s", expectedSame, same, out.String())
+		}
+	}
 }
 
 func testVoteOnce(options testOptions) func(*testing.T) {
@@ -477,9 +1124,20 @@ func newElection(name, countMethod string, start, end time.Time, minCandidates,
 		Name:          name,
 		Start:         start,
 		End:           end,
+		BallotType:    BALLOT_RANKED,
 		CountMethod:   countMethod,
 		MinCandidates: minCandidates,
 		MaxCandidates: maxCandidates,
+		Seats:         1,
+		MaxScore:      DEFAULT_MAX_SCORE,
+		Grades:        DEFAULT_GRADES,
+		Truncation:    TRUNCATION_STANDARD,
+
+		TieBreak:       TIE_BREAK_FIRST_PREFERENCES,
+		TieResolutions: [][]int{},
+
+		State:          ELECTION_DRAFT,
+		StateChangedAt: now(),
 	}
 }
 
@@ -549,8 +1207,77 @@ func testEndpoint(path string, expectedCode int, options testOptions) func(*test
 			}
 		}
 
-		if options.voteToken != nil {
-			*options.voteToken = strings.Trim(rr.Body.String(), "\"")
+		if options.expectedLists != nil {
+			var lists []CandidateList
+			if err := json.Unmarshal([]byte(rr.Body.String()), &lists); err != nil {
+				t.Errorf("Could not unmarshal expected lists response: %s", err)
+			} else if diff := cmp.Diff(options.expectedLists, lists); diff != "" {
+				t.Errorf("Expected no diff in lists, but got: %s.", diff)
+			}
+		}
+
+		if options.expectedQuestions != nil {
+			var questions []Question
+			if err := json.Unmarshal([]byte(rr.Body.String()), &questions); err != nil {
+				t.Errorf("Could not unmarshal expected questions response: %s", err)
+			} else if diff := cmp.Diff(options.expectedQuestions, questions); diff != "" {
+				t.Errorf("Expected no diff in questions, but got: %s.", diff)
+			}
+		}
+
+		if options.expectedVote.candidates != nil || options.expectedVote.blank {
+			var vote struct {
+				Race       []Candidate     `json:"race"`
+				Blank      bool            `json:"blank"`
+				Superseded bool            `json:"superseded"`
+				Answers    []checkedAnswer `json:"answers"`
+			}
+			if err := json.Unmarshal([]byte(rr.Body.String()), &vote); err != nil {
+				t.Errorf("Could not unmarshal expected vote response: %s", err)
+			} else {
+				if vote.Blank != options.expectedVote.blank {
+					t.Errorf("Expected blank vote %t, but got %t.", options.expectedVote.blank, vote.Blank)
+				}
+				if vote.Superseded != options.expectedVote.superseded {
+					t.Errorf("Expected superseded vote %t, but got %t.", options.expectedVote.superseded, vote.Superseded)
+				}
+				compareCandidates(t, options.expectedVote.candidates, vote.Race)
+				answers := make([]string, 0, len(vote.Answers))
+				for _, x := range vote.Answers {
+					answers = append(answers, x.Answer)
+				}
+				if diff := cmp.Diff(options.expectedVote.answers, answers); diff != "" {
+					t.Errorf("Expected no diff in vote answers, but got: %s.", diff)
+				}
+			}
+		}
+
+		if options.expectedTransitions != nil {
+			var transitions []ElectionTransition
+			if err := json.Unmarshal([]byte(rr.Body.String()), &transitions); err != nil {
+				t.Errorf("Could not unmarshal expected transitions response: %s", err)
+			} else {
+				compareTransitions(t, options.expectedTransitions, transitions)
+			}
+		}
+
+		if options.response != nil {
+			if err := json.Unmarshal([]byte(rr.Body.String()), options.response); err != nil {
+				t.Errorf("Could not unmarshal response: %s", err)
+			}
+		}
+
+		if options.voteToken != nil || options.voteSlot != nil {
+			var receipt castVote
+			if err := json.Unmarshal([]byte(rr.Body.String()), &receipt); err != nil {
+				t.Errorf("Could not unmarshal vote receipt: %s", err)
+			}
+			if options.voteToken != nil {
+				*options.voteToken = receipt.Token
+			}
+			if options.voteSlot != nil {
+				*options.voteSlot = receipt.Slot
+			}
 		}
 
 		if options.fileContent != "" && options.fileContent != rr.Body.String() {
@@ -600,6 +1327,7 @@ func testEndpointAux(t *testing.T, path string, options testOptions, i int) *htt
 		}
 	} else if options.candidate.Name != "" {
 		body, contentType, err = fileUploadBody(options.candidate.Image, "image", map[string]string{
+			"election_id":  strconv.Itoa(options.candidate.ElectionID),
 			"name":         options.candidate.Name,
 			"presentation": options.candidate.Presentation,
 		})
@@ -669,6 +1397,9 @@ LOOP:
 					t.Errorf("Expected user with unique ID %q to have role %q, but has role %q.", e.uniqueID, e.role, u.Role)
 				}
 				compareMessages(t, e.unsolvedMessages, u.Messages)
+				if e.votedElections != nil {
+					compareParticipations(t, e.uniqueID, e.votedElections, u.Participations)
+				}
 				continue LOOP
 			}
 		}
@@ -676,6 +1407,71 @@ LOOP:
 	}
 }
 
+func compareParticipations(t *testing.T, uniqueID string, expected []int, got []Participation) {
+	gotElections := make([]int, 0, len(got))
+	for _, x := range got {
+		gotElections = append(gotElections, x.ElectionID)
+	}
+	sort.Ints(gotElections)
+
+	if diff := cmp.Diff(expected, gotElections); diff != "" {
+		t.Errorf("Expected no diff in elections voted by user with unique ID %q, but got: %s.", uniqueID, diff)
+	}
+}
+
+// checkBulletinBoard checks the board the way anyone could, hashing the ballots again and going up the proof
+func checkBulletinBoard(t *testing.T, board BulletinBoard, proof InclusionProof, token string, expectedBallots int) {
+	if len(board.Ballots) != expectedBallots {
+		t.Errorf("Expected %d ballots in the bulletin board, but got %d.", expectedBallots, len(board.Ballots))
+	}
+
+	leaves, err := ballotLeaves(board.Ballots)
+	if err != nil {
+		t.Fatalf("Could not hash ballots: %s", err)
+	}
+	if root := hex.EncodeToString(merkleRoot(leaves)); root != board.Root || proof.Root != board.Root {
+		t.Errorf("Expected root %s, but the board has %s and the proof %s.", root, board.Root, proof.Root)
+	}
+
+	if proof.Index < 0 || proof.Index >= len(board.Ballots) || board.Ballots[proof.Index].Hash != token {
+		t.Fatalf("Expected the proof to point to the ballot with token %s.", token)
+	}
+
+	if err := verifier.VerifyInclusion(hex.EncodeToString(leaves[proof.Index]), proof.Steps, board.Root); err != nil {
+		t.Errorf("Expected the inclusion proof to verify, but got: %s", err)
+	}
+}
+
+// withoutResults returns the election as seen by users that cannot see its results yet
+func withoutResults(e Election) Election {
+	e.Results = nil
+	e.Candidates = append([]Candidate{}, e.Candidates...)
+	for i := range e.Candidates {
+		e.Candidates[i].Points = 0
+	}
+	return e
+}
+
+func withoutVotes(q Question) Question {
+	q.Votes = []int{}
+	return q
+}
+
+// compareTransitions ignores the ids and times of the transitions
+func compareTransitions(t *testing.T, expected, got []ElectionTransition) {
+	if len(expected) != len(got) {
+		t.Errorf("Expected %d transitions, but got %d.", len(expected), len(got))
+		return
+	}
+
+	for i := range expected {
+		e, g := expected[i], got[i]
+		if e.ElectionID != g.ElectionID || e.From != g.From || e.To != g.To || e.UserID != g.UserID || e.Reason != g.Reason {
+			t.Errorf("Expected transition %v but got %v.", e, g)
+		}
+	}
+}
+
 func compareCandidates(t *testing.T, expected, got []Candidate) {
 	if len(expected) != len(got) {
 		t.Errorf("Expected %d candidates, but got %d.", len(expected), len(got))
@@ -725,6 +1521,11 @@ func compareElections(t *testing.T, expected []Election, got []Election) {
 
 	if len(expected) > 0 {
 		for k := range expected {
+			// the seed of the lot is drawn by the server, so it can only be checked that there is one
+			if got[k].TieBreakSeed == "" {
+				t.Errorf("Expected election %d to have a tie break seed.", got[k].ID)
+			}
+			expected[k].TieBreakSeed = got[k].TieBreakSeed
 			sort.Slice(expected[k].Candidates, func(i, j int) bool { return expected[k].Candidates[i].ID < expected[k].Candidates[j].ID })
 			sort.Slice(got[k].Candidates, func(i, j int) bool { return got[k].Candidates[i].ID < got[k].Candidates[j].ID })
 		}
@@ -809,6 +1610,925 @@ func fileUploadBody(filename string, fileField string, params map[string]string)
 	return body, writer.FormDataContentType(), err
 }
 
+func TestCountPositional(t *testing.T) {
+	a, b, c := 1, 2, 3
+	candidates := []Candidate{{ID: a}, {ID: b}, {ID: c}}
+	votes := []Vote{{Candidates: []int{a, b, c}}, {Candidates: []int{b}}}
+
+	for _, test := range []struct {
+		method, truncation string
+		expected           map[int]float64
+	}{
+		{method: COUNT_BORDA, truncation: TRUNCATION_STANDARD, expected: map[int]float64{a: 3, b: 5, c: 1}},
+		{method: COUNT_BORDA, truncation: TRUNCATION_MODIFIED, expected: map[int]float64{a: 3, b: 3, c: 1}},
+		{method: COUNT_BORDA, truncation: TRUNCATION_AVERAGED, expected: map[int]float64{a: 4.5, b: 5, c: 2.5}},
+		{method: COUNT_DOWDALL, truncation: TRUNCATION_STANDARD, expected: map[int]float64{a: 1, b: 1.5, c: 1.0 / 3}},
+		{method: COUNT_DOWDALL, truncation: TRUNCATION_MODIFIED, expected: map[int]float64{a: 1, b: 1.5, c: 1.0 / 3}},
+		{method: COUNT_DOWDALL, truncation: TRUNCATION_AVERAGED, expected: map[int]float64{a: 1 + 5.0/12, b: 1.5, c: 1.0/3 + 5.0/12}},
+	} {
+		e := Election{CountMethod: test.method, Truncation: test.truncation, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, Candidates: candidates}
+		results, err := countVotes(e, votes)
+		if err != nil {
+			t.Fatalf("[%s %s] Unexpected error counting votes: %s", test.method, test.truncation, err)
+		}
+
+		for c, points := range test.expected {
+			if compareVotes(points, results.Points[c]) != 0 {
+				t.Errorf("[%s %s] Expected %f points for candidate %d, got %f", test.method, test.truncation, points, c, results.Points[c])
+			}
+		}
+
+		if results.Truncation != test.truncation {
+			t.Errorf("[%s %s] Expected the truncation option in the results, got %q", test.method, test.truncation, results.Truncation)
+		}
+	}
+}
+
+func TestCountSTV(t *testing.T) {
+	// https://en.wikipedia.org/wiki/Single_transferable_vote#Example
+	orange, pear, chocolate, strawberry, hamburger := 1, 2, 3, 4, 5
+	candidates := []Candidate{{ID: orange}, {ID: pear}, {ID: chocolate}, {ID: strawberry}, {ID: hamburger}}
+	votes := testVotes{
+		{n: 4, vote: []int{orange}},
+		{n: 2, vote: []int{pear, orange}},
+		{n: 8, vote: []int{chocolate, strawberry}},
+		{n: 4, vote: []int{chocolate, hamburger}},
+		{n: 1, vote: []int{strawberry}},
+		{n: 1, vote: []int{hamburger}},
+	}.votes()
+
+	for _, method := range []string{COUNT_STV_GREGORY, COUNT_STV_MEEK} {
+		e := Election{CountMethod: method, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 3, Candidates: candidates}
+		results, err := countVotes(e, votes)
+		if err != nil {
+			t.Fatalf("[%s] Unexpected error counting votes: %s", method, err)
+		}
+
+		sort.Ints(results.Elected)
+		if diff := cmp.Diff([]int{orange, chocolate, strawberry}, results.Elected); diff != "" {
+			t.Errorf("[%s] Unexpected elected candidates: %s", method, diff)
+		}
+
+		if results.Points[chocolate] != 12 || results.Points[pear] != 2 {
+			t.Errorf("[%s] Expected 12 points for chocolate and 2 for pear, got %v", method, results.Points)
+		}
+	}
+
+	e := Election{CountMethod: COUNT_STV_GREGORY, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 3, Candidates: candidates}
+	results, _ := countVotes(e, votes)
+	if results.Quota != 6 {
+		t.Errorf("Expected droop quota of 6, but got %f", results.Quota)
+	}
+
+	first := results.Rounds[0]
+	if diff := cmp.Diff([]int{chocolate}, first.Elected); diff != "" || first.Surplus != 6 {
+		t.Errorf("Expected chocolate elected with surplus 6 in first round, got %v (%s)", first, diff)
+	}
+
+	second := results.Rounds[1]
+	if second.Votes[strawberry] != 5 || second.Votes[hamburger] != 3 {
+		t.Errorf("Expected surplus transferred at half value in second round, got %v", second.Votes)
+	}
+}
+
+type testVotes []struct {
+	n    int
+	vote []int
+}
+
+func (x testVotes) votes() (votes []Vote) {
+	for _, v := range x {
+		for i := 0; i < v.n; i++ {
+			votes = append(votes, Vote{Candidates: v.vote})
+		}
+	}
+	return votes
+}
+
+func TestCountCondorcet(t *testing.T) {
+	// https://en.wikipedia.org/wiki/Schulze_method#Example
+	a, b, c, d, e := 1, 2, 3, 4, 5
+	candidates := []Candidate{{ID: a}, {ID: b}, {ID: c}, {ID: d}, {ID: e}}
+	votes := testVotes{
+		{n: 5, vote: []int{a, c, b, e, d}},
+		{n: 5, vote: []int{a, d, e, c, b}},
+		{n: 8, vote: []int{b, e, d, a, c}},
+		{n: 3, vote: []int{c, a, b, e, d}},
+		{n: 7, vote: []int{c, a, e, b, d}},
+		{n: 2, vote: []int{c, b, a, d, e}},
+		{n: 7, vote: []int{d, c, e, b, a}},
+		{n: 8, vote: []int{e, b, a, d, c}},
+	}.votes()
+
+	results, err := countVotes(Election{CountMethod: COUNT_SCHULZE, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 5, Candidates: candidates}, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	if diff := cmp.Diff([]int{e, a, c, b, d}, results.Elected); diff != "" {
+		t.Errorf("Unexpected schulze ranking: %s", diff)
+	}
+
+	if results.Pairwise[0][1] != 20 || results.Pairwise[1][0] != 25 || results.StrongestPaths[0][1] != 28 || results.StrongestPaths[4][3] != 31 {
+		t.Errorf("Unexpected pairwise or strongest paths matrix: %v %v", results.Pairwise, results.StrongestPaths)
+	}
+
+	if results.CondorcetWinner != 0 {
+		t.Errorf("Expected no condorcet winner, but got %d", results.CondorcetWinner)
+	}
+
+	// https://en.wikipedia.org/wiki/Ranked_pairs#Example
+	memphis, nashville, chattanooga, knoxville := 1, 2, 3, 4
+	candidates = []Candidate{{ID: memphis}, {ID: nashville}, {ID: chattanooga}, {ID: knoxville}}
+	votes = testVotes{
+		{n: 42, vote: []int{memphis, nashville, chattanooga, knoxville}},
+		{n: 26, vote: []int{nashville, chattanooga, knoxville, memphis}},
+		{n: 15, vote: []int{chattanooga, knoxville, nashville, memphis}},
+		{n: 17, vote: []int{knoxville, chattanooga, nashville, memphis}},
+	}.votes()
+
+	for _, method := range []string{COUNT_SCHULZE, COUNT_RANKED_PAIRS} {
+		results, err := countVotes(Election{CountMethod: method, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, Candidates: candidates}, votes)
+		if err != nil {
+			t.Fatalf("[%s] Unexpected error counting votes: %s", method, err)
+		}
+
+		if diff := cmp.Diff([]int{nashville}, results.Elected); diff != "" || results.CondorcetWinner != nashville {
+			t.Errorf("[%s] Expected nashville to win, got %v (%s)", method, results.Elected, diff)
+		}
+
+		if results.Points[nashville] != 3 || results.Points[chattanooga] != 2 || results.Points[memphis] != 0 {
+			t.Errorf("[%s] Unexpected points %v", method, results.Points)
+		}
+	}
+
+	// candidates ranked the same are not preferred to each other
+	a, b, c = 1, 2, 3
+	candidates = []Candidate{{ID: a}, {ID: b}, {ID: c}}
+	votes = []Vote{{Ranks: map[int]int{a: 1, b: 1, c: 2}}, {Ranks: map[int]int{a: 1, b: 1, c: 2}}, {Ranks: map[int]int{c: 1, b: 2}}}
+	results, err = countVotes(Election{CountMethod: COUNT_SCHULZE, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, Candidates: candidates}, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	if diff := cmp.Diff([][]int{{0, 0, 2}, {1, 0, 2}, {1, 1, 0}}, results.Pairwise); diff != "" || results.CondorcetWinner != b {
+		t.Errorf("Expected %d to be the condorcet winner, got %d (%s)", b, results.CondorcetWinner, diff)
+	}
+}
+
+func TestCountIRV(t *testing.T) {
+	a, b, c, d := 1, 2, 3, 4
+	candidates := []Candidate{{ID: a}, {ID: b}, {ID: c}, {ID: d}}
+	votes := testVotes{
+		{n: 8, vote: []int{a}},
+		{n: 6, vote: []int{b, c}},
+		{n: 5, vote: []int{c, b}},
+		{n: 2, vote: []int{d, a}},
+		{n: 1, vote: []int{d}},
+	}.votes()
+
+	results, err := countVotes(Election{CountMethod: COUNT_IRV, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, Candidates: candidates}, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	if diff := cmp.Diff([]int{b}, results.Elected); diff != "" {
+		t.Errorf("Unexpected winner: %s", diff)
+	}
+
+	if len(results.Rounds) != 3 {
+		t.Fatalf("Expected 3 rounds, but got %d", len(results.Rounds))
+	}
+
+	// d is excluded, one ballot exhausts; then c is excluded, and b wins with 11 votes out of 21 active ballots
+	for i, expected := range []struct {
+		excluded                  int
+		exhausted, newlyExhausted float64
+	}{{excluded: d, exhausted: 0, newlyExhausted: 0}, {excluded: c, exhausted: 1, newlyExhausted: 1}, {exhausted: 1, newlyExhausted: 0}} {
+		round := results.Rounds[i]
+		if expected.excluded != 0 && (len(round.Excluded) != 1 || round.Excluded[0] != expected.excluded) {
+			t.Errorf("[%d] Expected candidate %d excluded, got %v", i, expected.excluded, round.Excluded)
+		}
+		if round.Exhausted != expected.exhausted || round.NewlyExhausted != expected.newlyExhausted {
+			t.Errorf("[%d] Expected (%f, %f) exhausted ballots, got (%f, %f)", i, expected.exhausted, expected.newlyExhausted, round.Exhausted, round.NewlyExhausted)
+		}
+	}
+
+	if results.Points[b] != 11 || results.Points[a] != 10 || results.Points[c] != 5 || results.Points[d] != 3 {
+		t.Errorf("Unexpected points %v", results.Points)
+	}
+}
+
+func TestCountMarks(t *testing.T) {
+	a, b, c := 1, 2, 3
+	candidates := []Candidate{{ID: a}, {ID: b}, {ID: c}}
+	votes := testVotes{
+		{n: 3, vote: []int{a, b}},
+		{n: 2, vote: []int{c}},
+		{n: 2, vote: []int{b, c}},
+	}.votes()
+
+	results, err := countVotes(Election{CountMethod: COUNT_APPROVAL, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 2, Candidates: candidates}, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	if diff := cmp.Diff(map[int]float64{a: 3, b: 5, c: 4}, results.Points); diff != "" {
+		t.Errorf("Unexpected approval points: %s", diff)
+	}
+
+	if diff := cmp.Diff([]int{b, c}, results.Elected); diff != "" {
+		t.Errorf("Unexpected elected candidates: %s", diff)
+	}
+}
+
+func TestCountScores(t *testing.T) {
+	a, b, c := 1, 2, 3
+	candidates := []Candidate{{ID: a}, {ID: b}, {ID: c}}
+	votes := []Vote{
+		{Scores: map[int]int{a: 5, b: 3}},
+		{Scores: map[int]int{a: 0, b: 2, c: 1}},
+	}
+
+	results, err := countVotes(Election{CountMethod: COUNT_SCORE, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, MaxScore: 5, Candidates: candidates}, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	// a and b are tied with 5 points, but a got the highest score once
+	if diff := cmp.Diff(map[int]float64{a: 5, b: 5, c: 1}, results.Points); diff != "" {
+		t.Errorf("Unexpected score points: %s", diff)
+	}
+	if diff := cmp.Diff([]int{a, b, c}, results.Ranking); diff != "" {
+		t.Errorf("Unexpected score ranking: %s", diff)
+	}
+	if diff := cmp.Diff([]int{1, 1, 0, 0, 0, 0}, results.Distributions[c]); diff != "" {
+		t.Errorf("Unexpected score distribution: %s", diff)
+	}
+
+	poor, acceptable, good, excellent := 1, 2, 3, 5
+	votes = []Vote{
+		{Scores: map[int]int{a: good, b: good}},
+		{Scores: map[int]int{a: good, b: acceptable}},
+		{Scores: map[int]int{a: poor, b: excellent, c: excellent}},
+	}
+
+	results, err = countVotes(Election{CountMethod: COUNT_MAJORITY_JUDGMENT, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, Grades: DEFAULT_GRADES, Candidates: candidates}, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	// a and b have a good median, but b's second median is acceptable while a's is poor
+	if diff := cmp.Diff(map[int]float64{a: float64(good), b: float64(good), c: 0}, results.Points); diff != "" {
+		t.Errorf("Unexpected median grades: %s", diff)
+	}
+	if diff := cmp.Diff([]int{b}, results.Elected); diff != "" {
+		t.Errorf("Unexpected majority judgment winner: %s", diff)
+	}
+	if diff := cmp.Diff([]int{good, poor, good}, majorityGauge(results.Distributions[a])); diff != "" {
+		t.Errorf("Unexpected majority gauge: %s", diff)
+	}
+}
+
+func TestCountHighestAverages(t *testing.T) {
+	candidates := []Candidate{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}}
+	a, b, c := CandidateList{ID: 1, Candidates: []int{1, 2}}, CandidateList{ID: 2, Candidates: []int{3, 4, 5}}, CandidateList{ID: 3, Candidates: []int{6}}
+	var votes []Vote
+	for list, n := range map[int]int{a.ID: 10, b.ID: 6, c.ID: 3} {
+		for i := 0; i < n; i++ {
+			votes = append(votes, Vote{List: list})
+		}
+	}
+
+	for i, test := range []struct {
+		method     string
+		threshold  float64
+		totalSeats int // 5 when zero
+		seats      map[int]int
+		elected    []int
+	}{
+		// a runs out of candidates after two seats, so the seats it would have won go to the other lists
+		{method: COUNT_DHONDT, seats: map[int]int{a.ID: 2, b.ID: 2, c.ID: 1}, elected: []int{1, 2, 3, 4, 6}},
+		{method: COUNT_SAINTE_LAGUE, seats: map[int]int{a.ID: 2, b.ID: 2, c.ID: 1}, elected: []int{1, 2, 3, 4, 6}},
+		{method: COUNT_SAINTE_LAGUE, threshold: 20, seats: map[int]int{a.ID: 2, b.ID: 3, c.ID: 0}, elected: []int{1, 2, 3, 4, 5}},
+		{method: COUNT_DHONDT, totalSeats: 6, seats: map[int]int{a.ID: 2, b.ID: 3, c.ID: 1}, elected: []int{1, 2, 3, 4, 5, 6}},
+	} {
+		seats := test.totalSeats
+		if seats == 0 {
+			seats = 5
+		}
+		e := Election{CountMethod: test.method, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: seats, Threshold: test.threshold, Candidates: candidates, Lists: []CandidateList{a, b, c}}
+		results, err := countVotes(e, votes)
+		if err != nil {
+			t.Fatalf("[%d] Unexpected error counting votes: %s", i, err)
+		}
+
+		if diff := cmp.Diff(test.seats, results.ListSeats); diff != "" {
+			t.Errorf("[%d] Unexpected list seats: %s", i, diff)
+		}
+		if diff := cmp.Diff(test.elected, results.Elected); diff != "" {
+			t.Errorf("[%d] Unexpected elected candidates: %s", i, diff)
+		}
+	}
+}
+
+func TestValidateBallot(t *testing.T) {
+	available := map[int]struct{}{1: {}, 2: {}, 3: {}}
+	ranked := Election{BallotType: BALLOT_RANKED, CountMethod: COUNT_BORDA, MinCandidates: 1, MaxCandidates: 3}
+	condorcet := Election{BallotType: BALLOT_RANKED, CountMethod: COUNT_SCHULZE, MinCandidates: 1, MaxCandidates: 3}
+	approval := Election{BallotType: BALLOT_APPROVAL, CountMethod: COUNT_APPROVAL, MinCandidates: 0, MaxCandidates: 3}
+	plurality := Election{BallotType: BALLOT_PLURALITY, CountMethod: COUNT_PLURALITY, MinCandidates: 1, MaxCandidates: 1}
+	score := Election{BallotType: BALLOT_SCORE, CountMethod: COUNT_SCORE, MaxScore: 5, MinCandidates: 0, MaxCandidates: 3}
+	grades := Election{BallotType: BALLOT_GRADES, CountMethod: COUNT_MAJORITY_JUDGMENT, Grades: DEFAULT_GRADES, MinCandidates: 0, MaxCandidates: 3}
+	list := Election{BallotType: BALLOT_LIST, CountMethod: COUNT_DHONDT, Lists: []CandidateList{{ID: 7}}}
+	questions := ranked
+	questions.Questions = []Question{{ID: 4, Options: DEFAULT_QUESTION_OPTIONS}}
+
+	for i, test := range []struct {
+		e       Election
+		v       Vote
+		errorID int // zero when the ballot is valid
+	}{
+		{e: ranked, v: Vote{Candidates: []int{3, 1}}},
+		{e: ranked, v: Vote{Candidates: []int{3, 3, 3}}, errorID: 197},
+		{e: ranked, v: Vote{Candidates: []int{1, 2, 3, 1}}, errorID: 197},
+		{e: ranked, v: Vote{Candidates: []int{}}, errorID: 29},
+		{e: ranked, v: Vote{Candidates: []int{1, 4}}, errorID: 30},
+		{e: ranked, v: Vote{Ranks: map[int]int{1: 1, 2: 1}}, errorID: 194},
+		{e: ranked, v: Vote{Candidates: []int{1}, Scores: map[int]int{1: 3}}, errorID: 155},
+		{e: ranked, v: Vote{Candidates: []int{1}, List: 7}, errorID: 180},
+		{e: condorcet, v: Vote{Ranks: map[int]int{1: 1, 2: 1, 3: 2}}},
+		{e: condorcet, v: Vote{Ranks: map[int]int{1: 0}}, errorID: 196},
+		{e: condorcet, v: Vote{Candidates: []int{1}, Ranks: map[int]int{2: 1}}, errorID: 195},
+		{e: approval, v: Vote{Candidates: []int{2, 1}}},
+		{e: approval, v: Vote{Candidates: []int{2, 2}}, errorID: 145},
+		{e: approval, v: Vote{Ranks: map[int]int{1: 1}}, errorID: 193},
+		{e: plurality, v: Vote{Candidates: []int{2}}},
+		{e: plurality, v: Vote{Candidates: []int{2, 3}}, errorID: 144},
+		{e: score, v: Vote{Scores: map[int]int{1: 5, 2: 0}}},
+		{e: score, v: Vote{Scores: map[int]int{1: 6}}, errorID: 154},
+		{e: score, v: Vote{Candidates: []int{1}}, errorID: 153},
+		{e: grades, v: Vote{Scores: map[int]int{1: len(DEFAULT_GRADES) - 1}}},
+		{e: grades, v: Vote{Scores: map[int]int{1: len(DEFAULT_GRADES)}}, errorID: 154},
+		{e: list, v: Vote{List: 7}},
+		{e: list, v: Vote{List: 8}, errorID: 179},
+		{e: Election{BallotType: "unknown"}, v: Vote{}, errorID: 192},
+		{e: questions, v: Vote{Candidates: []int{1}, Answers: map[int]int{4: 2}}},
+		{e: questions, v: Vote{Candidates: []int{1}}, errorID: 245},
+		{e: questions, v: Vote{Candidates: []int{1}, Answers: map[int]int{5: 0}}, errorID: 246},
+		{e: questions, v: Vote{Candidates: []int{1}, Answers: map[int]int{4: 3}}, errorID: 247},
+		{e: ranked, v: Vote{Candidates: []int{1}, Answers: map[int]int{4: 0}}, errorID: 245},
+		{e: ranked, v: Vote{Blank: true}},
+		{e: ranked, v: Vote{Blank: true, Candidates: []int{1}}, errorID: 267},
+		{e: list, v: Vote{Blank: true, List: 7}, errorID: 267},
+		{e: questions, v: Vote{Blank: true}, errorID: 245},
+		{e: questions, v: Vote{Blank: true, Answers: map[int]int{4: 2}}},
+	} {
+		err := validateBallot(test.e, available, test.v)
+		if test.errorID == 0 && err != nil {
+			t.Errorf("[%d] Expected no error but got %q.", i, err)
+		} else if te, ok := err.(traceError); test.errorID != 0 && (!ok || te.id != test.errorID) {
+			t.Errorf("[%d] Expected error %d but got %v.", i, test.errorID, err)
+		}
+	}
+}
+
+func TestCountBlank(t *testing.T) {
+	a, b := 1, 2
+	votes := testVotes{
+		{n: 2, vote: []int{a}},
+		{n: 1, vote: []int{b}},
+	}.votes()
+	votes = append(votes, Vote{Blank: true})
+
+	e := Election{CountMethod: COUNT_PLURALITY, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1, Candidates: []Candidate{{ID: a}, {ID: b}}}
+	results, err := countVotes(e, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+	results.setTurnout(8)
+
+	if results.Ballots != 4 || results.Blank != 1 || results.BlankPercentage != 25 || results.Turnout != 50 {
+		t.Errorf("Expected 4 ballots, 1 blank, 25%% blank and 50%% turnout, but got %d, %d, %g%% and %g%%.",
+			results.Ballots, results.Blank, results.BlankPercentage, results.Turnout)
+	}
+
+	if diff := cmp.Diff(map[int]float64{a: 2, b: 1}, results.Points); diff != "" {
+		t.Errorf("Expected blank votes not to give points, but got: %s.", diff)
+	}
+}
+
+// TestBallotsUnlinkable casts ballots in the same transactions as the participations of the users, like CastVote does,
+// and checks that neither the ballot rows nor their order tell which user cast each one
+func TestRecountNotCounted(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Could not begin transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err := InitDB(tx); err != nil {
+		t.Fatalf("Could not initialize database: %s", err)
+	}
+	for _, candidates := range [][]int{{1, 2}, {1}, {2, 1}} {
+		hash, err := SafeID()
+		if err != nil {
+			t.Fatalf("Could not generate hash: %s", err)
+		}
+		if err := insertVote(tx, Vote{ElectionID: 1, Hash: hash, Candidates: candidates}); err != nil {
+			t.Fatalf("Could not insert vote: %s", err)
+		}
+	}
+
+	// voting closed but the count is held, so the candidates have no stored points to differ from the recount
+	e := Election{ID: 1, State: ELECTION_CLOSED, BallotType: BALLOT_RANKED, CountMethod: COUNT_BORDA, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 1,
+		MinCandidates: 1, MaxCandidates: 2, Candidates: []Candidate{{ID: 1}, {ID: 2}}}
+	var out bytes.Buffer
+	same, err := recountElection(tx, e, "", &out)
+	if err != nil {
+		t.Fatalf("Unexpected error recounting: %s", err)
+	}
+	if !same {
+		t.Errorf("Expected the recount of an election not counted yet to report no differences, but got:\n%s", out.String())
+	}
+}
+
+func TestMigrateUnversioned(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Could not begin transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	// the tables of the first release that changed since, with a user that voted, a counted election, one still
+	// voting and a draft
+	start, end := now().Add(-time.Hour), now().Add(time.Hour)
+	for _, stmt := range []string{
+		`CREATE TABLE users (id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, unique_id text UNIQUE NOT NULL,
+			email text UNIQUE NOT NULL, password TEXT NOT NULL, salt TEXT NOT NULL, role TEXT NOT NULL, has_voted BOOLEAN NOT NULL DEFAULT 0);`,
+		`CREATE TABLE elections (id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL,
+			date_start TIMESTAMP WITH TIME ZONE NOT NULL, date_end TIMESTAMP WITH TIME ZONE NOT NULL,
+			public BOOLEAN NOT NULL DEFAULT 0, counted BOOLEAN NOT NULL DEFAULT 0, count_method TEXT NOT NULL,
+			max_candidates INTEGER NOT NULL CHECK (max_candidates > 0), min_candidates INTEGER NOT NULL CHECK (min_candidates >= 0),
+			CHECK (max_candidates >= min_candidates));`,
+		`CREATE TABLE votes (id integer NOT NULL PRIMARY KEY AUTOINCREMENT, election_id INTEGER NOT NULL REFERENCES elections(id),
+			hash TEXT UNIQUE NOT NULL, candidates json NOT NULL);`,
+		`INSERT INTO users (name, unique_id, email, password, salt, role, has_voted) VALUES
+			('voter', '11111111H', 'voter@example.com', '', '', 'validated', 1),
+			('abstainer', '22222222J', 'abstainer@example.com', '', '', 'validated', 0);`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			t.Fatalf("Could not create old schema: %s", err)
+		}
+	}
+	for _, e := range []struct{ public, counted bool }{{true, true}, {true, false}, {false, false}} {
+		if _, err := tx.Exec("INSERT INTO elections (name, date_start, date_end, public, counted, count_method, max_candidates, min_candidates) VALUES ('old', ?, ?, ?, ?, ?, 2, 1);",
+			start, end, e.public, e.counted, COUNT_BORDA); err != nil {
+			t.Fatalf("Could not insert old election: %s", err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO votes (election_id, hash, candidates) VALUES (1, 'a', '[1]'), (2, 'b', '[2, 1]');`); err != nil {
+		t.Fatalf("Could not insert old votes: %s", err)
+	}
+
+	if err := InitDB(tx); err != nil {
+		t.Fatalf("Could not migrate database: %s", err)
+	}
+	if err := InitDB(tx); err != nil {
+		t.Fatalf("Could not initialize migrated database again: %s", err)
+	}
+
+	elections, err := getElections(tx, false)
+	if err != nil {
+		t.Fatalf("Could not get migrated elections: %s", err)
+	}
+	var states []string
+	for _, e := range elections {
+		states = append(states, e.State)
+		if e.TieBreakSeed == "" {
+			t.Errorf("Expected migrated election %d to have a tie break seed.", e.ID)
+		}
+	}
+	if diff := cmp.Diff([]string{ELECTION_RESULTS_PUBLISHED, ELECTION_NOMINATION, ELECTION_DRAFT}, states); diff != "" {
+		t.Errorf("Expected the states to follow from public and counted, but got: %s", diff)
+	}
+
+	votes, err := getVotes(tx, 2)
+	if err != nil {
+		t.Fatalf("Could not get migrated votes: %s", err)
+	}
+	if len(votes) != 1 || votes[0].Hash != "b" || fmt.Sprint(votes[0].Candidates) != "[2 1]" {
+		t.Errorf("Expected the ballot of election 2 to be kept, but got %+v.", votes)
+	}
+
+	participations, err := getUserParticipations(tx, 1)
+	if err != nil {
+		t.Fatalf("Could not get participations: %s", err)
+	}
+	if len(participations) != 1 || participations[0].ElectionID != 2 {
+		t.Errorf("Expected the user that voted to have voted in the open election, but got %+v.", participations)
+	}
+	if participations, err := getUserParticipations(tx, 2); err != nil || len(participations) != 0 {
+		t.Errorf("Expected the user that did not vote to have no participations, but got %+v, %v.", participations, err)
+	}
+
+	if _, err := tx.Exec("UPDATE schema_version SET version=?;", len(migrations)+1); err != nil {
+		t.Fatalf("Could not set schema version: %s", err)
+	}
+	if te, ok := InitDB(tx).(traceError); !ok || te.id != 484 {
+		t.Errorf("Expected a database newer than the server to be refused, but got %v.", te)
+	}
+}
+
+func TestBallotsUnlinkable(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // every connection to :memory: would get its own database
+
+	begin := func() *sql.Tx {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Could not begin transaction: %s", err)
+		}
+		return tx
+	}
+	commit := func(tx *sql.Tx) {
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Could not commit transaction: %s", err)
+		}
+		committed(tx)
+	}
+
+	tx := begin()
+	if err := InitDB(tx); err != nil {
+		t.Fatalf("Could not initialize database: %s", err)
+	}
+	// records the order in which ballots are written, as whoever watches the database would see it
+	if _, err := tx.Exec(`CREATE TABLE written (n INTEGER PRIMARY KEY AUTOINCREMENT, hash TEXT);
+		CREATE TRIGGER log_written AFTER INSERT ON votes BEGIN INSERT INTO written (hash) VALUES (NEW.hash); END;`); err != nil {
+		t.Fatalf("Could not create log of written ballots: %s", err)
+	}
+	commit(tx)
+
+	const electionID, voters = 1000, 4*BALLOT_BATCH_SIZE + 3
+	count := func(table string) int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table + ";").Scan(&n); err != nil {
+			t.Fatalf("Could not count %s: %s", table, err)
+		}
+		return n
+	}
+
+	var castOrder []string // hashes of the ballots in the order the users voted
+	for userID := 1; userID <= voters; userID++ {
+		hash, err := SafeID()
+		if err != nil {
+			t.Fatalf("Could not generate hash: %s", err)
+		}
+
+		tx := begin()
+		if err := insertParticipation(tx, Participation{UserID: userID, ElectionID: electionID, VotedAt: now()}); err != nil {
+			t.Fatalf("Could not insert participation: %s", err)
+		}
+		if err := queueBallot(tx, Vote{ElectionID: electionID, Hash: hash, Candidates: []int{userID}}); err != nil {
+			t.Fatalf("Could not queue vote: %s", err)
+		}
+		commit(tx)
+		castOrder = append(castOrder, hash)
+
+		// each participation is seen as soon as it is committed, but ballots only in whole batches
+		if n := count("participations"); n != userID {
+			t.Errorf("Expected %d participations after user %d voted, but got %d.", userID, userID, n)
+		}
+		if n := count("votes"); n != userID/BALLOT_BATCH_SIZE*BALLOT_BATCH_SIZE {
+			t.Errorf("Expected ballots to be written in batches of %d, but got %d after user %d voted.", BALLOT_BATCH_SIZE, n, userID)
+		}
+	}
+
+	tx = begin()
+	defer tx.Rollback()
+	if err := flushBallots(tx, electionID); err != nil {
+		t.Fatalf("Could not write queued ballots: %s", err)
+	}
+	if queued := queuedBallots(electionID); len(queued) != voters%BALLOT_BATCH_SIZE {
+		t.Errorf("Expected the last ballots to leave the queue only after commit, but got %d queued.", len(queued))
+	}
+
+	if _, err := tx.Query("SELECT rowid FROM votes;"); err == nil {
+		t.Errorf("Expected ballots to have no rowid, but got one.")
+	}
+
+	participations, err := getUserParticipations(tx, 1)
+	if err != nil {
+		t.Fatalf("Could not get participations: %s", err)
+	}
+	if day := now().UTC().Truncate(24 * time.Hour); len(participations) != 1 || !participations[0].VotedAt.Equal(day) {
+		t.Errorf("Expected the participation to keep only the day %s, but got %+v.", day, participations)
+	}
+
+	columns, err := queryDB(tx, func(rows *sql.Rows) (interface{}, error) {
+		var cid, notNull, pk int
+		var name, kind string
+		var def *string
+		err := rows.Scan(&cid, &name, &kind, &notNull, &def, &pk)
+		return kind, err
+	}, "PRAGMA table_info(votes);")
+	if err != nil {
+		t.Fatalf("Could not get columns of votes: %s", err)
+	}
+	for _, kind := range columns {
+		if strings.Contains(strings.ToUpper(kind.(string)), "TIME") {
+			t.Errorf("Expected ballots to have no timestamps, but got a %s column.", kind)
+		}
+	}
+
+	for _, query := range []string{"SELECT hash FROM votes;", "SELECT hash FROM votes ORDER BY id;", "SELECT hash FROM written ORDER BY n;"} {
+		hashes, err := queryDB(tx, func(rows *sql.Rows) (interface{}, error) {
+			var hash string
+			err := rows.Scan(&hash)
+			return hash, err
+		}, query)
+		if err != nil {
+			t.Fatalf("Could not get votes: %s", err)
+		}
+
+		if len(hashes) != len(castOrder) {
+			t.Fatalf("Expected %d ballots, but got %d.", len(castOrder), len(hashes))
+		}
+
+		same := true
+		for i := range hashes {
+			same = same && hashes[i].(string) == castOrder[i]
+		}
+		if same {
+			t.Errorf("Expected the order of %q not to follow the order in which users voted.", query)
+		}
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var leaves [][]byte
+		for i := 0; i < n; i++ {
+			leaves = append(leaves, hashMerkle(merkleLeafPrefix, []byte{byte(i)}))
+		}
+
+		root := hex.EncodeToString(merkleRoot(leaves))
+		for i := range leaves {
+			proof := merkleProof(leaves, i)
+			if err := verifier.VerifyInclusion(hex.EncodeToString(leaves[i]), proof, root); err != nil {
+				t.Errorf("Expected the proof of leaf %d of %d to verify, but got: %s", i, n, err)
+			}
+			other := hex.EncodeToString(hashMerkle(merkleLeafPrefix, []byte("other")))
+			if err := verifier.VerifyInclusion(other, proof, root); err != verifier.ErrNotIncluded {
+				t.Errorf("Expected the proof of leaf %d of %d not to verify another leaf, but got: %v", i, n, err)
+			}
+		}
+	}
+
+	if !bytes.Equal(merkleRoot(nil), hashMerkle(merkleLeafPrefix)) {
+		t.Errorf("Expected the root of an empty tree to be the hash of nothing.")
+	}
+}
+
+func TestBlindSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+
+	message := []byte("credential")
+	blinded, factor, err := blindMessage(&key.PublicKey, message)
+	if err != nil {
+		t.Fatalf("Could not blind message: %s", err)
+	}
+	if blinded.Cmp(fullDomainHash(&key.PublicKey, message)) == 0 {
+		t.Errorf("Expected the blinded message to differ from the hash of the message.")
+	}
+
+	blindSignature, err := blindSign(key, blinded)
+	if err != nil {
+		t.Fatalf("Could not sign blinded message: %s", err)
+	}
+
+	signature := unblindSignature(&key.PublicKey, blindSignature, factor)
+	if !verifyBlindSignature(&key.PublicKey, message, signature) {
+		t.Errorf("Expected the unblinded signature to verify.")
+	}
+	if verifyBlindSignature(&key.PublicKey, []byte("other credential"), signature) {
+		t.Errorf("Expected the signature not to verify another message.")
+	}
+	if verifyBlindSignature(&key.PublicKey, message, blindSignature) {
+		t.Errorf("Expected the blinded signature not to verify the message.")
+	}
+
+	if _, err := blindSign(key, key.N); err == nil {
+		t.Errorf("Expected an error signing a number out of range, but got none.")
+	}
+}
+
+func TestTallyDecryption(t *testing.T) {
+	secret, shares, err := splitSecret(3, 5)
+	if err != nil {
+		t.Fatalf("Could not split secret: %s", err)
+	}
+
+	key := new(big.Int).Exp(verifier.G, secret, verifier.P)
+	e := Election{ID: 1, BallotType: BALLOT_APPROVAL, MaxCandidates: 2, Candidates: []Candidate{{ID: 1}, {ID: 2}}, TallyKey: key.Text(16)}
+	candidates := map[int]struct{}{1: {}, 2: {}}
+	var votes []Vote
+	for _, marked := range [][]int{{1}, {}, {1, 2}, {1}} {
+		ballot, err := verifier.EncryptBallot(key, e.ID, []int{1, 2}, marked, 0, 2)
+		if err != nil {
+			t.Fatalf("Could not encrypt ballot: %s", err)
+		}
+		if err := validateEncryptedBallot(e, candidates, Vote{Encrypted: &ballot}); err != nil {
+			t.Errorf("Expected encrypted ballot to be valid, but got: %s", err)
+		}
+		votes = append(votes, Vote{Encrypted: &ballot})
+	}
+
+	if votes[0].Encrypted.Ciphertexts[1] == votes[3].Encrypted.Ciphertexts[1] {
+		t.Errorf("Expected the same marks to be encrypted differently.")
+	}
+
+	tally, err := tallyCiphertexts(e, votes)
+	if err != nil {
+		t.Fatalf("Could not tally ciphertexts: %s", err)
+	}
+
+	decrypt := func(candidate int, indexes ...int) (int, bool) {
+		partials := make(map[int]*big.Int, len(indexes))
+		for _, i := range indexes {
+			partial, err := verifier.PartialDecryption(shares[i-1], tally[candidate])
+			if err != nil {
+				t.Fatalf("Could not decrypt partially: %s", err)
+			}
+			partials[i] = partial
+		}
+		return combinePartials(tally[candidate], partials, len(votes))
+	}
+
+	for _, indexes := range [][]int{{1, 2, 3}, {2, 4, 5}, {1, 2, 3, 4, 5}} {
+		if m, ok := decrypt(1, indexes...); !ok || m != 3 {
+			t.Errorf("Expected 3 marks for candidate 1 with shares %v, but got %d (%t).", indexes, m, ok)
+		}
+		if m, ok := decrypt(2, indexes...); !ok || m != 1 {
+			t.Errorf("Expected 1 mark for candidate 2 with shares %v, but got %d (%t).", indexes, m, ok)
+		}
+	}
+
+	if _, ok := decrypt(1, 1, 5); ok {
+		t.Errorf("Expected the tally not to be decrypted with less shares than the quorum.")
+	}
+
+	tampered := *votes[0].Encrypted
+	tampered.Ciphertexts = map[int]verifier.Ciphertext{1: votes[0].Encrypted.Ciphertexts[1], 2: votes[2].Encrypted.Ciphertexts[2]}
+	if err := validateEncryptedBallot(e, candidates, Vote{Encrypted: &tampered}); err == nil {
+		t.Errorf("Expected an error validating a ballot with a ciphertext of another ballot, but got none.")
+	}
+
+	e.MaxCandidates = 1
+	if err := validateEncryptedBallot(e, candidates, votes[2]); err == nil {
+		t.Errorf("Expected an error validating a ballot with more marks than allowed, but got none.")
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var entries []AuditEntry
+	previous := ""
+	for i, action := range []string{"initialize", "validate_user", "publish_election"} {
+		a := AuditEntry{ID: i + 1, UserID: 1, Action: action, Params: []byte(`{"id":2}`), At: at.Add(time.Duration(i) * time.Minute), PreviousHash: previous}
+		hash, err := auditHash(a)
+		if err != nil {
+			t.Fatalf("Could not hash entry: %s", err)
+		}
+		a.Hash, previous = hash, hash
+		entries = append(entries, a)
+	}
+
+	if err := checkAuditChain(entries); err != nil {
+		t.Errorf("Expected the chain to be intact, but got: %s", err)
+	}
+
+	edited := append([]AuditEntry{}, entries...)
+	edited[1].UserID = 2
+	if err := checkAuditChain(edited); err == nil {
+		t.Errorf("Expected an error checking a chain with an edited entry, but got none.")
+	}
+
+	if err := checkAuditChain([]AuditEntry{entries[0], entries[2]}); err == nil {
+		t.Errorf("Expected an error checking a chain with a removed entry, but got none.")
+	}
+}
+
+func TestCountQuestions(t *testing.T) {
+	questions := []Question{{ID: 1, Options: DEFAULT_QUESTION_OPTIONS}, {ID: 2, Options: []string{"monday", "friday"}}}
+	votes := []Vote{
+		{Candidates: []int{1}, Answers: map[int]int{1: 0, 2: 1}},
+		{Candidates: []int{2}, Answers: map[int]int{1: 0, 2: 0}},
+		{Candidates: []int{1}, Answers: map[int]int{1: 2, 2: 1}},
+	}
+
+	expected := map[int][]int{1: {2, 0, 1}, 2: {1, 2}}
+	if diff := cmp.Diff(expected, countQuestions(questions, votes)); diff != "" {
+		t.Errorf("Expected no diff in question votes, but got: %s.", diff)
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	a, b, c := 1, 2, 3
+	candidates := []Candidate{{ID: a}, {ID: b}, {ID: c}}
+	// a and b both get 6 borda points, but only a is the first preference of some votes
+	votes := testVotes{
+		{n: 2, vote: []int{a}},
+		{n: 3, vote: []int{c, b}},
+	}.votes()
+
+	// with one seat the tie decides nothing, so it is not settled even when the admin would have to
+	e := Election{CountMethod: COUNT_BORDA, TieBreak: TIE_BREAK_MANUAL, Seats: 1, Candidates: candidates}
+	results, err := countVotes(e, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+	if len(results.Ties) != 0 || results.pendingTies() {
+		t.Errorf("Expected no ties below the last seat, got %v", results.Ties)
+	}
+	if diff := cmp.Diff([]int{c, a, b}, results.Ranking); diff != "" {
+		t.Errorf("Unexpected ranking: %s", diff)
+	}
+
+	e = Election{CountMethod: COUNT_BORDA, TieBreak: TIE_BREAK_FIRST_PREFERENCES, Seats: 2, Candidates: candidates}
+	results, err = countVotes(e, votes)
+	if err != nil {
+		t.Fatalf("Unexpected error counting votes: %s", err)
+	}
+
+	if diff := cmp.Diff([]int{c, a, b}, results.Ranking); diff != "" {
+		t.Errorf("Unexpected ranking: %s", diff)
+	}
+	if diff := cmp.Diff([]Tie{{Candidates: []int{a, b}, Order: []int{a, b}, Policy: TIE_BREAK_FIRST_PREFERENCES}}, results.Ties); diff != "" {
+		t.Errorf("Unexpected ties: %s", diff)
+	}
+
+	e.TieBreak, e.TieBreakSeed = TIE_BREAK_LOT, "seed"
+	results, _ = countVotes(e, votes)
+	again, _ := countVotes(e, votes)
+	if len(results.Ties) != 1 || results.Ties[0].Policy != TIE_BREAK_LOT {
+		t.Errorf("Expected a tie settled by lot, got %v", results.Ties)
+	} else if diff := cmp.Diff(results.Ties, again.Ties); diff != "" {
+		t.Errorf("The lot should give the same order with the same seed: %s", diff)
+	}
+
+	e.TieBreak = TIE_BREAK_MANUAL
+	results, _ = countVotes(e, votes)
+	if !results.pendingTies() || !results.pendingTie([]int{b, a}) {
+		t.Errorf("Expected a pending tie between %d and %d, got %v", a, b, results.Ties)
+	}
+
+	e.TieResolutions = [][]int{{b, a}}
+	results, _ = countVotes(e, votes)
+	if results.pendingTies() {
+		t.Errorf("Expected no pending ties, got %v", results.Ties)
+	}
+	if diff := cmp.Diff([]int{c, b, a}, results.Ranking); diff != "" {
+		t.Errorf("Unexpected ranking with the manual resolution: %s", diff)
+	}
+
+	// b and c are tied for exclusion in the first round, and the admin decides which one goes
+	votes = testVotes{
+		{n: 2, vote: []int{a}},
+		{n: 1, vote: []int{b, a}},
+		{n: 1, vote: []int{c, a}},
+	}.votes()
+	for _, resolution := range [][]int{{b, c}, {c, b}} {
+		e := Election{CountMethod: COUNT_IRV, TieBreak: TIE_BREAK_MANUAL, TieResolutions: [][]int{resolution}, Seats: 1, Candidates: candidates}
+		results, _ := countVotes(e, votes)
+		if excluded := results.Rounds[0].Excluded; len(excluded) != 1 || excluded[0] != resolution[1] {
+			t.Errorf("Expected candidate %d excluded, got %v", resolution[1], excluded)
+		}
+		if diff := cmp.Diff([]int{a}, results.Elected); diff != "" || results.pendingTies() {
+			t.Errorf("Unexpected elected candidates: %s", diff)
+		}
+	}
+}
+
 type testValidateID struct {
 	s             string
 	expectedError bool
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/oriolf/bella-ciao/verifier"
+)
+
+// leaves are hashed with a prefix that inner nodes do not use, so a leaf cannot be passed off as an inner node; the
+// verifier package hashes the inner nodes and checks the inclusion proofs
+var merkleLeafPrefix = []byte{0}
+
+// BulletinBoard lists every ballot of an election, superseded ones included, ordered by receipt hash, along with
+// the Merkle root over them. Whether a ballot is superseded is not part of its leaf, since a recast would otherwise
+// change the leaf signed in the receipt of the earlier ballot; the receipts of the superseded ballots are listed apart
+type BulletinBoard struct {
+	ElectionID int      `json:"election_id"`
+	Root       string   `json:"root"`
+	Ballots    []Vote   `json:"ballots"`
+	Superseded []string `json:"superseded"` // receipt hashes of the ballots left out of the count, in order
+}
+
+// InclusionProof lets a voter check that the ballot of a receipt is in the bulletin board with the given root
+type InclusionProof struct {
+	Root  string                `json:"root"`
+	Leaf  string                `json:"leaf"`
+	Index int                   `json:"index"`
+	Steps []verifier.MerkleStep `json:"steps"` // from the leaf up to the root
+}
+
+// newBulletinBoard sorts the ballots by receipt hash and computes their Merkle root
+func newBulletinBoard(electionID int, ballots []Vote) (BulletinBoard, error) {
+	sort.Slice(ballots, func(i, j int) bool { return ballots[i].Hash < ballots[j].Hash })
+	leaves, err := ballotLeaves(ballots)
+	if err != nil {
+		return BulletinBoard{}, wrapError(err, 314, "could not hash ballots")
+	}
+
+	superseded := []string{}
+	for _, v := range ballots {
+		if v.Superseded {
+			superseded = append(superseded, v.Hash)
+		}
+	}
+
+	return BulletinBoard{ElectionID: electionID, Root: hex.EncodeToString(merkleRoot(leaves)), Ballots: ballots, Superseded: superseded}, nil
+}
+
+// ballotsRoot returns the Merkle root over the ballots of the election as they are now
+func ballotsRoot(db *sql.Tx, electionID int) (string, error) {
+	ballots, err := getBallots(db, electionID)
+	if err != nil {
+		return "", wrapError(err, 478, "could not get ballots")
+	}
+
+	board, err := newBulletinBoard(electionID, ballots)
+	if err != nil {
+		return "", wrapError(err, 479, "could not build bulletin board")
+	}
+
+	return board.Root, nil
+}
+
+// inclusionProof returns the proof for the ballot with the receipt hash
+func (b BulletinBoard) inclusionProof(hash string) (InclusionProof, error) {
+	index := sort.Search(len(b.Ballots), func(i int) bool { return b.Ballots[i].Hash >= hash })
+	if index == len(b.Ballots) || b.Ballots[index].Hash != hash {
+		return InclusionProof{}, traceError{id: 315, message: "ballot not found in the bulletin board"}
+	}
+
+	leaves, err := ballotLeaves(b.Ballots)
+	if err != nil {
+		return InclusionProof{}, wrapError(err, 316, "could not hash ballots")
+	}
+
+	return InclusionProof{Root: b.Root, Leaf: hex.EncodeToString(leaves[index]), Index: index, Steps: merkleProof(leaves, index)}, nil
+}
+
+// ballotLeaf hashes what the voter cast, which does not change afterwards; the fields are marshalled in a fixed order
+// so anyone can hash them again
+func ballotLeaf(v Vote) ([]byte, error) {
+	content, err := json.Marshal(struct {
+		Hash       string      `json:"hash"`
+		Candidates []int       `json:"candidates"`
+		Scores     map[int]int `json:"scores"`
+		Ranks      map[int]int `json:"ranks"`
+		List       int         `json:"list"`
+		Answers    map[int]int `json:"answers"`
+		Blank      bool        `json:"blank"`
+		// left out of the ballots of elections that are not encrypted, so their leaves do not change
+		Encrypted *verifier.Ballot `json:"encrypted,omitempty"`
+	}{v.Hash, v.Candidates, v.Scores, v.Ranks, v.List, v.Answers, v.Blank, v.Encrypted})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashMerkle(merkleLeafPrefix, content), nil
+}
+
+func ballotLeaves(ballots []Vote) ([][]byte, error) {
+	leaves := make([][]byte, 0, len(ballots))
+	for _, v := range ballots {
+		leaf, err := ballotLeaf(v)
+		if err != nil {
+			return nil, wrapError(err, 317, "could not hash ballot %s", v.Hash)
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+func hashMerkle(prefix []byte, parts ...[]byte) []byte {
+	h := sha256.New()
+	h.Write(prefix)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// merkleLevel hashes the nodes in pairs; an odd node at the end goes up unchanged
+func merkleLevel(nodes [][]byte) [][]byte {
+	parents := make([][]byte, 0, (len(nodes)+1)/2)
+	for i := 0; i < len(nodes); i += 2 {
+		if i+1 == len(nodes) {
+			parents = append(parents, nodes[i])
+		} else {
+			parents = append(parents, verifier.HashMerkleNode(nodes[i], nodes[i+1]))
+		}
+	}
+	return parents
+}
+
+// merkleRoot returns the root of the tree over the leaves; the root of an empty tree is the hash of nothing
+func merkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return hashMerkle(merkleLeafPrefix)
+	}
+
+	nodes := leaves
+	for len(nodes) > 1 {
+		nodes = merkleLevel(nodes)
+	}
+	return nodes[0]
+}
+
+// merkleProof returns the siblings needed to go from the leaf at the index up to the root
+func merkleProof(leaves [][]byte, index int) []verifier.MerkleStep {
+	var proof []verifier.MerkleStep
+	nodes := leaves
+	for len(nodes) > 1 {
+		sibling := index ^ 1
+		if sibling < len(nodes) {
+			proof = append(proof, verifier.MerkleStep{Hash: hex.EncodeToString(nodes[sibling]), Left: sibling < index})
+		}
+		nodes, index = merkleLevel(nodes), index/2
+	}
+	return proof
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The schema_version table holds the version of the schema of the database. The create queries of the models give
+// the latest schema, so a new database starts at the latest version; an older one is brought up to date by the
+// migrations it has not run yet, since the create queries skip the tables it already has. Every change to an
+// existing table goes both to the create query of its model and to a new migration appended to the list.
+
+// migrations takes the database from the version of its index to the next one; databases created before the schema
+// had a version are at version zero
+var migrations = []func(*sql.Tx) error{
+	migrateUnversioned,
+}
+
+// SchemaVersion is the single row of the schema_version table
+type SchemaVersion struct {
+	Version int
+}
+
+func (v SchemaVersion) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER NOT NULL
+	);`
+}
+
+// migrateDB runs the migrations the database has not run yet, and records the version it gets to
+func migrateDB(db *sql.Tx, version int) error {
+	if version > len(migrations) {
+		return traceError{id: 484, message: fmt.Sprintf("database schema version %d is newer than this server, which knows up to %d", version, len(migrations))}
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := migrations[i](db); err != nil {
+			return wrapError(err, 485, "could not migrate database schema from version %d", i)
+		}
+	}
+
+	if _, err := db.Exec("DELETE FROM schema_version;"); err != nil {
+		return wrapError(err, 486, "could not clear schema version")
+	}
+	if _, err := db.Exec("INSERT INTO schema_version (version) VALUES (?);", len(migrations)); err != nil {
+		return wrapError(err, 487, "could not set schema version")
+	}
+
+	return nil
+}
+
+// getSchemaVersion returns the version of the schema of the database; the latest one when the database is new, and
+// zero when it was created before the schema had a version
+func getSchemaVersion(db *sql.Tx) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT version FROM schema_version;").Scan(&version)
+	if err == nil {
+		return version, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, wrapError(err, 488, "could not get schema version")
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='elections';").Scan(&tables); err != nil {
+		return 0, wrapError(err, 489, "could not check for existing tables")
+	}
+	if tables > 0 {
+		return 0, nil
+	}
+
+	return len(migrations), nil
+}
+
+// migrateUnversioned brings the schema of the first release up to the first versioned one. SQLite cannot drop
+// columns, so the public and counted columns of elections and has_voted of users are left unused; the state of each
+// election follows from them, and users that had voted keep from voting again in the elections still open
+func migrateUnversioned(db *sql.Tx) error {
+	for _, column := range []string{
+		"state TEXT NOT NULL DEFAULT 'draft'",
+		"state_changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT ''", // set below, a new column cannot lack a default
+		"results_embargo TIMESTAMP WITH TIME ZONE",
+		"ballot_type TEXT NOT NULL DEFAULT 'ranked'",
+		"seats INTEGER NOT NULL DEFAULT 1 CHECK (seats > 0)",
+		"max_score INTEGER NOT NULL DEFAULT 5 CHECK (max_score > 0)",
+		"grades json NOT NULL DEFAULT '[]'",
+		"threshold REAL NOT NULL DEFAULT 0 CHECK (threshold >= 0 AND threshold < 100)",
+		"truncation TEXT NOT NULL DEFAULT 'standard'",
+		"tie_break TEXT NOT NULL DEFAULT 'first_preferences'",
+		"tie_break_seed TEXT NOT NULL DEFAULT ''",
+		"tie_resolutions json NOT NULL DEFAULT '[]'",
+		"allow_recast BOOLEAN NOT NULL DEFAULT 0",
+		"blind_signatures BOOLEAN NOT NULL DEFAULT 0",
+		"encrypted BOOLEAN NOT NULL DEFAULT 0",
+		"trustees json NOT NULL DEFAULT '[]'",
+		"quorum INTEGER NOT NULL DEFAULT 0",
+		"tally_key TEXT NOT NULL DEFAULT ''",
+		"results json",
+	} {
+		if _, err := db.Exec("ALTER TABLE elections ADD COLUMN " + column + ";"); err != nil {
+			return wrapError(err, 490, "could not add election column %q", column)
+		}
+	}
+
+	// the results of counted elections were shown to everyone, and public ones not counted yet are moved on by the
+	// scheduler from nomination, through voting if it has not ended, to the count
+	if _, err := db.Exec("UPDATE elections SET state = CASE WHEN counted THEN ? WHEN public THEN ? ELSE ? END, state_changed_at=?;",
+		ELECTION_RESULTS_PUBLISHED, ELECTION_NOMINATION, ELECTION_DRAFT, now()); err != nil {
+		return wrapError(err, 491, "could not set election states")
+	}
+
+	ids, err := queryDB(db, func(rows *sql.Rows) (interface{}, error) {
+		var id int
+		err := rows.Scan(&id)
+		return id, err
+	}, "SELECT id FROM elections;")
+	if err != nil {
+		return wrapError(err, 492, "could not get elections")
+	}
+	for _, id := range ids {
+		seed, err := SafeID()
+		if err != nil {
+			return wrapError(err, 493, "could not generate tie break seed")
+		}
+		if err := updateOneRecord(db, "UPDATE elections SET tie_break_seed=? WHERE id=?;", seed, id); err != nil {
+			return wrapError(err, 494, "could not set tie break seed of election %d", id)
+		}
+	}
+
+	if _, err := db.Exec(`INSERT INTO participations (user_id, election_id, voted_at)
+		SELECT users.id, elections.id, ? FROM users, elections WHERE users.has_voted AND elections.public AND NOT elections.counted;`,
+		now().UTC().Truncate(24*time.Hour)); err != nil {
+		return wrapError(err, 495, "could not record participations")
+	}
+
+	return migrateUnversionedVotes(db)
+}
+
+// migrateUnversionedVotes moves the ballots to the current votes table, whose random ids do not tell the order in
+// which the ballots were cast as the old sequential ones did
+func migrateUnversionedVotes(db *sql.Tx) error {
+	if _, err := db.Exec("ALTER TABLE votes RENAME TO unversioned_votes;"); err != nil {
+		return wrapError(err, 496, "could not rename votes table")
+	}
+	if _, err := db.Exec(Vote{}.CreateTableQuery()); err != nil {
+		return wrapError(err, 497, "could not create votes table")
+	}
+
+	votes, err := queryDB(db, func(rows *sql.Rows) (interface{}, error) {
+		var v Vote
+		err := rows.Scan(&v.ElectionID, &v.Hash, &v.CandidatesString)
+		return v, err
+	}, "SELECT election_id, hash, candidates FROM unversioned_votes;")
+	if err != nil {
+		return wrapError(err, 498, "could not get votes")
+	}
+
+	for _, v := range votes {
+		id, err := SafeID()
+		if err != nil {
+			return wrapError(err, 499, "could not generate vote id")
+		}
+		v := v.(Vote)
+		if _, err := db.Exec("INSERT INTO votes (id, election_id, hash, candidates) VALUES (?, ?, ?, ?);",
+			id, v.ElectionID, v.Hash, v.CandidatesString); err != nil {
+			return wrapError(err, 500, "could not insert vote")
+		}
+	}
+
+	if _, err := db.Exec("DROP TABLE unversioned_votes;"); err != nil {
+		return wrapError(err, 501, "could not drop old votes table")
+	}
+
+	return nil
+}
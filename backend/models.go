@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/oriolf/bella-ciao/verifier"
 )
 
 type DBType interface {
@@ -16,10 +19,10 @@ type User struct {
 	Password string `json:"-"`
 	Salt     string `json:"-"`
 	Role     string `json:"role"`
-	HasVoted bool   `json:"has_voted"`
 
-	Files    []UserFile    `json:"files"`
-	Messages []UserMessage `json:"messages"`
+	Files          []UserFile      `json:"files"`
+	Messages       []UserMessage   `json:"messages"`
+	Participations []Participation `json:"participations"`
 }
 
 func (u User) CreateTableQuery() string {
@@ -30,8 +33,7 @@ func (u User) CreateTableQuery() string {
 		email text UNIQUE NOT NULL,
 		password TEXT NOT NULL,
 		salt TEXT NOT NULL,
-		role TEXT NOT NULL,
-		has_voted BOOLEAN NOT NULL DEFAULT 0
+		role TEXT NOT NULL
 	);`
 }
 
@@ -67,6 +69,23 @@ func (m UserMessage) CreateTableQuery() string {
 	);`
 }
 
+// Participation records that a user voted in an election, but not what the user voted; only the day of the vote is
+// kept, so the time of a participation cannot be matched with the ballots cast at that time
+type Participation struct {
+	UserID     int       `json:"-"`
+	ElectionID int       `json:"election_id"`
+	VotedAt    time.Time `json:"voted_at"` // midnight UTC of the day the user voted
+}
+
+func (p Participation) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS participations (
+		user_id integer NOT NULL REFERENCES users(id),
+		election_id integer NOT NULL REFERENCES elections(id),
+		voted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		PRIMARY KEY (user_id, election_id)
+	);`
+}
+
 type Config struct {
 	IDFormats []string
 
@@ -85,14 +104,47 @@ type Election struct {
 	Name    string    `json:"name"`
 	Start   time.Time `json:"start"`
 	End     time.Time `json:"end"`
-	Public  bool      `json:"public"`
-	Counted bool      `json:"counted"`
+	Public  bool      `json:"public"`  // follows from the state
+	Counted bool      `json:"counted"` // follows from the state
 
-	CountMethod   string `json:"count_method"`
-	MaxCandidates int    `json:"max_candidates"`
-	MinCandidates int    `json:"min_candidates"`
+	State          string    `json:"state"`
+	StateChangedAt time.Time `json:"state_changed_at"`
+	// when the results are published by the scheduler once counted, if the admin does not publish them before
+	ResultsEmbargo *time.Time `json:"results_embargo,omitempty"`
 
-	Candidates []Candidate `json:"candidates"`
+	BallotType    string   `json:"ballot_type"`
+	CountMethod   string   `json:"count_method"`
+	MaxCandidates int      `json:"max_candidates"`
+	MinCandidates int      `json:"min_candidates"`
+	Seats         int      `json:"seats"`
+	MaxScore      int      `json:"max_score"`
+	Grades        []string `json:"grades"`
+	Threshold     float64  `json:"threshold"`
+	Truncation    string   `json:"truncation"`
+
+	TieBreak       string  `json:"tie_break"`
+	TieBreakSeed   string  `json:"tie_break_seed"`
+	TieResolutions [][]int `json:"tie_resolutions"` // orders given by the admin to tied candidates, from best to worst
+
+	AllowRecast     bool `json:"allow_recast"`     // voters can vote again until the end, and only their last ballot counts
+	BlindSignatures bool `json:"blind_signatures"` // ballots are cast anonymously with a credential blindly signed before
+
+	// approval and plurality ballots are encrypted with the tally key, whose secret is split among the trustees; the
+	// count needs a quorum of them to decrypt the tally
+	Encrypted bool   `json:"encrypted"`
+	Trustees  []int  `json:"trustees,omitempty"`
+	Quorum    int    `json:"quorum,omitempty"`
+	TallyKey  string `json:"tally_key,omitempty"` // g^secret, hex encoded
+
+	Candidates []Candidate     `json:"candidates"`
+	Lists      []CandidateList `json:"lists"`
+	Questions  []Question      `json:"questions"`
+	Results    *CountResults   `json:"results"`
+
+	GradesString         string  `json:"-"`
+	TieResolutionsString string  `json:"-"`
+	TrusteesString       string  `json:"-"`
+	ResultsString        *string `json:"-"`
 }
 
 func (e Election) CreateTableQuery() string {
@@ -101,15 +153,246 @@ func (e Election) CreateTableQuery() string {
 		name TEXT NOT NULL,
 		date_start TIMESTAMP WITH TIME ZONE NOT NULL,
 		date_end TIMESTAMP WITH TIME ZONE NOT NULL,
-		public BOOLEAN NOT NULL DEFAULT 0,
-		counted BOOLEAN NOT NULL DEFAULT 0,
+		state TEXT NOT NULL DEFAULT 'draft',
+		state_changed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		results_embargo TIMESTAMP WITH TIME ZONE,
+		ballot_type TEXT NOT NULL DEFAULT 'ranked',
 		count_method TEXT NOT NULL,
 		max_candidates INTEGER NOT NULL CHECK (max_candidates > 0),
 		min_candidates INTEGER NOT NULL CHECK (min_candidates >= 0),
+		seats INTEGER NOT NULL DEFAULT 1 CHECK (seats > 0),
+		max_score INTEGER NOT NULL DEFAULT 5 CHECK (max_score > 0),
+		grades json NOT NULL DEFAULT '[]',
+		threshold REAL NOT NULL DEFAULT 0 CHECK (threshold >= 0 AND threshold < 100),
+		truncation TEXT NOT NULL DEFAULT 'standard',
+		tie_break TEXT NOT NULL DEFAULT 'first_preferences',
+		tie_break_seed TEXT NOT NULL DEFAULT '',
+		tie_resolutions json NOT NULL DEFAULT '[]',
+		allow_recast BOOLEAN NOT NULL DEFAULT 0,
+		blind_signatures BOOLEAN NOT NULL DEFAULT 0,
+		encrypted BOOLEAN NOT NULL DEFAULT 0,
+		trustees json NOT NULL DEFAULT '[]',
+		quorum INTEGER NOT NULL DEFAULT 0,
+		tally_key TEXT NOT NULL DEFAULT '',
+		results json,
 		CHECK (max_candidates >= min_candidates)
 	);`
 }
 
+// ElectionTransition records a change of state of an election, made by an admin or by the scheduler when UserID is
+// zero; extensions of the voting are recorded as transitions to the same state
+type ElectionTransition struct {
+	ID         int       `json:"id"`
+	ElectionID int       `json:"election_id"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	At         time.Time `json:"at"`
+	UserID     int       `json:"user_id"`
+	Reason     string    `json:"reason,omitempty"` // given by the admin when suspending, resuming, extending or closing voting
+	// Merkle root over the ballots when voting closed, set only on the transition to closed
+	BallotsRoot string `json:"ballots_root,omitempty"`
+}
+
+func (t ElectionTransition) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS election_transitions (
+		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		election_id INTEGER NOT NULL REFERENCES elections(id),
+		from_state TEXT NOT NULL,
+		to_state TEXT NOT NULL,
+		at TIMESTAMP WITH TIME ZONE NOT NULL,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		ballots_root TEXT NOT NULL DEFAULT ''
+	);`
+}
+
+// CountResults holds what the count of an election produced besides the points of each candidate
+type CountResults struct {
+	// ballots cast, and how many of them were blank; blank ballots are not given to the count method
+	Ballots         int     `json:"ballots"`
+	Blank           int     `json:"blank"`
+	BlankPercentage float64 `json:"blank_percentage"`
+	// validated users when the election was counted, and the percentage of them that voted
+	Electorate int     `json:"electorate,omitempty"`
+	Turnout    float64 `json:"turnout,omitempty"`
+
+	Points     map[int]float64 `json:"-"`
+	Elected    []int           `json:"elected,omitempty"`
+	Quota      float64         `json:"quota,omitempty"`
+	Rounds     []CountRound    `json:"rounds,omitempty"`
+	Truncation string          `json:"truncation,omitempty"` // how truncated ballots were counted by positional methods
+
+	// rows and columns of the pairwise matrices follow the order of MatrixCandidates
+	MatrixCandidates []int    `json:"matrix_candidates,omitempty"`
+	Pairwise         [][]int  `json:"pairwise,omitempty"`
+	StrongestPaths   [][]int  `json:"strongest_paths,omitempty"`
+	LockedPairs      [][2]int `json:"locked_pairs,omitempty"`
+	CondorcetWinner  int      `json:"condorcet_winner,omitempty"`
+
+	// votes and seats won by each list of candidates
+	ListVotes map[int]int `json:"list_votes,omitempty"`
+	ListSeats map[int]int `json:"list_seats,omitempty"`
+
+	// votes of each option of each question, in the order of the options
+	QuestionVotes map[int][]int `json:"question_votes,omitempty"`
+
+	// number of votes that gave each score or grade to each candidate, from the lowest to the highest
+	Distributions map[int][]int `json:"distributions,omitempty"`
+	Ranking       []int         `json:"ranking,omitempty"`
+
+	Ties []Tie `json:"ties,omitempty"`
+}
+
+// Tie is a set of candidates, or lists, with the same result when the count had to decide between them
+type Tie struct {
+	Candidates []int  `json:"candidates"`
+	Order      []int  `json:"order"`             // from best to worst
+	Policy     string `json:"policy"`            // the tie break policy that settled the tie
+	Pending    bool   `json:"pending,omitempty"` // waiting for the admin to give the order
+}
+
+// CountRound is a step of a count by rounds: the votes of each candidate at its start and the decision taken
+type CountRound struct {
+	Votes          map[int]float64 `json:"votes"`
+	Exhausted      float64         `json:"exhausted"`
+	NewlyExhausted float64         `json:"newly_exhausted"`
+	Quota          float64         `json:"quota,omitempty"`
+	KeepValues     map[int]float64 `json:"keep_values,omitempty"`
+	Elected        []int           `json:"elected,omitempty"`
+	Excluded       []int           `json:"excluded,omitempty"`
+	Surplus        float64         `json:"surplus,omitempty"`
+}
+
+// ElectionKey is the RSA key that blindly signs the voting credentials of an election, PKCS #1 DER encoded
+type ElectionKey struct {
+	ElectionID int    `json:"election_id"`
+	PrivateKey []byte `json:"-"`
+}
+
+func (k ElectionKey) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS election_keys (
+		election_id INTEGER NOT NULL PRIMARY KEY REFERENCES elections(id),
+		private_key BLOB NOT NULL
+	);`
+}
+
+// InstallationKey is the Ed25519 key that signs the receipts and results of the installation; there is only one
+type InstallationKey struct {
+	PrivateKey []byte `json:"-"`
+}
+
+func (k InstallationKey) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS installation_key (
+		id INTEGER NOT NULL PRIMARY KEY CHECK (id = 1),
+		private_key BLOB NOT NULL
+	);`
+}
+
+// SignedResults is the results document of a counted election, as it was signed with the installation key
+type SignedResults struct {
+	ElectionID int             `json:"election_id"`
+	Document   json.RawMessage `json:"document"`
+	Signature  string          `json:"signature"` // hex encoded
+}
+
+func (s SignedResults) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS signed_results (
+		election_id INTEGER NOT NULL PRIMARY KEY REFERENCES elections(id),
+		document json NOT NULL,
+		signature TEXT NOT NULL
+	);`
+}
+
+// UsedCredential is the hash of a voting credential that was already used to cast a ballot; like ballots, it has no
+// rowid, so the order of use is not kept
+type UsedCredential struct {
+	ElectionID int    `json:"election_id"`
+	Hash       string `json:"hash"`
+}
+
+func (c UsedCredential) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS used_credentials (
+		election_id INTEGER NOT NULL REFERENCES elections(id),
+		hash TEXT NOT NULL,
+		PRIMARY KEY (election_id, hash)
+	) WITHOUT ROWID;`
+}
+
+// TrusteeShare is the share of the secret of the tally key of an encrypted election given to a trustee, along with
+// g^share, which anyone can use to check what the trustee sends; the share is removed once the trustee takes it
+type TrusteeShare struct {
+	ElectionID   int     `json:"election_id"`
+	UserID       int     `json:"user_id"`
+	Index        int     `json:"index"` // the point of the polynomial of the shares, from 1
+	Share        *string `json:"share,omitempty"`
+	Verification string  `json:"verification"`
+}
+
+func (s TrusteeShare) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS trustee_shares (
+		election_id INTEGER NOT NULL REFERENCES elections(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		share_index INTEGER NOT NULL,
+		share TEXT,
+		verification TEXT NOT NULL,
+		PRIMARY KEY (election_id, user_id),
+		UNIQUE (election_id, share_index)
+	);`
+}
+
+// PartialDecryption is what a trustee sends to decrypt the tally of an encrypted election: the first part of the
+// tally of each candidate raised to the share of the trustee, hex encoded, with the proofs that it used the share of
+// its verification
+type PartialDecryption struct {
+	ElectionID   int                          `json:"election_id"`
+	Trustee      int                          `json:"trustee"` // index of the share
+	Values       map[int]string               `json:"values"`
+	Proofs       map[int]verifier.ProofBranch `json:"proofs"`
+	Verification string                       `json:"verification"` // g^share of the trustee
+
+	ValuesString string `json:"-"`
+	ProofsString string `json:"-"`
+}
+
+func (d PartialDecryption) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS partial_decryptions (
+		election_id INTEGER NOT NULL REFERENCES elections(id),
+		trustee INTEGER NOT NULL,
+		partials json NOT NULL,
+		proofs json NOT NULL,
+		PRIMARY KEY (election_id, trustee)
+	);`
+}
+
+// AuditEntry records an operation that changed the state of the installation: who made it, with which parameters
+// and when. Each entry holds the hash of the previous one, so changing or removing an entry breaks the chain
+type AuditEntry struct {
+	ID           int             `json:"id"`
+	UserID       int             `json:"user_id"` // zero when no user was logged in
+	Action       string          `json:"action"`
+	Params       json.RawMessage `json:"params"`
+	At           time.Time       `json:"at"`
+	PreviousHash string          `json:"previous_hash"` // empty for the first entry
+	Hash         string          `json:"hash"`
+}
+
+// the triggers keep the log append only, although only the chain tells whether the database file was edited
+func (a AuditEntry) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS audit_log (
+		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		action TEXT NOT NULL,
+		params json NOT NULL,
+		at TIMESTAMP WITH TIME ZONE NOT NULL,
+		previous_hash TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE
+	);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log is append only'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log is append only'); END;`
+}
+
 type Candidate struct {
 	ID           int     `json:"id"`
 	ElectionID   int     `json:"election_id"`
@@ -130,20 +413,88 @@ func (c Candidate) CreateTableQuery() string {
 	);`
 }
 
-type Vote struct {
+// CandidateList groups candidates that take the seats won by the list in order
+type CandidateList struct {
 	ID         int    `json:"id"`
 	ElectionID int    `json:"election_id"`
-	Hash       string `json:"hash"`
+	Name       string `json:"name"`
 	Candidates []int  `json:"candidates"`
+	Votes      int    `json:"votes"`
+	Seats      int    `json:"seats"`
+
+	CandidatesString string `json:"-"`
+}
+
+func (l CandidateList) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS lists (
+		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		election_id INTEGER NOT NULL REFERENCES elections(id),
+		name TEXT NOT NULL,
+		candidates json NOT NULL DEFAULT '[]',
+		votes INTEGER NOT NULL DEFAULT 0,
+		seats INTEGER NOT NULL DEFAULT 0
+	);`
+}
+
+// Question is a contest of an election besides the candidates race, where each ballot picks one of its options
+type Question struct {
+	ID         int      `json:"id"`
+	ElectionID int      `json:"election_id"`
+	Prompt     string   `json:"prompt"`
+	Options    []string `json:"options"`
+	Votes      []int    `json:"votes"` // votes of each option, once the election is counted
+
+	OptionsString string `json:"-"`
+	VotesString   string `json:"-"`
+}
+
+func (q Question) CreateTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS questions (
+		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		election_id INTEGER NOT NULL REFERENCES elections(id),
+		prompt TEXT NOT NULL,
+		options json NOT NULL,
+		votes json NOT NULL DEFAULT '[]'
+	);`
+}
+
+// Vote is a ballot; it has a random id, no timestamps and no rowid, so neither its id nor the order in which ballots
+// are stored tell when it was cast, or by whom
+type Vote struct {
+	ID         string      `json:"id"`
+	ElectionID int         `json:"election_id"`
+	Hash       string      `json:"hash"`
+	Candidates []int       `json:"candidates"`
+	Scores     map[int]int `json:"scores"`
+	Ranks      map[int]int `json:"ranks"` // rank of each candidate, from 1, when the ballot has equal rankings
+	List       int         `json:"list,omitempty"`
+	Answers    map[int]int `json:"answers"` // option picked in each question, by its position
+	Blank      bool        `json:"blank,omitempty"`
+	Superseded bool        `json:"superseded,omitempty"` // a later ballot of the same voter replaced it
+	Slot       string      `json:"-"`                    // hash of the slot credential shared by the ballots of a voter, when recasting is allowed
+	// the marks of each candidate in encrypted elections, with the proofs of the ballot; the candidates are left empty
+	Encrypted *verifier.Ballot `json:"encrypted,omitempty"`
 
 	CandidatesString string `json:"-"`
+	ScoresString     string `json:"-"`
+	RanksString      string `json:"-"`
+	AnswersString    string `json:"-"`
+	EncryptedString  string `json:"-"`
 }
 
 func (v Vote) CreateTableQuery() string {
 	return `CREATE TABLE IF NOT EXISTS votes (
-		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		id TEXT NOT NULL PRIMARY KEY,
 		election_id INTEGER NOT NULL REFERENCES elections(id),
 		hash TEXT UNIQUE NOT NULL,
-		candidates json NOT NULL
-	);`
+		candidates json NOT NULL,
+		scores json NOT NULL DEFAULT '{}',
+		ranks json NOT NULL DEFAULT '{}',
+		list_id INTEGER NOT NULL DEFAULT 0,
+		answers json NOT NULL DEFAULT '{}',
+		blank BOOLEAN NOT NULL DEFAULT 0,
+		slot TEXT NOT NULL DEFAULT '',
+		superseded BOOLEAN NOT NULL DEFAULT 0,
+		encrypted json NOT NULL DEFAULT 'null'
+	) WITHOUT ROWID;`
 }
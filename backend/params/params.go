@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/mail"
 	"strconv"
@@ -25,6 +26,7 @@ type params struct {
 	customValidator func(*http.Request) (interface{}, error)
 	validateFunc    func(Values) error
 	subParams       map[string]func(map[string]interface{}) (Values, error)
+	defaults        map[string]interface{}
 }
 
 type Values map[string]interface{}
@@ -35,6 +37,7 @@ func P(kind string) params {
 		valueKinds: make(map[string]string),
 		validators: make(map[string][]func(interface{}) (interface{}, error)),
 		subParams:  make(map[string]func(map[string]interface{}) (Values, error)),
+		defaults:   make(map[string]interface{}),
 	}
 }
 
@@ -50,6 +53,14 @@ func (p params) Int(name string, validators ...func(interface{}) (interface{}, e
 	return p.newParam("int", name, validators...)
 }
 
+func (p params) Float(name string, validators ...func(interface{}) (interface{}, error)) params {
+	return p.newParam("float", name, validators...)
+}
+
+func (p params) Bool(name string, validators ...func(interface{}) (interface{}, error)) params {
+	return p.newParam("bool", name, validators...)
+}
+
 func (p params) String(name string, validators ...func(interface{}) (interface{}, error)) params {
 	return p.newParam("string", name, validators...)
 }
@@ -62,6 +73,21 @@ func (p params) IntList(name string, validators ...func(interface{}) (interface{
 	return p.newParam("int_list", name, validators...)
 }
 
+// IntMap is a JSON object whose keys are ints, with an int value for each key
+func (p params) IntMap(name string, validators ...func(interface{}) (interface{}, error)) params {
+	return p.newParam("int_map", name, validators...)
+}
+
+// IntStringMap is a JSON object whose keys are ints, with a string value for each key
+func (p params) IntStringMap(name string, validators ...func(interface{}) (interface{}, error)) params {
+	return p.newParam("int_string_map", name, validators...)
+}
+
+// RawJSON is any JSON value, kept encoded so the handler can decode it into its own types
+func (p params) RawJSON(name string, validators ...func(interface{}) (interface{}, error)) params {
+	return p.newParam("raw_json", name, validators...)
+}
+
 func (p params) File(name string) params {
 	return p.newParam("file", name)
 }
@@ -88,6 +114,34 @@ func (p params) newParam(kind, name string, validators ...func(interface{}) (int
 	return p
 }
 
+// Default makes the parameter optional; when missing, value is used without running the validators
+func (p params) Default(name string, value interface{}) params {
+	p.defaults[name] = value
+	return p
+}
+
+// Copy returns params that can be extended without modifying the original ones
+func (p params) Copy() params {
+	c := p
+	c.valueKinds = make(map[string]string, len(p.valueKinds))
+	for k, v := range p.valueKinds {
+		c.valueKinds[k] = v
+	}
+	c.validators = make(map[string][]func(interface{}) (interface{}, error), len(p.validators))
+	for k, v := range p.validators {
+		c.validators[k] = append([]func(interface{}) (interface{}, error){}, v...)
+	}
+	c.subParams = make(map[string]func(map[string]interface{}) (Values, error), len(p.subParams))
+	for k, v := range p.subParams {
+		c.subParams[k] = v
+	}
+	c.defaults = make(map[string]interface{}, len(p.defaults))
+	for k, v := range p.defaults {
+		c.defaults[k] = v
+	}
+	return c
+}
+
 func (p params) ValidateFunc(f func(Values) error) params {
 	p.validateFunc = f
 	return p
@@ -138,6 +192,11 @@ func (p params) EndJSON() func(map[string]interface{}) (Values, error) {
 func (p params) endQueryParams(r *http.Request) (Values, error) {
 	vals := make(Values)
 	for name, kind := range p.valueKinds {
+		if d, ok := p.defaults[name]; ok && r.URL.Query().Get(name) == "" {
+			vals[name] = d
+			continue
+		}
+
 		switch kind {
 		case "int":
 			v, err := getQueryInt(r, p, name)
@@ -169,6 +228,13 @@ func (p params) endJsonParams(r *http.Request) (Values, error) {
 func (p params) endJsonParamsAux(m map[string]interface{}) (Values, error) {
 	vals := make(Values)
 	for name, kind := range p.valueKinds {
+		if d, ok := p.defaults[name]; ok {
+			if _, ok := m[name]; !ok {
+				vals[name] = d
+				continue
+			}
+		}
+
 		switch kind {
 		case "string":
 			v, ok := m[name]
@@ -231,6 +297,75 @@ func (p params) endJsonParamsAux(m map[string]interface{}) (Values, error) {
 				return nil, err
 			}
 			vals[name] = res
+		case "int_map":
+			v, ok := m[name]
+			if !ok {
+				return nil, errMissingParameter
+			}
+			o, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errWrongType
+			}
+			im := make(map[int]int, len(o))
+			for k, x := range o {
+				key, err := strconv.Atoi(k)
+				if err != nil {
+					return nil, errWrongType
+				}
+				y, ok := x.(float64)
+				if !ok || y != math.Trunc(y) {
+					return nil, errWrongType
+				}
+				im[key] = int(y)
+			}
+
+			res, err := checkValidators(im, name, p.validators)
+			if err != nil {
+				return nil, err
+			}
+			vals[name] = res
+		case "raw_json":
+			v, ok := m[name]
+			if !ok {
+				return nil, errMissingParameter
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, errWrongType
+			}
+
+			res, err := checkValidators(json.RawMessage(b), name, p.validators)
+			if err != nil {
+				return nil, err
+			}
+			vals[name] = res
+		case "int_string_map":
+			v, ok := m[name]
+			if !ok {
+				return nil, errMissingParameter
+			}
+			o, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errWrongType
+			}
+			sm := make(map[int]string, len(o))
+			for k, x := range o {
+				key, err := strconv.Atoi(k)
+				if err != nil {
+					return nil, errWrongType
+				}
+				y, ok := x.(string)
+				if !ok {
+					return nil, errWrongType
+				}
+				sm[key] = y
+			}
+
+			res, err := checkValidators(sm, name, p.validators)
+			if err != nil {
+				return nil, err
+			}
+			vals[name] = res
 		case "int":
 			v, ok := m[name]
 			if !ok {
@@ -246,6 +381,34 @@ func (p params) endJsonParamsAux(m map[string]interface{}) (Values, error) {
 				return nil, err
 			}
 			vals[name] = res
+		case "float":
+			v, ok := m[name]
+			if !ok {
+				return nil, errMissingParameter
+			}
+			f, ok := v.(float64)
+			if !ok {
+				return nil, errWrongType
+			}
+			res, err := checkValidators(f, name, p.validators)
+			if err != nil {
+				return nil, err
+			}
+			vals[name] = res
+		case "bool":
+			v, ok := m[name]
+			if !ok {
+				return nil, errMissingParameter
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, errWrongType
+			}
+			res, err := checkValidators(b, name, p.validators)
+			if err != nil {
+				return nil, err
+			}
+			vals[name] = res
 		case "time":
 			v, ok := m[name]
 			if !ok {
@@ -297,6 +460,16 @@ func (p params) endFormParams(r *http.Request) (Values, error) {
 	vals := make(Values)
 	for name, kind := range p.valueKinds {
 		switch kind {
+		case "int":
+			v, err := strconv.Atoi(r.FormValue(name))
+			if err != nil {
+				return nil, errWrongType
+			}
+			res, err := checkValidators(v, name, p.validators)
+			if err != nil {
+				return nil, err
+			}
+			vals[name] = res
 		case "string":
 			v := r.FormValue(name)
 			res, err := checkValidators(v, name, p.validators)
@@ -390,6 +563,34 @@ func (v Values) Int(name string) int {
 	return i
 }
 
+func (v Values) Bool(name string) bool {
+	x, ok := v[name]
+	if !ok {
+		panic(fmt.Sprintf("asked for unknown name %q", name))
+	}
+
+	b, ok := x.(bool)
+	if !ok {
+		panic(fmt.Sprintf("asked for wrong type, expected bool, got %T", x))
+	}
+
+	return b
+}
+
+func (v Values) Float(name string) float64 {
+	x, ok := v[name]
+	if !ok {
+		panic(fmt.Sprintf("asked for unknown name %q", name))
+	}
+
+	f, ok := x.(float64)
+	if !ok {
+		panic(fmt.Sprintf("asked for wrong type, expected float64, got %T", x))
+	}
+
+	return f
+}
+
 func (v Values) String(name string) string {
 	x, ok := v[name]
 	if !ok {
@@ -432,6 +633,48 @@ func (v Values) IntList(name string) []int {
 	return l
 }
 
+func (v Values) IntMap(name string) map[int]int {
+	x, ok := v[name]
+	if !ok {
+		panic(fmt.Sprintf("asked for unknown name %q", name))
+	}
+
+	m, ok := x.(map[int]int)
+	if !ok {
+		panic(fmt.Sprintf("asked for wrong type, expected int map, got %T", x))
+	}
+
+	return m
+}
+
+func (v Values) IntStringMap(name string) map[int]string {
+	x, ok := v[name]
+	if !ok {
+		panic(fmt.Sprintf("asked for unknown name %q", name))
+	}
+
+	m, ok := x.(map[int]string)
+	if !ok {
+		panic(fmt.Sprintf("asked for wrong type, expected int string map, got %T", x))
+	}
+
+	return m
+}
+
+func (v Values) RawJSON(name string) json.RawMessage {
+	x, ok := v[name]
+	if !ok {
+		panic(fmt.Sprintf("asked for unknown name %q", name))
+	}
+
+	m, ok := x.(json.RawMessage)
+	if !ok {
+		panic(fmt.Sprintf("asked for wrong type, expected raw json, got %T", x))
+	}
+
+	return m
+}
+
 func (v Values) Time(name string) time.Time {
 	x, ok := v[name]
 	if !ok {
@@ -480,6 +723,26 @@ func (v Values) Values(name string) Values {
 	return vv
 }
 
+// Without returns a copy of the values that leaves out the named ones, and every file along with its name
+func (v Values) Without(names ...string) Values {
+	c := make(Values, len(v))
+	for k, x := range v {
+		c[k] = x
+	}
+
+	for k, x := range v {
+		if _, ok := x.([]byte); ok {
+			names = append(names, k)
+		}
+	}
+
+	for _, name := range names {
+		delete(c, name)
+		delete(c, fileNameField(name))
+	}
+	return c
+}
+
 func fileNameField(name string) string {
 	return name + ";_;fileNameField"
 }
@@ -2,6 +2,7 @@ package par
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"testing"
@@ -51,6 +52,192 @@ func TestString(t *testing.T) {
 	assertPanic(t, func() { values.Int("invalid-name") })
 }
 
+func TestDefault(t *testing.T) {
+	body := bytes.NewReader([]byte(`{"a": "123"}`))
+	req, err := http.NewRequest("GET", "http://localhost", body)
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	pf := P("json").
+		String("a", MinLength(1)).
+		Int("b", PositiveInt).Default("b", 7).
+		Float("c").Default("c", 2.5).End()
+	values, err := pf(req)
+	if err != nil {
+		t.Errorf("Error parsing params: %s.", err)
+	}
+
+	a, b, c := values.String("a"), values.Int("b"), values.Float("c")
+	if a != "123" || b != 7 || c != 2.5 {
+		t.Errorf("Expected (\"123\", 7, 2.5), but got (%q, %d, %f).", a, b, c)
+	}
+
+	req, err = http.NewRequest("GET", "http://localhost?id=3", nil)
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+
+	pf = P("query").Int("id", PositiveInt).Int("page", PositiveInt).Default("page", 1).End()
+	values, err = pf(req)
+	if err != nil {
+		t.Errorf("Error parsing params: %s.", err)
+	}
+
+	if id, page := values.Int("id"), values.Int("page"); id != 3 || page != 1 {
+		t.Errorf("Expected (3, 1), but got (%d, %d).", id, page)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	base := P("json").String("a", MinLength(1))
+	extended := base.Copy().Int("b", PositiveInt)
+
+	req, err := http.NewRequest("GET", "http://localhost", bytes.NewReader([]byte(`{"a": "x"}`)))
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	if _, err := base.End()(req); err != nil {
+		t.Errorf("Extending a copy should not modify the original params, but got: %s.", err)
+	}
+
+	req, err = http.NewRequest("GET", "http://localhost", bytes.NewReader([]byte(`{"a": "x"}`)))
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	if _, err := extended.End()(req); err == nil {
+		t.Errorf("Expected an error for the missing parameter of the copy, but got none.")
+	}
+}
+
+func TestIntMap(t *testing.T) {
+	body := bytes.NewReader([]byte(`{"a": {"1": 5, "23": 0}}`))
+	req, err := http.NewRequest("GET", "http://localhost", body)
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	pf := P("json").IntMap("a").End()
+	values, err := pf(req)
+	if err != nil {
+		t.Errorf("Error parsing params: %s.", err)
+	}
+
+	a := values.IntMap("a")
+	if len(a) != 2 || a[1] != 5 || a[23] != 0 {
+		t.Errorf("Expected map[1:5 23:0], but got %v.", a)
+	}
+
+	body = bytes.NewReader([]byte(`{"a": {"x": 5}}`))
+	req, _ = http.NewRequest("GET", "http://localhost", body)
+	if _, err := pf(req); err == nil {
+		t.Errorf("Expected error parsing non int keys, but got none.")
+	}
+
+	body = bytes.NewReader([]byte(`{"a": {"1": 2.5}}`))
+	req, _ = http.NewRequest("GET", "http://localhost", body)
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := pf(req); err == nil {
+		t.Errorf("Expected error parsing non int values, but got none.")
+	}
+}
+
+func TestIntStringMap(t *testing.T) {
+	body := bytes.NewReader([]byte(`{"a": {"1": "x", "23": ""}}`))
+	req, err := http.NewRequest("GET", "http://localhost", body)
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	pf := P("json").IntStringMap("a").End()
+	values, err := pf(req)
+	if err != nil {
+		t.Errorf("Error parsing params: %s.", err)
+	}
+
+	a := values.IntStringMap("a")
+	if len(a) != 2 || a[1] != "x" || a[23] != "" {
+		t.Errorf("Expected map[1:x 23:], but got %v.", a)
+	}
+
+	body = bytes.NewReader([]byte(`{"a": {"1": 5}}`))
+	req, _ = http.NewRequest("GET", "http://localhost", body)
+	if _, err := pf(req); err == nil {
+		t.Errorf("Expected error parsing non string values, but got none.")
+	}
+}
+
+func TestRawJSON(t *testing.T) {
+	body := bytes.NewReader([]byte(`{"a": {"b": [1, "x"]}}`))
+	req, err := http.NewRequest("GET", "http://localhost", body)
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	pf := P("json").RawJSON("a").Default("a", json.RawMessage(nil)).End()
+	values, err := pf(req)
+	if err != nil {
+		t.Errorf("Error parsing params: %s.", err)
+	}
+
+	var a struct {
+		B []interface{} `json:"b"`
+	}
+	if err := json.Unmarshal(values.RawJSON("a"), &a); err != nil || len(a.B) != 2 || a.B[1] != "x" {
+		t.Errorf("Expected the raw value to decode to {b: [1, x]}, but got %v (%v).", a, err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	values, err = pf(req)
+	if err != nil || values.RawJSON("a") != nil {
+		t.Errorf("Expected the default nil value, but got %s (%v).", values.RawJSON("a"), err)
+	}
+}
+
+func TestWithout(t *testing.T) {
+	values := Values{"a": 1, "b": "x", "c": 2, "d": []byte("file"), fileNameField("d"): "file.txt"}
+
+	without := values.Without("b", "c")
+	if len(without) != 1 || without["a"] != 1 {
+		t.Errorf("Expected only a to be left, but got %v.", without)
+	}
+
+	if len(values) != 5 {
+		t.Errorf("Expected the original values to be left untouched, but got %v.", values)
+	}
+}
+
+func TestBool(t *testing.T) {
+	body := bytes.NewReader([]byte(`{"a": true}`))
+	req, err := http.NewRequest("GET", "http://localhost", body)
+	if err != nil {
+		t.Errorf("Could not define request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	pf := P("json").Bool("a").Bool("b").Default("b", false).End()
+	values, err := pf(req)
+	if err != nil {
+		t.Errorf("Error parsing params: %s.", err)
+	}
+
+	if a, b := values.Bool("a"), values.Bool("b"); !a || b {
+		t.Errorf("Expected (true, false), but got (%t, %t).", a, b)
+	}
+
+	body = bytes.NewReader([]byte(`{"a": "true"}`))
+	req, _ = http.NewRequest("GET", "http://localhost", body)
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := pf(req); err == nil {
+		t.Errorf("Expected error parsing non bool value, but got none.")
+	}
+}
+
 func TestCustom(t *testing.T) {
 	type p struct {
 		a int
@@ -16,19 +16,27 @@ type queriedUser struct {
 	Name            string
 	Email           string
 	Role            string
-	HasVoted        bool
 	FileID          *int
 	FileDescription *string
 	FileName        *string
 	MessageID       *int
 	MessageContent  *string
 	MessageSolved   *bool
+	ElectionID      *int
+	VotedAt         *string
 }
 
 func InitDB(db *sql.Tx) error {
-	// TODO write this as a list of "migrations"; add a table so the DB knows in which
-	// 		migration state it is; only execute migrations not yet executed; increaso
-	//		migration state every time a new migration element is executed
+	if _, err := db.Exec(SchemaVersion{}.CreateTableQuery()); err != nil {
+		return wrapError(err, 502, "could not create schema version table")
+	}
+
+	// read before creating the tables, so a new database is told apart from one older than the versions
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return wrapError(err, 503, "could not get schema version")
+	}
+
 	types := []DBType{
 		User{},
 		UserFile{},
@@ -36,7 +44,18 @@ func InitDB(db *sql.Tx) error {
 		Election{},
 		Config{},
 		Candidate{},
+		CandidateList{},
 		Vote{},
+		Participation{},
+		Question{},
+		ElectionTransition{},
+		ElectionKey{},
+		UsedCredential{},
+		TrusteeShare{},
+		PartialDecryption{},
+		AuditEntry{},
+		InstallationKey{},
+		SignedResults{},
 	}
 	for i, table := range types {
 		if _, err := db.Exec(table.CreateTableQuery()); err != nil {
@@ -44,19 +63,44 @@ func InitDB(db *sql.Tx) error {
 		}
 	}
 
-	return nil
+	return migrateDB(db, version)
 }
 
 // scan functions
 
 func scanElection(rows *sql.Rows) (interface{}, error) {
 	var e Election
-	var start, end string
-	err := rows.Scan(&e.ID, &e.Name, &start, &end, &e.CountMethod, &e.MaxCandidates, &e.MinCandidates, &e.Public, &e.Counted)
+	var start, end, stateChangedAt string
+	var resultsEmbargo *string
+	err := rows.Scan(&e.ID, &e.Name, &start, &end, &e.BallotType, &e.CountMethod, &e.MaxCandidates, &e.MinCandidates, &e.Seats,
+		&e.MaxScore, &e.GradesString, &e.Threshold, &e.Truncation, &e.TieBreak, &e.TieBreakSeed, &e.TieResolutionsString, &e.AllowRecast, &e.BlindSignatures,
+		&e.Encrypted, &e.TrusteesString, &e.Quorum, &e.TallyKey, &e.State, &stateChangedAt, &resultsEmbargo, &e.ResultsString)
 	if err != nil {
 		return nil, wrapError(err, 94, "could not scan")
 	}
 
+	if err := json.Unmarshal([]byte(e.GradesString), &e.Grades); err != nil {
+		return nil, wrapError(err, 149, "could not unmarshal grades")
+	}
+	e.GradesString = ""
+
+	if err := json.Unmarshal([]byte(e.TieResolutionsString), &e.TieResolutions); err != nil {
+		return nil, wrapError(err, 183, "could not unmarshal tie resolutions")
+	}
+	e.TieResolutionsString = ""
+
+	if err := json.Unmarshal([]byte(e.TrusteesString), &e.Trustees); err != nil {
+		return nil, wrapError(err, 380, "could not unmarshal trustees")
+	}
+	e.TrusteesString = ""
+
+	if e.ResultsString != nil {
+		if err := json.Unmarshal([]byte(*e.ResultsString), &e.Results); err != nil {
+			return nil, wrapError(err, 141, "could not unmarshal results")
+		}
+		e.ResultsString = nil
+	}
+
 	e.Start, err = time.Parse(SQLITE_TIME_FORMAT, start)
 	if err != nil {
 		return nil, wrapError(err, 95, "could not parse start")
@@ -67,12 +111,28 @@ func scanElection(rows *sql.Rows) (interface{}, error) {
 		return nil, wrapError(err, 96, "could not parse end")
 	}
 
+	e.StateChangedAt, err = time.Parse(SQLITE_TIME_FORMAT, stateChangedAt)
+	if err != nil {
+		return nil, wrapError(err, 276, "could not parse state changed at")
+	}
+
+	if resultsEmbargo != nil {
+		embargo, err := time.Parse(SQLITE_TIME_FORMAT, *resultsEmbargo)
+		if err != nil {
+			return nil, wrapError(err, 286, "could not parse results embargo")
+		}
+		e.ResultsEmbargo = &embargo
+	}
+
+	e.setElectionFlags()
+
 	return e, nil
 }
 
 func scanVote(rows *sql.Rows) (interface{}, error) {
 	var v Vote
-	err := rows.Scan(&v.ID, &v.ElectionID, &v.Hash, &v.CandidatesString)
+	err := rows.Scan(&v.ID, &v.ElectionID, &v.Hash, &v.CandidatesString, &v.ScoresString, &v.RanksString, &v.List, &v.AnswersString, &v.Blank,
+		&v.Slot, &v.Superseded, &v.EncryptedString)
 	if err != nil {
 		return nil, wrapError(err, 97, "could not scan")
 	}
@@ -81,10 +141,60 @@ func scanVote(rows *sql.Rows) (interface{}, error) {
 		return nil, wrapError(err, 98, "could not unmarshal candidates")
 	}
 
-	v.CandidatesString = ""
+	if err := json.Unmarshal([]byte(v.ScoresString), &v.Scores); err != nil {
+		return nil, wrapError(err, 150, "could not unmarshal scores")
+	}
+
+	if err := json.Unmarshal([]byte(v.RanksString), &v.Ranks); err != nil {
+		return nil, wrapError(err, 199, "could not unmarshal ranks")
+	}
+
+	if err := json.Unmarshal([]byte(v.AnswersString), &v.Answers); err != nil {
+		return nil, wrapError(err, 248, "could not unmarshal answers")
+	}
+
+	if err := json.Unmarshal([]byte(v.EncryptedString), &v.Encrypted); err != nil {
+		return nil, wrapError(err, 381, "could not unmarshal encrypted ballot")
+	}
+
+	v.CandidatesString, v.ScoresString, v.RanksString, v.AnswersString, v.EncryptedString = "", "", "", "", ""
 	return v, nil
 }
 
+func scanCandidateList(rows *sql.Rows) (interface{}, error) {
+	var l CandidateList
+	err := rows.Scan(&l.ID, &l.ElectionID, &l.Name, &l.CandidatesString, &l.Votes, &l.Seats)
+	if err != nil {
+		return nil, wrapError(err, 159, "could not scan")
+	}
+
+	if err := json.Unmarshal([]byte(l.CandidatesString), &l.Candidates); err != nil {
+		return nil, wrapError(err, 160, "could not unmarshal candidates")
+	}
+
+	l.CandidatesString = ""
+	return l, nil
+}
+
+func scanQuestion(rows *sql.Rows) (interface{}, error) {
+	var q Question
+	err := rows.Scan(&q.ID, &q.ElectionID, &q.Prompt, &q.OptionsString, &q.VotesString)
+	if err != nil {
+		return nil, wrapError(err, 249, "could not scan")
+	}
+
+	if err := json.Unmarshal([]byte(q.OptionsString), &q.Options); err != nil {
+		return nil, wrapError(err, 250, "could not unmarshal options")
+	}
+
+	if err := json.Unmarshal([]byte(q.VotesString), &q.Votes); err != nil {
+		return nil, wrapError(err, 251, "could not unmarshal votes")
+	}
+
+	q.OptionsString, q.VotesString = "", ""
+	return q, nil
+}
+
 func scanCandidate(rows *sql.Rows) (interface{}, error) {
 	var c Candidate
 	err := rows.Scan(&c.ID, &c.ElectionID, &c.Name, &c.Presentation, &c.Image, &c.Points)
@@ -93,7 +203,7 @@ func scanCandidate(rows *sql.Rows) (interface{}, error) {
 
 func scanQueriedUser(rows *sql.Rows) (interface{}, error) {
 	var u queriedUser
-	err := rows.Scan(&u.ID, &u.UniqueID, &u.Name, &u.Email, &u.Role, &u.HasVoted, &u.FileID, &u.FileDescription, &u.FileName, &u.MessageID, &u.MessageContent, &u.MessageSolved)
+	err := rows.Scan(&u.ID, &u.UniqueID, &u.Name, &u.Email, &u.Role, &u.FileID, &u.FileDescription, &u.FileName, &u.MessageID, &u.MessageContent, &u.MessageSolved, &u.ElectionID, &u.VotedAt)
 	return u, err
 }
 
@@ -105,7 +215,7 @@ func scanCount(rows *sql.Rows) (interface{}, error) {
 
 func scanUser(rows *sql.Rows) (interface{}, error) {
 	var u User
-	err := rows.Scan(&u.ID, &u.UniqueID, &u.Name, &u.Email, &u.Role, &u.HasVoted)
+	err := rows.Scan(&u.ID, &u.UniqueID, &u.Name, &u.Email, &u.Role)
 	return u, err
 }
 
@@ -121,6 +231,73 @@ func scanUserMessage(rows *sql.Rows) (interface{}, error) {
 	return m, err
 }
 
+func scanParticipation(rows *sql.Rows) (interface{}, error) {
+	var p Participation
+	var votedAt string
+	if err := rows.Scan(&p.UserID, &p.ElectionID, &votedAt); err != nil {
+		return nil, wrapError(err, 242, "could not scan")
+	}
+
+	var err error
+	p.VotedAt, err = time.Parse(SQLITE_TIME_FORMAT, votedAt)
+	if err != nil {
+		return nil, wrapError(err, 243, "could not parse voted at")
+	}
+
+	return p, nil
+}
+
+func scanElectionTransition(rows *sql.Rows) (interface{}, error) {
+	var t ElectionTransition
+	var at string
+	if err := rows.Scan(&t.ID, &t.ElectionID, &t.From, &t.To, &at, &t.UserID, &t.Reason, &t.BallotsRoot); err != nil {
+		return nil, wrapError(err, 277, "could not scan")
+	}
+
+	var err error
+	t.At, err = time.Parse(SQLITE_TIME_FORMAT, at)
+	if err != nil {
+		return nil, wrapError(err, 278, "could not parse at")
+	}
+
+	return t, nil
+}
+
+func scanAuditEntry(rows *sql.Rows) (interface{}, error) {
+	var a AuditEntry
+	var params, at string
+	if err := rows.Scan(&a.ID, &a.UserID, &a.Action, &params, &at, &a.PreviousHash, &a.Hash); err != nil {
+		return nil, wrapError(err, 428, "could not scan")
+	}
+
+	var err error
+	a.At, err = time.Parse(SQLITE_TIME_FORMAT, at)
+	if err != nil {
+		return nil, wrapError(err, 429, "could not parse at")
+	}
+
+	a.Params = json.RawMessage(params)
+	return a, nil
+}
+
+func scanPartialDecryption(rows *sql.Rows) (interface{}, error) {
+	var d PartialDecryption
+	if err := rows.Scan(&d.ElectionID, &d.Trustee, &d.ValuesString, &d.ProofsString, &d.Verification); err != nil {
+		return nil, wrapError(err, 387, "could not scan")
+	}
+
+	if err := json.Unmarshal([]byte(d.ValuesString), &d.Values); err != nil {
+		return nil, wrapError(err, 388, "could not unmarshal partial decryption")
+	}
+
+	if err := json.Unmarshal([]byte(d.ProofsString), &d.Proofs); err != nil {
+		return nil, wrapError(err, 473, "could not unmarshal partial decryption proofs")
+	}
+
+	d.ValuesString, d.ProofsString = "", ""
+	return d, nil
+}
+
 func scanID(rows *sql.Rows) (interface{}, error) {
 	var id int
 	err := rows.Scan(&id)
@@ -178,6 +355,10 @@ func countElections(db *sql.Tx) (int, error) {
 	return countDB(db, "SELECT COUNT(1) FROM elections;")
 }
 
+func countValidatedUsers(db *sql.Tx) (int, error) {
+	return countDB(db, "SELECT COUNT(1) FROM users WHERE role != ?;", ROLE_NONE)
+}
+
 func countAdminUsers(db *sql.Tx) (int, error) {
 	return countDB(db, "SELECT COUNT(1) FROM users WHERE role LIKE ?;", ROLE_ADMIN)
 }
@@ -196,11 +377,57 @@ func registerUser(db *sql.Tx, user User, role string) error {
 	return err
 }
 
-func createElection(db *sql.Tx, e Election) error {
-	query := `INSERT INTO elections (name, date_start, date_end, public, count_method, max_candidates, min_candidates) 
-              VALUES (?, ?, ?, ?, ?, ?, ?);`
-	_, err := db.Exec(query, e.Name, e.Start, e.End, false, e.CountMethod, e.MaxCandidates, e.MinCandidates)
-	return err
+// createElection inserts the election as a draft, and returns its id
+func createElection(db *sql.Tx, e Election) (int, error) {
+	grades, err := json.Marshal(e.Grades)
+	if err != nil {
+		return 0, wrapError(err, 151, "could not marshal grades")
+	}
+
+	trustees, err := json.Marshal(e.Trustees)
+	if err != nil {
+		return 0, wrapError(err, 382, "could not marshal trustees")
+	}
+
+	query := `INSERT INTO elections (name, date_start, date_end, state, state_changed_at, results_embargo, ballot_type, count_method, max_candidates, min_candidates, seats, max_score, grades, threshold, truncation, tie_break, tie_break_seed, allow_recast, blind_signatures, encrypted, trustees, quorum) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	res, err := db.Exec(query, e.Name, e.Start, e.End, ELECTION_DRAFT, now(), e.ResultsEmbargo, e.BallotType, e.CountMethod, e.MaxCandidates, e.MinCandidates, e.Seats, e.MaxScore, string(grades), e.Threshold,
+		e.Truncation, e.TieBreak, e.TieBreakSeed, e.AllowRecast, e.BlindSignatures, e.Encrypted, string(trustees), e.Quorum)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func updateElection(db *sql.Tx, e Election) error {
+	grades, err := json.Marshal(e.Grades)
+	if err != nil {
+		return wrapError(err, 215, "could not marshal grades")
+	}
+
+	trustees, err := json.Marshal(e.Trustees)
+	if err != nil {
+		return wrapError(err, 383, "could not marshal trustees")
+	}
+
+	return updateOneRecord(db, `UPDATE elections SET name=?, date_start=?, date_end=?, results_embargo=?, ballot_type=?, count_method=?, max_candidates=?,
+		min_candidates=?, seats=?, max_score=?, grades=?, threshold=?, truncation=?, tie_break=?, tie_break_seed=?, allow_recast=?,
+		blind_signatures=?, encrypted=?, trustees=?, quorum=? WHERE id=?;`,
+		e.Name, e.Start, e.End, e.ResultsEmbargo, e.BallotType, e.CountMethod, e.MaxCandidates, e.MinCandidates, e.Seats, e.MaxScore, string(grades), e.Threshold,
+		e.Truncation, e.TieBreak, e.TieBreakSeed, e.AllowRecast, e.BlindSignatures, e.Encrypted, string(trustees), e.Quorum, e.ID)
+}
+
+// deleteElection deletes the election along with its votes, lists and candidates
+func deleteElection(db *sql.Tx, electionID int) error {
+	for _, table := range []string{"signed_results", "partial_decryptions", "trustee_shares", "used_credentials", "election_keys", "election_transitions", "participations", "votes", "questions", "lists", "candidates"} {
+		if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE election_id=?;", table), electionID); err != nil {
+			return wrapError(err, 216, "could not delete from %s", table)
+		}
+	}
+
+	return updateOneRecord(db, "DELETE FROM elections WHERE id=?;", electionID)
 }
 
 func createConfig(db *sql.Tx, c Config) error {
@@ -237,15 +464,15 @@ func getConfig(db *sql.Tx) (c Config, err error) {
 }
 
 func getUser(db *sql.Tx, userID int) (user User, err error) {
-	err = db.QueryRow("SELECT unique_id, name, email, password, salt, role, has_voted FROM users WHERE id=?;", userID).Scan(
-		&user.UniqueID, &user.Name, &user.Email, &user.Password, &user.Salt, &user.Role, &user.HasVoted)
+	err = db.QueryRow("SELECT unique_id, name, email, password, salt, role FROM users WHERE id=?;", userID).Scan(
+		&user.UniqueID, &user.Name, &user.Email, &user.Password, &user.Salt, &user.Role)
 	user.ID = userID
 	return user, err
 }
 
 func getUserFromUniqueID(db *sql.Tx, uniqueID string) (user User, err error) {
-	err = db.QueryRow("SELECT id, name, email, password, salt, role, has_voted FROM users WHERE unique_id LIKE ?;", uniqueID).Scan(
-		&user.ID, &user.Name, &user.Email, &user.Password, &user.Salt, &user.Role, &user.HasVoted)
+	err = db.QueryRow("SELECT id, name, email, password, salt, role FROM users WHERE unique_id LIKE ?;", uniqueID).Scan(
+		&user.ID, &user.Name, &user.Email, &user.Password, &user.Salt, &user.Role)
 	user.UniqueID = uniqueID
 	return user, err
 }
@@ -309,12 +536,14 @@ func getUsers(db *sql.Tx, where, query string, limit, offset int) (response getU
 		return getUsersResponse{}, wrapError(err, 110, "could not count users")
 	}
 
-	sql := fmt.Sprintf(`SELECT users.id, users.unique_id, users.name, users.email, users.role, users.has_voted,
+	sql := fmt.Sprintf(`SELECT users.id, users.unique_id, users.name, users.email, users.role,
 	files.id, files.description, files.name, 
-	messages.id, messages.content, messages.solved
+	messages.id, messages.content, messages.solved,
+	participations.election_id, participations.voted_at
 	FROM (SELECT * FROM users WHERE %s ORDER BY unique_id ASC LIMIT %d OFFSET %d) AS users 
 	LEFT JOIN files ON users.id=files.user_id 
-	LEFT JOIN messages ON users.id=messages.user_id;`, where, limit, offset)
+	LEFT JOIN messages ON users.id=messages.user_id
+	LEFT JOIN participations ON users.id=participations.user_id;`, where, limit, offset)
 
 	var res []interface{}
 	if query != "" {
@@ -335,7 +564,7 @@ func getUsers(db *sql.Tx, where, query string, limit, offset int) (response getU
 
 		u, ok := m[y.ID]
 		if !ok {
-			u = User{ID: y.ID, UniqueID: y.UniqueID, Name: y.Name, Email: y.Email, HasVoted: y.HasVoted}
+			u = User{ID: y.ID, UniqueID: y.UniqueID, Name: y.Name, Email: y.Email}
 		}
 		if y.FileID != nil && y.FileDescription != nil && y.FileName != nil {
 			if missingFile(*y.FileID, u.Files) {
@@ -347,6 +576,15 @@ func getUsers(db *sql.Tx, where, query string, limit, offset int) (response getU
 				u.Messages = append(u.Messages, UserMessage{ID: *y.MessageID, Content: *y.MessageContent, Solved: *y.MessageSolved})
 			}
 		}
+		if y.ElectionID != nil && y.VotedAt != nil {
+			if missingParticipation(*y.ElectionID, u.Participations) {
+				votedAt, err := time.Parse(SQLITE_TIME_FORMAT, *y.VotedAt)
+				if err != nil {
+					return getUsersResponse{}, wrapError(err, 244, "could not parse voted at")
+				}
+				u.Participations = append(u.Participations, Participation{UserID: y.ID, ElectionID: *y.ElectionID, VotedAt: votedAt})
+			}
+		}
 		m[y.ID] = u
 	}
 
@@ -386,9 +624,23 @@ func validateUser(db *sql.Tx, userID int) error {
 	return updateOneRecord(db, "UPDATE users SET role=? WHERE role=? AND id=?;", ROLE_VALIDATED, ROLE_NONE, userID)
 }
 
-func getCandidates(db *sql.Tx, electionID int) ([]interface{}, error) {
-	return queryDB(db, scanCandidate, `SELECT id, election_id, name, presentation, image, points
+func makeAuditor(db *sql.Tx, userID int) error {
+	return updateOneRecord(db, "UPDATE users SET role=? WHERE role=? AND id=?;", ROLE_AUDITOR, ROLE_VALIDATED, userID)
+}
+
+func getCandidates(db *sql.Tx, electionID int) ([]Candidate, error) {
+	results, err := queryDB(db, scanCandidate, `SELECT id, election_id, name, presentation, image, points
 	FROM candidates WHERE election_id = ? ORDER BY random();`, electionID)
+	if err != nil {
+		return nil, wrapError(err, 297, "could not select")
+	}
+
+	candidates := make([]Candidate, 0, len(results))
+	for _, x := range results {
+		candidates = append(candidates, x.(Candidate))
+	}
+
+	return candidates, nil
 }
 
 func getCandidatesFromIDs(db *sql.Tx, ids []int) ([]Candidate, error) {
@@ -437,10 +689,15 @@ func getCandidate(db *sql.Tx, candidateID int) (Candidate, error) {
 	return c, err
 }
 
-func addCandidate(db *sql.Tx, c Candidate) error {
-	query := "INSERT INTO candidates (election_id, name, presentation, image) VALUES (1, ?, ?, ?);"
-	_, err := db.Exec(query, c.Name, c.Presentation, c.Image)
-	return err
+func addCandidate(db *sql.Tx, c Candidate) (int, error) {
+	query := "INSERT INTO candidates (election_id, name, presentation, image) VALUES (?, ?, ?, ?);"
+	res, err := db.Exec(query, c.ElectionID, c.Name, c.Presentation, c.Image)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
 }
 
 func deleteCandidate(db *sql.Tx, id int) error {
@@ -448,10 +705,141 @@ func deleteCandidate(db *sql.Tx, id int) error {
 	return err
 }
 
+func getLists(db *sql.Tx, electionID int) ([]CandidateList, error) {
+	results, err := queryDB(db, scanCandidateList, `SELECT id, election_id, name, candidates, votes, seats
+	FROM lists WHERE election_id = ? ORDER BY id;`, electionID)
+	if err != nil {
+		return nil, wrapError(err, 162, "could not query lists")
+	}
+
+	lists := make([]CandidateList, 0, len(results))
+	for _, x := range results {
+		lists = append(lists, x.(CandidateList))
+	}
+
+	return lists, nil
+}
+
+func getList(db *sql.Tx, listID int) (CandidateList, error) {
+	results, err := queryDB(db, scanCandidateList, `SELECT id, election_id, name, candidates, votes, seats
+	FROM lists WHERE id = ?;`, listID)
+	if err != nil {
+		return CandidateList{}, wrapError(err, 163, "could not query list")
+	}
+
+	if len(results) != 1 {
+		return CandidateList{}, wrapError(nil, 164, "expected 1 list, got %d", len(results))
+	}
+
+	return results[0].(CandidateList), nil
+}
+
+func addList(db *sql.Tx, l CandidateList) (int, error) {
+	res, err := db.Exec("INSERT INTO lists (election_id, name) VALUES (?, ?);", l.ElectionID, l.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func deleteList(db *sql.Tx, id int) error {
+	return updateOneRecord(db, "DELETE FROM lists WHERE id=?;", id)
+}
+
+func setListCandidates(db *sql.Tx, listID int, candidates []int) error {
+	b, err := json.Marshal(candidates)
+	if err != nil {
+		return wrapError(err, 165, "could not marshal candidates")
+	}
+
+	return updateOneRecord(db, "UPDATE lists SET candidates=? WHERE id=?;", string(b), listID)
+}
+
+func getQuestions(db *sql.Tx, electionID int) ([]Question, error) {
+	results, err := queryDB(db, scanQuestion, `SELECT id, election_id, prompt, options, votes
+	FROM questions WHERE election_id = ? ORDER BY id;`, electionID)
+	if err != nil {
+		return nil, wrapError(err, 252, "could not query questions")
+	}
+
+	questions := make([]Question, 0, len(results))
+	for _, x := range results {
+		questions = append(questions, x.(Question))
+	}
+
+	return questions, nil
+}
+
+func getQuestion(db *sql.Tx, questionID int) (Question, error) {
+	results, err := queryDB(db, scanQuestion, `SELECT id, election_id, prompt, options, votes
+	FROM questions WHERE id = ?;`, questionID)
+	if err != nil {
+		return Question{}, wrapError(err, 253, "could not query question")
+	}
+
+	if len(results) != 1 {
+		return Question{}, wrapError(nil, 254, "expected 1 question, got %d", len(results))
+	}
+
+	return results[0].(Question), nil
+}
+
+func addQuestion(db *sql.Tx, q Question) (int, error) {
+	options, err := json.Marshal(q.Options)
+	if err != nil {
+		return 0, wrapError(err, 255, "could not marshal options")
+	}
+
+	res, err := db.Exec("INSERT INTO questions (election_id, prompt, options) VALUES (?, ?, ?);", q.ElectionID, q.Prompt, string(options))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func deleteQuestion(db *sql.Tx, id int) error {
+	return updateOneRecord(db, "DELETE FROM questions WHERE id=?;", id)
+}
+
+func updateQuestionVotes(db *sql.Tx, questionID int, votes []int) error {
+	b, err := json.Marshal(votes)
+	if err != nil {
+		return wrapError(err, 256, "could not marshal votes")
+	}
+
+	return updateOneRecord(db, "UPDATE questions SET votes=? WHERE id=?;", string(b), questionID)
+}
+
+func updateListResults(db *sql.Tx, listID, votes, seats int) error {
+	return updateOneRecord(db, "UPDATE lists SET votes=?, seats=? WHERE id=?;", votes, seats, listID)
+}
+
 func getElections(db *sql.Tx, onlyPublic bool) ([]Election, error) {
-	results, err := queryDB(db, scanElection, `
-		SELECT id, name, date_start, date_end, count_method, max_candidates, min_candidates, public, counted
-		FROM elections WHERE public OR public = ? ORDER BY date_start ASC;`, onlyPublic)
+	return queryElections(db, "state != ? OR ?", ELECTION_DRAFT, !onlyPublic)
+}
+
+func getElection(db *sql.Tx, electionID int) (Election, error) {
+	elections, err := queryElections(db, "id = ?", electionID)
+	if err != nil {
+		return Election{}, wrapError(err, 146, "could not query election")
+	}
+
+	if len(elections) != 1 {
+		return Election{}, wrapError(nil, 147, "expected 1 election, got %d", len(elections))
+	}
+
+	return elections[0], nil
+}
+
+func queryElections(db *sql.Tx, where string, args ...interface{}) ([]Election, error) {
+	results, err := queryDB(db, scanElection, fmt.Sprintf(`
+		SELECT id, name, date_start, date_end, ballot_type, count_method, max_candidates, min_candidates, seats, max_score, grades, threshold,
+			truncation, tie_break, tie_break_seed, tie_resolutions, allow_recast, blind_signatures, encrypted, trustees, quorum, tally_key, state, state_changed_at, results_embargo, results
+		FROM elections WHERE %s ORDER BY date_start ASC;`, where), args...)
 	if err != nil {
 		return nil, wrapError(err, 115, "error querying elections")
 	}
@@ -486,6 +874,40 @@ func getElections(db *sql.Tx, onlyPublic bool) ([]Election, error) {
 		electionsMap[c.ElectionID] = e
 	}
 
+	results, err = queryDB(db, scanCandidateList, fmt.Sprintf(`
+		SELECT id, election_id, name, candidates, votes, seats FROM lists WHERE election_id IN (%s) ORDER BY id;`,
+		strings.Join(elIDstring, ",")))
+	if err != nil {
+		return nil, wrapError(err, 161, "error querying lists")
+	}
+
+	for _, x := range results {
+		l, _ := x.(CandidateList)
+		e := electionsMap[l.ElectionID]
+		if l.ID == 0 || e.ID == 0 {
+			continue
+		}
+		e.Lists = append(e.Lists, l)
+		electionsMap[l.ElectionID] = e
+	}
+
+	results, err = queryDB(db, scanQuestion, fmt.Sprintf(`
+		SELECT id, election_id, prompt, options, votes FROM questions WHERE election_id IN (%s) ORDER BY id;`,
+		strings.Join(elIDstring, ",")))
+	if err != nil {
+		return nil, wrapError(err, 257, "error querying questions")
+	}
+
+	for _, x := range results {
+		q, _ := x.(Question)
+		e := electionsMap[q.ElectionID]
+		if q.ID == 0 || e.ID == 0 {
+			continue
+		}
+		e.Questions = append(e.Questions, q)
+		electionsMap[q.ElectionID] = e
+	}
+
 	var elections []Election
 	for _, id := range electionIDs {
 		elections = append(elections, electionsMap[id])
@@ -494,12 +916,51 @@ func getElections(db *sql.Tx, onlyPublic bool) ([]Election, error) {
 	return elections, nil
 }
 
-func publishElection(db *sql.Tx, electionID int) error {
-	return updateOneRecord(db, "UPDATE elections SET public=TRUE WHERE id=?;", electionID)
+// setElectionState changes the state of the election, as long as it did not change since it was read
+func setElectionState(db *sql.Tx, t ElectionTransition) error {
+	return updateOneRecord(db, "UPDATE elections SET state=?, state_changed_at=? WHERE id=? AND state=?;", t.To, t.At, t.ElectionID, t.From)
 }
 
-func setElectionCounted(db *sql.Tx, electionID int) error {
-	return updateOneRecord(db, "UPDATE elections SET counted=TRUE WHERE id=?;", electionID)
+func setElectionEnd(db *sql.Tx, electionID int, end time.Time) error {
+	return updateOneRecord(db, "UPDATE elections SET date_end=? WHERE id=?;", end, electionID)
+}
+
+func insertElectionTransition(db *sql.Tx, t ElectionTransition) error {
+	_, err := db.Exec("INSERT INTO election_transitions (election_id, from_state, to_state, at, user_id, reason, ballots_root) VALUES (?, ?, ?, ?, ?, ?, ?);",
+		t.ElectionID, t.From, t.To, t.At, t.UserID, t.Reason, t.BallotsRoot)
+	return err
+}
+
+func getElectionTransitions(db *sql.Tx, electionID int) ([]ElectionTransition, error) {
+	res, err := queryDB(db, scanElectionTransition, "SELECT id, election_id, from_state, to_state, at, user_id, reason, ballots_root FROM election_transitions WHERE election_id=? ORDER BY id;", electionID)
+	if err != nil {
+		return nil, wrapError(err, 279, "could not select")
+	}
+
+	transitions := make([]ElectionTransition, 0, len(res))
+	for _, x := range res {
+		transitions = append(transitions, x.(ElectionTransition))
+	}
+	return transitions, nil
+}
+
+// setElectionResults stores the results of the count, which are not final until the election is counted
+func setElectionResults(db *sql.Tx, electionID int, results CountResults) error {
+	b, err := json.Marshal(results)
+	if err != nil {
+		return wrapError(err, 142, "could not marshal results")
+	}
+
+	return updateOneRecord(db, "UPDATE elections SET results=? WHERE id=?;", string(b), electionID)
+}
+
+func setTieResolutions(db *sql.Tx, electionID int, resolutions [][]int) error {
+	b, err := json.Marshal(resolutions)
+	if err != nil {
+		return wrapError(err, 184, "could not marshal tie resolutions")
+	}
+
+	return updateOneRecord(db, "UPDATE elections SET tie_resolutions=? WHERE id=?;", string(b), electionID)
 }
 
 func updateOneRecord(db *sql.Tx, query string, args ...interface{}) error {
@@ -520,17 +981,63 @@ func updateOneRecord(db *sql.Tx, query string, args ...interface{}) error {
 	return nil
 }
 
-func setUserVoted(db *sql.Tx, userID int) error {
-	return updateOneRecord(db, "UPDATE users SET has_voted=1 WHERE has_voted=0 AND id=?;", userID)
+func userVoted(db *sql.Tx, userID, electionID int) (bool, error) {
+	count, err := countDB(db, "SELECT COUNT(1) FROM participations WHERE user_id=? AND election_id=?;", userID, electionID)
+	return count > 0, err
 }
 
-func insertVote(db *sql.Tx, electionID int, candidates []int, hash string) error {
-	b, err := json.Marshal(candidates)
+func insertParticipation(db *sql.Tx, p Participation) error {
+	_, err := db.Exec("INSERT INTO participations (user_id, election_id, voted_at) VALUES (?, ?, ?);", p.UserID, p.ElectionID, p.VotedAt.UTC().Truncate(24*time.Hour))
+	return err
+}
+
+func getUserParticipations(db *sql.Tx, userID int) ([]Participation, error) {
+	res, err := queryDB(db, scanParticipation, "SELECT user_id, election_id, voted_at FROM participations WHERE user_id=? ORDER BY election_id;", userID)
+	if err != nil {
+		return nil, wrapError(err, 239, "could not select")
+	}
+
+	participations := make([]Participation, 0, len(res))
+	for _, x := range res {
+		participations = append(participations, x.(Participation))
+	}
+	return participations, nil
+}
+
+func insertVote(db *sql.Tx, v Vote) error {
+	b, err := json.Marshal(v.Candidates)
 	if err != nil {
 		return wrapError(err, 120, "could not marshal candidates")
 	}
 
-	_, err = db.Exec("INSERT INTO votes (election_id, hash, candidates) VALUES (?, ?, ?);", electionID, hash, string(b))
+	scores, err := json.Marshal(v.Scores)
+	if err != nil {
+		return wrapError(err, 152, "could not marshal scores")
+	}
+
+	ranks, err := json.Marshal(v.Ranks)
+	if err != nil {
+		return wrapError(err, 200, "could not marshal ranks")
+	}
+
+	answers, err := json.Marshal(v.Answers)
+	if err != nil {
+		return wrapError(err, 258, "could not marshal answers")
+	}
+
+	encrypted, err := json.Marshal(v.Encrypted)
+	if err != nil {
+		return wrapError(err, 384, "could not marshal encrypted ballot")
+	}
+
+	// the table is ordered by the random id, so the position of the ballot does not follow the order of insertion
+	id, err := SafeID()
+	if err != nil {
+		return wrapError(err, 313, "could not generate vote id")
+	}
+
+	_, err = db.Exec("INSERT INTO votes (id, election_id, hash, candidates, scores, ranks, list_id, answers, blank, slot, superseded, encrypted) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		id, v.ElectionID, v.Hash, string(b), string(scores), string(ranks), v.List, string(answers), v.Blank, v.Slot, v.Superseded, string(encrypted))
 	if err != nil {
 		return wrapError(err, 121, "could not insert vote")
 	}
@@ -538,8 +1045,10 @@ func insertVote(db *sql.Tx, electionID int, candidates []int, hash string) error
 	return nil
 }
 
+// getVotes returns the ballots to count, leaving out the superseded ones
 func getVotes(db *sql.Tx, electionID int) ([]Vote, error) {
-	results, err := queryDB(db, scanVote, "SELECT id, election_id, hash, candidates FROM votes WHERE election_id=?;", electionID)
+	results, err := queryDB(db, scanVote, `SELECT id, election_id, hash, candidates, scores, ranks, list_id, answers, blank, slot, superseded, encrypted
+		FROM votes WHERE election_id=? AND NOT superseded;`, electionID)
 	if err != nil {
 		return nil, err
 	}
@@ -552,8 +1061,25 @@ func getVotes(db *sql.Tx, electionID int) ([]Vote, error) {
 	return votes, nil
 }
 
+// getBallots returns every ballot of the election, superseded ones included
+func getBallots(db *sql.Tx, electionID int) ([]Vote, error) {
+	results, err := queryDB(db, scanVote, `SELECT id, election_id, hash, candidates, scores, ranks, list_id, answers, blank, slot, superseded, encrypted
+		FROM votes WHERE election_id=?;`, electionID)
+	if err != nil {
+		return nil, wrapError(err, 318, "could not select")
+	}
+
+	votes := make([]Vote, 0, len(results))
+	for _, x := range results {
+		votes = append(votes, x.(Vote))
+	}
+
+	return votes, nil
+}
+
 func getVoteFromHash(db *sql.Tx, hash string) (Vote, error) {
-	results, err := queryDB(db, scanVote, "SELECT id, election_id, hash, candidates FROM votes WHERE hash=?;", hash)
+	results, err := queryDB(db, scanVote, `SELECT id, election_id, hash, candidates, scores, ranks, list_id, answers, blank, slot, superseded, encrypted
+		FROM votes WHERE hash=?;`, hash)
 	if err != nil {
 		return Vote{}, wrapError(err, 122, "could not get vote")
 	}
@@ -565,6 +1091,161 @@ func getVoteFromHash(db *sql.Tx, hash string) (Vote, error) {
 	return results[0].(Vote), nil
 }
 
+// supersedeSlotVote marks as superseded the ballot of the election in the slot that was not superseded yet
+func supersedeSlotVote(db *sql.Tx, electionID int, slot string) error {
+	return updateOneRecord(db, "UPDATE votes SET superseded=1 WHERE election_id=? AND slot=? AND slot != '' AND NOT superseded;", electionID, slot)
+}
+
+// getElectionKey returns the key of the election, if it has one
+func getElectionKey(db *sql.Tx, electionID int) (bool, []byte, error) {
+	var key []byte
+	err := db.QueryRow("SELECT private_key FROM election_keys WHERE election_id=?;", electionID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	return err == nil, key, err
+}
+
+func insertElectionKey(db *sql.Tx, electionID int, key []byte) error {
+	_, err := db.Exec("INSERT INTO election_keys (election_id, private_key) VALUES (?, ?);", electionID, key)
+	return err
+}
+
+func getInstallationKey(db *sql.Tx) (bool, []byte, error) {
+	var key []byte
+	err := db.QueryRow("SELECT private_key FROM installation_key WHERE id=1;").Scan(&key)
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	return err == nil, key, err
+}
+
+func insertInstallationKey(db *sql.Tx, key []byte) error {
+	_, err := db.Exec("INSERT INTO installation_key (id, private_key) VALUES (1, ?);", key)
+	return err
+}
+
+func getSignedResults(db *sql.Tx, electionID int) (bool, SignedResults, error) {
+	s := SignedResults{ElectionID: electionID}
+	var document string
+	err := db.QueryRow("SELECT document, signature FROM signed_results WHERE election_id=?;", electionID).Scan(&document, &s.Signature)
+	if err == sql.ErrNoRows {
+		return false, s, nil
+	}
+	s.Document = json.RawMessage(document)
+	return err == nil, s, err
+}
+
+func insertSignedResults(db *sql.Tx, s SignedResults) error {
+	_, err := db.Exec("INSERT INTO signed_results (election_id, document, signature) VALUES (?, ?, ?);", s.ElectionID, string(s.Document), s.Signature)
+	return err
+}
+
+func credentialUsed(db *sql.Tx, electionID int, hash string) (bool, error) {
+	count, err := countDB(db, "SELECT COUNT(1) FROM used_credentials WHERE election_id=? AND hash=?;", electionID, hash)
+	return count > 0, err
+}
+
+func insertUsedCredential(db *sql.Tx, electionID int, hash string) error {
+	_, err := db.Exec("INSERT INTO used_credentials (election_id, hash) VALUES (?, ?);", electionID, hash)
+	return err
+}
+
+func setTallyKey(db *sql.Tx, electionID int, key string) error {
+	return updateOneRecord(db, "UPDATE elections SET tally_key=? WHERE id=?;", key, electionID)
+}
+
+func deleteTrusteeShares(db *sql.Tx, electionID int) error {
+	_, err := db.Exec("DELETE FROM trustee_shares WHERE election_id=?;", electionID)
+	return err
+}
+
+func insertTrusteeShare(db *sql.Tx, s TrusteeShare) error {
+	_, err := db.Exec("INSERT INTO trustee_shares (election_id, user_id, share_index, share, verification) VALUES (?, ?, ?, ?, ?);",
+		s.ElectionID, s.UserID, s.Index, s.Share, s.Verification)
+	return err
+}
+
+// getTrusteeShare returns the share of the user in the election, if the user is one of its trustees
+func getTrusteeShare(db *sql.Tx, electionID, userID int) (bool, TrusteeShare, error) {
+	s := TrusteeShare{ElectionID: electionID, UserID: userID}
+	err := db.QueryRow("SELECT share_index, share, verification FROM trustee_shares WHERE election_id=? AND user_id=?;", electionID, userID).Scan(
+		&s.Index, &s.Share, &s.Verification)
+	if err == sql.ErrNoRows {
+		return false, s, nil
+	}
+	return err == nil, s, err
+}
+
+// countStoredTrusteeShares returns how many trustees of the election have not taken their share yet
+func countStoredTrusteeShares(db *sql.Tx, electionID int) (int, error) {
+	return countDB(db, "SELECT COUNT(1) FROM trustee_shares WHERE election_id=? AND share IS NOT NULL;", electionID)
+}
+
+// takeTrusteeShare removes the share once it is given to the trustee
+func takeTrusteeShare(db *sql.Tx, electionID, userID int) error {
+	return updateOneRecord(db, "UPDATE trustee_shares SET share=NULL WHERE election_id=? AND user_id=? AND share IS NOT NULL;", electionID, userID)
+}
+
+// getPartialDecryptions returns the partial decryptions sent for the election, ordered by the index of the trustee
+func getPartialDecryptions(db *sql.Tx, electionID int) ([]PartialDecryption, error) {
+	res, err := queryDB(db, scanPartialDecryption, `SELECT d.election_id, d.trustee, d.partials, d.proofs, s.verification FROM partial_decryptions AS d
+		JOIN trustee_shares AS s ON s.election_id = d.election_id AND s.share_index = d.trustee WHERE d.election_id=? ORDER BY d.trustee;`, electionID)
+	if err != nil {
+		return nil, wrapError(err, 385, "could not select")
+	}
+
+	decryptions := make([]PartialDecryption, 0, len(res))
+	for _, x := range res {
+		decryptions = append(decryptions, x.(PartialDecryption))
+	}
+	return decryptions, nil
+}
+
+func insertPartialDecryption(db *sql.Tx, d PartialDecryption) error {
+	b, err := json.Marshal(d.Values)
+	if err != nil {
+		return wrapError(err, 386, "could not marshal partial decryption")
+	}
+
+	proofs, err := json.Marshal(d.Proofs)
+	if err != nil {
+		return wrapError(err, 474, "could not marshal partial decryption proofs")
+	}
+
+	_, err = db.Exec("INSERT INTO partial_decryptions (election_id, trustee, partials, proofs) VALUES (?, ?, ?, ?);", d.ElectionID, d.Trustee, string(b), string(proofs))
+	return err
+}
+
+func getAuditLog(db *sql.Tx) ([]AuditEntry, error) {
+	res, err := queryDB(db, scanAuditEntry, "SELECT id, user_id, action, params, at, previous_hash, hash FROM audit_log ORDER BY id;")
+	if err != nil {
+		return nil, wrapError(err, 430, "could not select")
+	}
+
+	entries := make([]AuditEntry, 0, len(res))
+	for _, x := range res {
+		entries = append(entries, x.(AuditEntry))
+	}
+	return entries, nil
+}
+
+// getLastAuditHash returns the hash of the last entry of the audit log, which is empty when the log is empty
+func getLastAuditHash(db *sql.Tx) (string, error) {
+	var hash string
+	err := db.QueryRow("SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1;").Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+func insertAuditEntry(db *sql.Tx, a AuditEntry) error {
+	_, err := db.Exec("INSERT INTO audit_log (user_id, action, params, at, previous_hash, hash) VALUES (?, ?, ?, ?, ?, ?);",
+		a.UserID, a.Action, string(a.Params), a.At, a.PreviousHash, a.Hash)
+	return err
+}
+
 // params check queries
 
 func checkFileOwnedByUser(db *sql.Tx, fileID, userID int) error {
@@ -590,7 +1271,7 @@ func resourceOwnedByUser(db *sql.Tx, resourceName string, resourceID, userID int
 // test checks queries
 
 func getAllUsers(db *sql.Tx) (users []User, err error) {
-	query := "SELECT id, unique_id, name, email, role, has_voted FROM users;"
+	query := "SELECT id, unique_id, name, email, role FROM users;"
 	res, err := queryDB(db, scanUser, query)
 	if err != nil {
 		return nil, wrapError(err, 125, "could not query db")
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// recount counts again the elections stored in the database from their ballots, optionally with another count
+// method, and writes the differences with the stored points; it returns whether all the results are the same
+func recount(args []string, out io.Writer) (bool, error) {
+	flags := flag.NewFlagSet("recount", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dbFile := flags.String("db", DB_FILE, "database file, opened read only")
+	electionID := flags.Int("election", 0, "election to recount, or every counted election when 0")
+	method := flags.String("method", "", "count method used instead of the election one, for comparison")
+	if err := flags.Parse(args); err != nil {
+		return false, wrapError(err, 205, "could not parse arguments")
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+*dbFile+"?mode=ro")
+	if err != nil {
+		return false, wrapError(err, 206, "error during database connection")
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return false, wrapError(err, 207, "error beginning transaction")
+	}
+	defer tx.Rollback()
+
+	elections, err := getElections(tx, false)
+	if err != nil {
+		return false, wrapError(err, 208, "could not get elections")
+	}
+
+	same, found := true, false
+	for _, e := range elections {
+		if (*electionID == 0 && !e.Counted) || (*electionID != 0 && e.ID != *electionID) {
+			continue
+		}
+
+		found = true
+		ok, err := recountElection(tx, e, *method, out)
+		if err != nil {
+			return false, wrapError(err, 209, "could not recount election %d", e.ID)
+		}
+		same = same && ok
+	}
+
+	if !found {
+		return false, traceError{id: 210, message: "no election to recount"}
+	}
+
+	return same, nil
+}
+
+// recountElection leaves out the stored ballots that are not valid, and reports them along with the points of each
+// candidate stored and recounted
+func recountElection(tx *sql.Tx, e Election, method string, out io.Writer) (bool, error) {
+	if method != "" {
+		if !stringInSlice(method, BALLOT_COUNT_METHODS[e.BallotType]) {
+			return false, traceError{id: 211, message: "count method cannot be used with the ballot type"}
+		}
+		e.CountMethod = method
+	}
+
+	available := make(map[int]struct{}, len(e.Candidates))
+	for _, c := range e.Candidates {
+		available[c.ID] = struct{}{}
+	}
+
+	votes, err := getVotes(tx, e.ID)
+	if err != nil {
+		return false, wrapError(err, 212, "could not get votes")
+	}
+
+	validate := validateBallot
+	if e.Encrypted {
+		validate = validateEncryptedBallot
+	}
+
+	valid := make([]Vote, 0, len(votes))
+	for _, v := range votes {
+		if err := validate(e, available, v); err != nil {
+			fmt.Fprintf(out, "ballot %s is not valid: %s\n", v.Hash, err)
+			continue
+		}
+		valid = append(valid, v)
+	}
+
+	var results CountResults
+	if e.Encrypted {
+		// the trustees decrypted the tally of every ballot, so none can be left out
+		var marks map[int]int
+		var decrypted bool
+		marks, decrypted, err = decryptTally(tx, e, votes)
+		if err != nil {
+			return false, wrapError(err, 422, "could not decrypt tally")
+		}
+		if !decrypted {
+			fmt.Fprintf(out, "election %d %q is waiting for a quorum of trustees to decrypt its tally\n", e.ID, e.Name)
+			return true, nil
+		}
+		results, err = countTally(e, votes, marks)
+	} else {
+		results, err = countVotes(e, valid)
+	}
+	if err != nil {
+		return false, wrapError(err, 213, "could not count votes")
+	}
+
+	fmt.Fprintf(out, "election %d %q, counted with %s: %d ballots, %d not valid\n", e.ID, e.Name, e.CountMethod, len(votes), len(votes)-len(valid))
+	if !e.Counted {
+		fmt.Fprintln(out, "the election is not counted yet, so there are no stored points")
+	}
+
+	candidates := append([]Candidate{}, e.Candidates...)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	same := true
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "id\tname\tstored\trecounted\t")
+	for _, c := range candidates {
+		var mark string
+		if e.Counted && compareVotes(c.Points, results.Points[c.ID]) != 0 {
+			mark, same = "differs", false
+		}
+		fmt.Fprintf(w, "%d\t%s\t%g\t%g\t%s\n", c.ID, c.Name, c.Points, results.Points[c.ID], mark)
+	}
+	if err := w.Flush(); err != nil {
+		return false, wrapError(err, 214, "could not write points")
+	}
+
+	if e.Results != nil && fmt.Sprint(e.Results.Elected) != fmt.Sprint(results.Elected) {
+		fmt.Fprintf(out, "elected candidates differ: stored %v, recounted %v\n", e.Results.Elected, results.Elected)
+		same = false
+	}
+
+	for _, q := range e.Questions {
+		if e.Counted && fmt.Sprint(q.Votes) != fmt.Sprint(results.QuestionVotes[q.ID]) {
+			fmt.Fprintf(out, "votes of question %d differ: stored %v, recounted %v\n", q.ID, q.Votes, results.QuestionVotes[q.ID])
+			same = false
+		}
+	}
+
+	if e.Results != nil && (e.Results.Ballots != results.Ballots || e.Results.Blank != results.Blank) {
+		fmt.Fprintf(out, "ballots differ: stored %d with %d blank, recounted %d with %d blank\n", e.Results.Ballots, e.Results.Blank, results.Ballots, results.Blank)
+		same = false
+	}
+
+	if results.pendingTies() {
+		fmt.Fprintln(out, "the recount has ties waiting for the admin to settle them")
+	}
+
+	return same, nil
+}
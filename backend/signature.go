@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/oriolf/bella-ciao/verifier"
+	"golang.org/x/crypto/ed25519"
+)
+
+// The installation has an Ed25519 key, generated when it is initialized, that signs the receipts given to the voters
+// and the results of the elections once counted. Voters can prove that the server issued their receipts, and anyone
+// can tell that the results were published by this server; the verifier package checks the signatures.
+
+// ResultsDocument is what gets signed when an election is counted
+type ResultsDocument struct {
+	ElectionID  int             `json:"election_id"`
+	Name        string          `json:"name"`
+	CountMethod string          `json:"count_method"`
+	CountedAt   time.Time       `json:"counted_at"`
+	BallotsRoot string          `json:"ballots_root"` // Merkle root over the ballots that were counted
+	Points      map[int]float64 `json:"points"`
+	Results     CountResults    `json:"results"`
+}
+
+// ServerKey is the public part of the installation key, hex encoded
+type ServerKey struct {
+	PublicKey string `json:"public_key"`
+}
+
+// installationKey returns the key of the installation, generating it the first time it is needed
+func installationKey(db *sql.Tx) (ed25519.PrivateKey, error) {
+	found, key, err := getInstallationKey(db)
+	if err != nil {
+		return nil, wrapError(err, 446, "could not get installation key")
+	}
+
+	if found {
+		if len(key) != ed25519.PrivateKeySize {
+			return nil, traceError{id: 447, message: "installation key has a wrong size"}
+		}
+		return ed25519.PrivateKey(key), nil
+	}
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, wrapError(err, 448, "could not generate installation key")
+	}
+
+	if err := insertInstallationKey(db, key); err != nil {
+		return nil, wrapError(err, 449, "could not insert installation key")
+	}
+
+	return ed25519.PrivateKey(key), nil
+}
+
+func publicServerKey(key ed25519.PrivateKey) ServerKey {
+	return ServerKey{PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey))}
+}
+
+// signReceipt signs the receipt of the vote along with the hash of the ballot, and returns both hex encoded
+func signReceipt(db *sql.Tx, v Vote) (ballot, signature string, err error) {
+	key, err := installationKey(db)
+	if err != nil {
+		return "", "", wrapError(err, 450, "could not get installation key")
+	}
+
+	leaf, err := ballotLeaf(v)
+	if err != nil {
+		return "", "", wrapError(err, 451, "could not hash ballot")
+	}
+
+	ballot = hex.EncodeToString(leaf)
+	return ballot, hex.EncodeToString(ed25519.Sign(key, verifier.ReceiptMessage(v.Hash, ballot))), nil
+}
+
+// signResults stores the results document of the election signed with the installation key, along with the root of
+// the ballots recorded when voting closed
+func signResults(db *sql.Tx, e Election, results CountResults) error {
+	key, err := installationKey(db)
+	if err != nil {
+		return wrapError(err, 452, "could not get installation key")
+	}
+
+	transitions, err := getElectionTransitions(db, e.ID)
+	if err != nil {
+		return wrapError(err, 481, "could not get election transitions")
+	}
+
+	var root string
+	for _, t := range transitions {
+		if t.To == ELECTION_CLOSED {
+			root = t.BallotsRoot
+		}
+	}
+
+	document, err := json.Marshal(ResultsDocument{ElectionID: e.ID, Name: e.Name, CountMethod: e.CountMethod, CountedAt: now().UTC(),
+		BallotsRoot: root, Points: results.Points, Results: results})
+	if err != nil {
+		return wrapError(err, 453, "could not marshal results document")
+	}
+
+	signature := hex.EncodeToString(ed25519.Sign(key, verifier.ResultsMessage(document)))
+	if err := insertSignedResults(db, SignedResults{ElectionID: e.ID, Document: document, Signature: signature}); err != nil {
+		return wrapError(err, 454, "could not insert signed results")
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -73,6 +75,14 @@ func adminUser(db *sql.Tx, user *User, values par.Values, err error) error {
 	return nil
 }
 
+func adminOrAuditorUser(db *sql.Tx, user *User, values par.Values, err error) error {
+	if !canSeeResults(user) {
+		return traceError{id: 445, message: "non admin or auditor role"}
+	}
+
+	return nil
+}
+
 func fileOwnerOrAdminUser(db *sql.Tx, user *User, values par.Values, err error) error {
 	if user.Role != ROLE_ADMIN {
 		if err := checkFileOwnedByUser(db, values.Int("id"), user.ID); err != nil {
@@ -93,22 +103,51 @@ func messageOwnerOrAdminUser(db *sql.Tx, user *User, values par.Values, err erro
 	return nil
 }
 
-func electionDidNotStart(db *sql.Tx, user *User, values par.Values, err error) error {
-	elections, err := getElections(db, false)
-	if err != nil {
-		return wrapError(err, 35, "could not get elections")
-	}
+// electionEditable returns an auth function that fails when the election found from the request values is past the
+// states in which it can be edited
+func electionEditable(findElection func(*sql.Tx, par.Values) (int, error)) func(*sql.Tx, *User, par.Values, error) error {
+	return func(db *sql.Tx, user *User, values par.Values, err error) error {
+		electionID, err := findElection(db, values)
+		if err != nil {
+			return wrapError(err, 5, "could not find election")
+		}
+
+		e, err := getElection(db, electionID)
+		if err != nil {
+			return wrapError(err, 35, "could not get election")
+		}
 
-	if len(elections) != 1 {
-		return traceError{id: 5, message: "expected just one election"}
+		if !stringInSlice(e.State, EDITABLE_ELECTION_STATES) {
+			return traceError{id: 6, message: "election cannot be edited anymore"}
+		}
+
+		return nil
 	}
+}
 
-	e := elections[0]
-	if now().After(e.Start) {
-		return traceError{id: 6, message: "election already started"}
+// electionParam finds the election from a parameter holding its id
+func electionParam(name string) func(*sql.Tx, par.Values) (int, error) {
+	return func(db *sql.Tx, values par.Values) (int, error) {
+		return values.Int(name), nil
 	}
+}
 
-	return nil
+// candidateElection finds the election of the candidate in the id parameter
+func candidateElection(db *sql.Tx, values par.Values) (int, error) {
+	c, err := getCandidate(db, values.Int("id"))
+	return c.ElectionID, err
+}
+
+// questionElection finds the election of the question in the id parameter
+func questionElection(db *sql.Tx, values par.Values) (int, error) {
+	q, err := getQuestion(db, values.Int("id"))
+	return q.ElectionID, err
+}
+
+// listElection finds the election of the list in the id parameter
+func listElection(db *sql.Tx, values par.Values) (int, error) {
+	l, err := getList(db, values.Int("id"))
+	return l.ElectionID, err
 }
 
 func validIDFormats(db *sql.Tx, user *User, values par.Values, err error) error {
@@ -136,6 +175,25 @@ func IsAdmin(user *User) bool {
 	return user != nil && user.Role == "admin"
 }
 
+// canSeeResults tells whether the user can see the results of elections that are not published yet
+func canSeeResults(user *User) bool {
+	return user != nil && (user.Role == ROLE_ADMIN || user.Role == ROLE_AUDITOR)
+}
+
+// hideResultsFrom tells whether the results of the election have to be hidden from the user
+func hideResultsFrom(db *sql.Tx, user *User, electionID int) (bool, error) {
+	if canSeeResults(user) {
+		return false, nil
+	}
+
+	elections, err := queryElections(db, "id = ?", electionID)
+	if err != nil {
+		return false, wrapError(err, 293, "could not get election")
+	}
+
+	return len(elections) == 1 && !resultsPublished(elections[0]), nil
+}
+
 func GetSaltAndHashPassword(pass string) (string, string, error) {
 	salt, err := SafeID()
 	if err != nil {
@@ -163,6 +221,12 @@ func SafeID() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// hashSecret hashes a credential of a voter, so what the database holds cannot be used in its place
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
 func HashPassword(pass, salt string) (string, error) {
 	bsalt, err := hex.DecodeString(salt)
 	if err != nil {
@@ -203,9 +267,8 @@ func WriteResult(w http.ResponseWriter, result interface{}) error {
 }
 
 func validateElectionParams(v par.Values) error {
-	start, end, now := v.Time("start"), v.Time("end"), now()
-	if start.After(end) || end.Before(start) || start.Before(now) {
-		return traceError{id: 12, message: "election should end after it starts"}
+	if err := validateElectionDates(v); err != nil {
+		return err
 	}
 
 	min, max := v.Int("min_candidates"), v.Int("max_candidates")
@@ -213,9 +276,73 @@ func validateElectionParams(v par.Values) error {
 		return traceError{id: 13, message: "minimum number of candidates cannot be greater than maximum"}
 	}
 
+	if threshold := v.Float("threshold"); threshold < 0 || threshold >= 100 {
+		return traceError{id: 167, message: "threshold should be a percentage"}
+	}
+
+	if !stringInSlice(v.String("count_method"), BALLOT_COUNT_METHODS[v.String("ballot_type")]) {
+		return traceError{id: 143, message: "count method cannot be used with the ballot type"}
+	}
+
+	if embargo := v.Time("results_embargo"); !embargo.IsZero() && embargo.Before(v.Time("end")) {
+		return traceError{id: 294, message: "results embargo should not be before the election ends"}
+	}
+
+	if v.Bool("allow_recast") && v.Bool("blind_signatures") {
+		return traceError{id: 360, message: "anonymous ballots cannot be recast"}
+	}
+
+	if v.Bool("encrypted") {
+		if v.String("ballot_type") != BALLOT_APPROVAL && v.String("ballot_type") != BALLOT_PLURALITY {
+			return traceError{id: 361, message: "only approval and plurality ballots can be encrypted"}
+		}
+
+		trustees := v.IntList("trustees")
+		if len(trustees) == 0 || hasDuplicates(trustees) {
+			return traceError{id: 362, message: "encrypted elections need distinct trustees"}
+		}
+
+		if quorum := v.Int("quorum"); quorum < 1 || quorum > len(trustees) {
+			return traceError{id: 363, message: "quorum should be between 1 and the number of trustees"}
+		}
+	}
+
+	if v.String("truncation") != TRUNCATION_STANDARD && v.String("count_method") != COUNT_BORDA && v.String("count_method") != COUNT_DOWDALL {
+		return traceError{id: 204, message: "truncated ballot options only apply to borda and dowdall"}
+	}
+
 	return nil
 }
 
+func validateElectionDates(v par.Values) error {
+	start, end, now := v.Time("start"), v.Time("end"), now()
+	if start.After(end) || end.Before(start) || start.Before(now) {
+		return traceError{id: 12, message: "election should end after it starts"}
+	}
+
+	return nil
+}
+
+// copyFile copies a file inside the folder, and returns the name of the copy
+func copyFile(folder, filename string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(folder, filename))
+	if err != nil {
+		return "", wrapError(err, 236, "could not read file")
+	}
+
+	f, name, err := safeCreateFile(folder, filename)
+	if err != nil {
+		return "", wrapError(err, 237, "could not create file")
+	}
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return "", wrapError(err, 238, "could not write file")
+	}
+
+	return name, nil
+}
+
 func safeCreateFile(folder, filename string) (*os.File, string, error) {
 	fileUploadMutex.Lock()
 	defer fileUploadMutex.Unlock()
@@ -254,8 +381,6 @@ func getAlternativeFilename(folder, filename string) (string, error) {
 			return alternativeName, nil
 		}
 	}
-
-	return "", traceError{id: 14, message: "impossible to find alternative"}
 }
 
 func getNameAndExtension(filename string) (string, string) {
@@ -285,6 +410,15 @@ func missingMessage(messageID int, messages []UserMessage) bool {
 	return true
 }
 
+func missingParticipation(electionID int, participations []Participation) bool {
+	for _, x := range participations {
+		if x.ElectionID == electionID {
+			return false
+		}
+	}
+	return true
+}
+
 // from https://github.com/amnesty/drupal-nif-nie-cif-validator/blob/master/includes/nif-nie-cif.php
 var dniRegex = regexp.MustCompile("^[0-9]{8}[A-Z]$")
 var dniLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
@@ -346,6 +480,68 @@ func stringInSlice(s string, l []string) bool {
 	return false
 }
 
+func listInElection(listID int, lists []CandidateList) bool {
+	for _, l := range lists {
+		if l.ID == listID {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDuplicates(l []int) bool {
+	seen := make(map[int]struct{}, len(l))
+	for _, x := range l {
+		if _, ok := seen[x]; ok {
+			return true
+		}
+		seen[x] = struct{}{}
+	}
+	return false
+}
+
+// removeInt returns the list without the number, keeping the order of the rest
+func removeInt(l []int, x int) []int {
+	res := make([]int, 0, len(l))
+	for _, y := range l {
+		if y != x {
+			res = append(res, y)
+		}
+	}
+	return res
+}
+
+// sameCandidates tells whether a and b hold the same ids, in any order
+func sameCandidates(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	x, y := append([]int{}, a...), append([]int{}, b...)
+	sort.Ints(x)
+	sort.Ints(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func decodePager(p par.Values) (limit, offset int) {
 	limit = p.Int("items_per_page")
 	return limit, (p.Int("page") - 1) * limit
@@ -370,40 +566,6 @@ func periodicFunc(f func(), d time.Duration) {
 	}
 }
 
-// each vote is a list of candidates
-// the result is a map where each candidate has its result
-func countVotes(candidates []Candidate, votes [][]int, countMethod string) (map[int]float64, error) {
-	countFunc, ok := map[string]func(int, int) float64{
-		COUNT_BORDA:   countBorda,
-		COUNT_DOWDALL: countDowdall,
-	}[countMethod]
-	if !ok {
-		return nil, traceError{id: 19, message: "unknown count method"}
-	}
-
-	points := make(map[int]float64, len(candidates))
-	for _, candidate := range candidates {
-		points[candidate.ID] = 0
-	}
-
-	for _, vote := range votes {
-		for index, candidate := range vote {
-			// the puntuation depends on the index inside the list and possibly on the number of candidates
-			points[candidate] += countFunc(index, len(candidates))
-		}
-	}
-
-	return points, nil
-}
-
-func countBorda(index, totalCandidates int) float64 {
-	return float64(totalCandidates - index) // if there are 12 candidates, 12 for the first, 11 the second... 1 for the last
-}
-
-func countDowdall(index, totalCandidates int) float64 {
-	return 1.0 / float64(index+1) // 1 for the first, 0.5 for the second, 0.333... for the third, etc.
-}
-
 type traceError struct {
 	id      int
 	message string
@@ -0,0 +1,130 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// A trustee decrypts the tally partially by raising the first part a of each ciphertext to its share s. Along with
+// each a^s it sends a Chaum-Pedersen proof that log_g(g^s) = log_a(a^s), that is, that it used the same share as in
+// the verification g^s published when the election was set up, so a wrong partial decryption is noticed before it
+// spoils the tally.
+
+var ErrMissingDecryption = errors.New("partial decryption does not have a value and a proof for each candidate")
+
+func decryptionContext(electionID, trustee, candidate int) string {
+	return fmt.Sprintf("election %d trustee %d candidate %d", electionID, trustee, candidate)
+}
+
+// PartialDecryption returns a^share for the ciphertext, which does not tell what it holds
+func PartialDecryption(share *big.Int, c Ciphertext) (*big.Int, error) {
+	a, _, err := c.Values()
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Exp(a, share, P), nil
+}
+
+// ProveDecryption returns the partial decryption of the ciphertext with the share, and the proof that it was made
+// with the share whose verification is g^share; the context binds the proof to the election, trustee and candidate
+func ProveDecryption(share *big.Int, c Ciphertext, context string) (*big.Int, ProofBranch, error) {
+	a, _, err := c.Values()
+	if err != nil {
+		return nil, ProofBranch{}, err
+	}
+
+	w, err := RandomExponent()
+	if err != nil {
+		return nil, ProofBranch{}, err
+	}
+
+	partial, verification := new(big.Int).Exp(a, share, P), new(big.Int).Exp(G, share, P)
+	x, y := new(big.Int).Exp(G, w, P), new(big.Int).Exp(a, w, P)
+	e := challenge(context, verification, a, partial, []*big.Int{x, y})
+	z := new(big.Int).Mul(e, share)
+	z.Add(z, w).Mod(z, Q)
+	return partial, ProofBranch{A: toHex(x), B: toHex(y), Challenge: toHex(e), Response: toHex(z)}, nil
+}
+
+// VerifyDecryption checks that the partial decryption of the ciphertext was made with the share whose verification
+// is given
+func VerifyDecryption(verification *big.Int, c Ciphertext, partial *big.Int, proof ProofBranch, context string) error {
+	if !InGroup(verification) {
+		return ErrInvalidKey
+	}
+
+	a, _, err := c.Values()
+	if err != nil {
+		return err
+	}
+
+	if !InGroup(a) || !InGroup(partial) {
+		return ErrInvalidCiphertext
+	}
+
+	x, okX := parseHex(proof.A)
+	y, okY := parseHex(proof.B)
+	e, okE := parseHex(proof.Challenge)
+	z, okZ := parseHex(proof.Response)
+	if !okX || !okY || !okE || !okZ || e.Cmp(Q) >= 0 || z.Cmp(Q) >= 0 {
+		return ErrInvalidProof
+	}
+
+	// g^z = A (g^s)^e and a^z = B (a^s)^e for the challenge e and response z
+	if commitment(G, verification, z, e).Cmp(x) != 0 || commitment(a, partial, z, e).Cmp(y) != 0 {
+		return ErrInvalidProof
+	}
+
+	if e.Cmp(challenge(context, verification, a, partial, []*big.Int{x, y})) != 0 {
+		return ErrInvalidProof
+	}
+
+	return nil
+}
+
+// DecryptTally returns the partial decryptions of the tally of each candidate made by the trustee with its share, hex
+// encoded, along with their proofs
+func DecryptTally(share *big.Int, electionID, trustee int, tally map[int]Ciphertext) (map[int]string, map[int]ProofBranch, error) {
+	partials, proofs := make(map[int]string, len(tally)), make(map[int]ProofBranch, len(tally))
+	for c, ciphertext := range tally {
+		partial, proof, err := ProveDecryption(share, ciphertext, decryptionContext(electionID, trustee, c))
+		if err != nil {
+			return nil, nil, err
+		}
+		partials[c], proofs[c] = toHex(partial), proof
+	}
+	return partials, proofs, nil
+}
+
+// VerifyTallyDecryption checks that the trustee sent a valid partial decryption of the tally of each candidate and no
+// others, made with the share of the hex encoded verification
+func VerifyTallyDecryption(verification string, electionID, trustee int, tally map[int]Ciphertext, partials map[int]string, proofs map[int]ProofBranch) error {
+	v, ok := parseHex(verification)
+	if !ok {
+		return ErrInvalidKey
+	}
+
+	if len(partials) != len(tally) || len(proofs) != len(tally) {
+		return ErrMissingDecryption
+	}
+
+	for c, ciphertext := range tally {
+		s, ok := partials[c]
+		proof, okProof := proofs[c]
+		if !ok || !okProof {
+			return ErrMissingDecryption
+		}
+
+		partial, ok := parseHex(s)
+		if !ok {
+			return fmt.Errorf("candidate %d: %v", c, ErrInvalidCiphertext)
+		}
+
+		if err := VerifyDecryption(v, ciphertext, partial, proof, decryptionContext(electionID, trustee, c)); err != nil {
+			return fmt.Errorf("candidate %d: %v", c, err)
+		}
+	}
+
+	return nil
+}
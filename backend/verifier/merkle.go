@@ -0,0 +1,61 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// The bulletin board of an election is a Merkle tree over the hashes of its ballots, ordered by receipt. The root of
+// the tree is recorded when voting closes and signed along with the results, so a voter that checks the inclusion
+// proof of their ballot against the signed root knows the ballot was counted.
+
+var ErrNotIncluded = errors.New("inclusion proof does not lead to the root")
+
+// inner nodes are hashed with a prefix that leaves do not use, so a leaf cannot be passed off as an inner node
+var merkleNodePrefix = []byte{1}
+
+// MerkleStep is the sibling hashed with the current node to get its parent, hex encoded
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // the sibling goes on the left
+}
+
+// HashMerkleNode returns the parent of the two nodes of the tree
+func HashMerkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write(merkleNodePrefix)
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// VerifyInclusion checks that going up from the hex encoded leaf with the steps of the proof gives the hex encoded
+// root
+func VerifyInclusion(leaf string, steps []MerkleStep, root string) error {
+	node, err := hex.DecodeString(leaf)
+	if err != nil {
+		return ErrNotIncluded
+	}
+
+	for _, s := range steps {
+		sibling, err := hex.DecodeString(s.Hash)
+		if err != nil {
+			return ErrNotIncluded
+		}
+
+		if s.Left {
+			node = HashMerkleNode(sibling, node)
+		} else {
+			node = HashMerkleNode(node, sibling)
+		}
+	}
+
+	r, err := hex.DecodeString(root)
+	if err != nil || !bytes.Equal(node, r) {
+		return ErrNotIncluded
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package verifier
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// The server signs the receipts of the ballots and the results of the elections with the Ed25519 key of the
+// installation. Each kind of message has its own prefix, so a signature of one kind cannot pass for another.
+
+var (
+	ErrInvalidPublicKey = errors.New("public key is not a valid Ed25519 key")
+	ErrInvalidSignature = errors.New("signature is not valid")
+)
+
+// ReceiptMessage is what the server signs when it gives a receipt: the receipt along with the hash of the ballot, as
+// the leaf of the ballot in the bulletin board when it was cast
+func ReceiptMessage(receipt, ballot string) []byte {
+	return []byte("bella-ciao receipt\n" + receipt + "\n" + ballot)
+}
+
+// ResultsMessage is what the server signs when an election is counted: the results document, as published
+func ResultsMessage(document []byte) []byte {
+	return append([]byte("bella-ciao results\n"), document...)
+}
+
+// VerifySignature checks the hex encoded signature of the message with the hex encoded public key
+func VerifySignature(publicKey string, message []byte, signature string) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return ErrInvalidPublicKey
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), message, sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// VerifyReceipt checks that the server issued the receipt for the ballot
+func VerifyReceipt(publicKey, receipt, ballot, signature string) error {
+	return VerifySignature(publicKey, ReceiptMessage(receipt, ballot), signature)
+}
+
+// VerifyResults checks that the server published the results document
+func VerifyResults(publicKey string, document []byte, signature string) error {
+	return VerifySignature(publicKey, ResultsMessage(document), signature)
+}
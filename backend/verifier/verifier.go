@@ -0,0 +1,351 @@
+// Package verifier checks the encrypted ballots of elections with an encrypted tally without decrypting them. Each
+// candidate of a ballot is encrypted with exponential ElGamal under the tally key of the election, along with a
+// disjunctive Chaum-Pedersen proof that it holds a 0 or a 1, and the product of the ciphertexts of the ballot comes
+// with another proof that the ballot marks between the minimum and maximum number of candidates. Anyone can check the
+// published ballots of an election with VerifyBallot, given its tally key and limits; voters that encrypt their own
+// ballots can use EncryptBallot. The partial decryptions of the tally sent by the trustees come with proofs too, which
+// VerifyTallyDecryption checks. It also checks the inclusion proofs of ballots in the bulletin board, and the
+// signatures the server makes on receipts and results with the key of the installation.
+package verifier
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// the 2048-bit MODP group of RFC 3526: P is a safe prime, and G generates the subgroup of prime order Q = (P-1)/2
+var (
+	P = mustParseHex("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5" +
+		"AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+		"DE2BCBF6955817183995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF")
+	Q = new(big.Int).Rsh(P, 1)
+	G = big.NewInt(2)
+)
+
+var (
+	ErrInvalidKey        = errors.New("key is not an element of the group")
+	ErrInvalidCiphertext = errors.New("ciphertext is not an element of the group")
+	ErrInvalidProof      = errors.New("proof is not valid")
+	ErrMissingCandidate  = errors.New("ballot does not have a ciphertext and a proof for each candidate")
+	ErrOutOfRange        = errors.New("value is out of the range of the proof")
+)
+
+// Ciphertext holds a number m encrypted with the tally key h as the pair (g^r, g^m h^r) for a random r, hex encoded
+type Ciphertext struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// Proof shows that a ciphertext holds one of the numbers of a range, with a branch for each of them from the lowest;
+// only one branch is real, the others are simulated, and the challenges must add up to the hash of all of them
+type Proof []ProofBranch
+
+type ProofBranch struct {
+	A         string `json:"a"` // commitment g^w
+	B         string `json:"b"` // commitment h^w
+	Challenge string `json:"challenge"`
+	Response  string `json:"response"`
+}
+
+// Ballot is an encrypted ballot, with the ciphertext of the mark of each candidate and the proofs of its validity
+type Ballot struct {
+	Ciphertexts map[int]Ciphertext `json:"ciphertexts"`
+	Proofs      map[int]Proof      `json:"proofs"`    // each ciphertext holds a 0 or a 1
+	SumProof    Proof              `json:"sum_proof"` // the product of the ciphertexts holds the number of marks
+}
+
+func mustParseHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic(fmt.Sprintf("could not parse %q", s))
+	}
+	return n
+}
+
+func parseHex(s string) (*big.Int, bool) {
+	return new(big.Int).SetString(s, 16)
+}
+
+func toHex(x *big.Int) string {
+	return hex.EncodeToString(x.Bytes())
+}
+
+// InGroup tells whether the number is an element of the subgroup of order Q
+func InGroup(x *big.Int) bool {
+	return x.Sign() > 0 && x.Cmp(P) < 0 && new(big.Int).Exp(x, Q, P).Cmp(big.NewInt(1)) == 0
+}
+
+// ParseKey parses a hex encoded tally key
+func ParseKey(s string) (*big.Int, error) {
+	h, ok := parseHex(s)
+	if !ok || !InGroup(h) {
+		return nil, ErrInvalidKey
+	}
+	return h, nil
+}
+
+// RandomExponent returns a random number between 1 and Q-1
+func RandomExponent() (*big.Int, error) {
+	r, err := rand.Int(rand.Reader, new(big.Int).Sub(Q, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	return r.Add(r, big.NewInt(1)), nil
+}
+
+func NewCiphertext(a, b *big.Int) Ciphertext {
+	return Ciphertext{A: toHex(a), B: toHex(b)}
+}
+
+// Values parses the pair of the ciphertext, which should be in the range of the group
+func (c Ciphertext) Values() (a, b *big.Int, err error) {
+	a, okA := parseHex(c.A)
+	b, okB := parseHex(c.B)
+	if !okA || !okB || a.Sign() <= 0 || a.Cmp(P) >= 0 || b.Sign() <= 0 || b.Cmp(P) >= 0 {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	return a, b, nil
+}
+
+// Encrypt encrypts the number with the key, and returns the randomness used, which is needed to prove what it holds
+func Encrypt(key *big.Int, m int) (Ciphertext, *big.Int, error) {
+	r, err := RandomExponent()
+	if err != nil {
+		return Ciphertext{}, nil, err
+	}
+
+	b := new(big.Int).Exp(G, big.NewInt(int64(m)), P)
+	b.Mul(b, new(big.Int).Exp(key, r, P)).Mod(b, P)
+	return NewCiphertext(new(big.Int).Exp(G, r, P), b), r, nil
+}
+
+// Multiply multiplies the ciphertexts, which encrypts the sum of the numbers they hold; with no ciphertexts, it
+// returns the encryption of 0 with no randomness
+func Multiply(ciphertexts ...Ciphertext) (Ciphertext, error) {
+	a, b := big.NewInt(1), big.NewInt(1)
+	for _, c := range ciphertexts {
+		x, y, err := c.Values()
+		if err != nil {
+			return Ciphertext{}, err
+		}
+		a.Mul(a, x).Mod(a, P)
+		b.Mul(b, y).Mod(b, P)
+	}
+	return NewCiphertext(a, b), nil
+}
+
+// challenge hashes everything the prover committed to, so the proof cannot be made before the commitments
+func challenge(context string, key, a, b *big.Int, commitments []*big.Int) *big.Int {
+	parts := []string{context, toHex(key), toHex(a), toHex(b)}
+	for _, c := range commitments {
+		parts = append(parts, toHex(c))
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return new(big.Int).Mod(new(big.Int).SetBytes(digest[:]), Q)
+}
+
+// shifted returns b / g^j, which is h^r when the ciphertext holds j
+func shifted(b *big.Int, j int) *big.Int {
+	gj := new(big.Int).Exp(G, big.NewInt(int64(j)), P)
+	return gj.ModInverse(gj, P).Mul(gj, b).Mod(gj, P)
+}
+
+// Prove proves that the ciphertext, encrypted with the randomness r, holds m, which is between min and max; the
+// context binds the proof to the election and candidate, so it cannot be used for another one
+func Prove(key *big.Int, c Ciphertext, r *big.Int, m, min, max int, context string) (Proof, error) {
+	if m < min || m > max {
+		return nil, ErrOutOfRange
+	}
+
+	a, b, err := c.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	n := max - min + 1
+	commitments := make([]*big.Int, 0, 2*n)
+	challenges, responses := make([]*big.Int, n), make([]*big.Int, n)
+	var w *big.Int
+	sum := new(big.Int)
+	for i := 0; i < n; i++ {
+		if min+i == m {
+			if w, err = RandomExponent(); err != nil {
+				return nil, err
+			}
+			commitments = append(commitments, new(big.Int).Exp(G, w, P), new(big.Int).Exp(key, w, P))
+			continue
+		}
+
+		// a simulated branch picks the challenge and response first, and the commitments that fit them
+		if challenges[i], err = RandomExponent(); err != nil {
+			return nil, err
+		}
+		if responses[i], err = RandomExponent(); err != nil {
+			return nil, err
+		}
+		commitments = append(commitments,
+			commitment(G, a, responses[i], challenges[i]),
+			commitment(key, shifted(b, min+i), responses[i], challenges[i]))
+		sum.Add(sum, challenges[i])
+	}
+
+	// the real branch gets what is left of the challenge, and can only answer it knowing r
+	i := m - min
+	challenges[i] = challenge(context, key, a, b, commitments)
+	challenges[i].Sub(challenges[i], sum).Mod(challenges[i], Q)
+	responses[i] = new(big.Int).Mul(challenges[i], r)
+	responses[i].Add(responses[i], w).Mod(responses[i], Q)
+
+	proof := make(Proof, n)
+	for i := range proof {
+		proof[i] = ProofBranch{A: toHex(commitments[2*i]), B: toHex(commitments[2*i+1]), Challenge: toHex(challenges[i]), Response: toHex(responses[i])}
+	}
+	return proof, nil
+}
+
+// commitment returns base^response / x^challenge, the commitment that a valid branch has for the response and
+// challenge
+func commitment(base, x, response, challenge *big.Int) *big.Int {
+	c := new(big.Int).Exp(x, challenge, P)
+	c.ModInverse(c, P)
+	return c.Mul(c, new(big.Int).Exp(base, response, P)).Mod(c, P)
+}
+
+// Verify checks that the proof shows that the ciphertext holds a number between min and max
+func Verify(key *big.Int, c Ciphertext, min, max int, proof Proof, context string) error {
+	a, b, err := c.Values()
+	if err != nil {
+		return err
+	}
+
+	if !InGroup(a) || !InGroup(b) {
+		return ErrInvalidCiphertext
+	}
+
+	if max < min || len(proof) != max-min+1 {
+		return ErrInvalidProof
+	}
+
+	commitments := make([]*big.Int, 0, 2*len(proof))
+	sum := new(big.Int)
+	for i, branch := range proof {
+		x, okX := parseHex(branch.A)
+		y, okY := parseHex(branch.B)
+		e, okE := parseHex(branch.Challenge)
+		z, okZ := parseHex(branch.Response)
+		if !okX || !okY || !okE || !okZ || e.Cmp(Q) >= 0 || z.Cmp(Q) >= 0 {
+			return ErrInvalidProof
+		}
+
+		// g^z = A a^e and h^z = B (b/g^j)^e for the challenge e and response z of the branch
+		if commitment(G, a, z, e).Cmp(x) != 0 || commitment(key, shifted(b, min+i), z, e).Cmp(y) != 0 {
+			return ErrInvalidProof
+		}
+
+		commitments = append(commitments, x, y)
+		sum.Add(sum, e)
+	}
+
+	if sum.Mod(sum, Q).Cmp(challenge(context, key, a, b, commitments)) != 0 {
+		return ErrInvalidProof
+	}
+
+	return nil
+}
+
+func candidateContext(electionID, candidate int) string {
+	return fmt.Sprintf("election %d candidate %d", electionID, candidate)
+}
+
+func sumContext(electionID int) string {
+	return fmt.Sprintf("election %d sum", electionID)
+}
+
+// EncryptBallot encrypts a 1 for each marked candidate and a 0 for the others, and proves that the ballot is valid,
+// that is, that it marks between min and max candidates
+func EncryptBallot(key *big.Int, electionID int, candidates, marked []int, min, max int) (Ballot, error) {
+	marks := make(map[int]int, len(marked))
+	for _, c := range marked {
+		marks[c] = 1
+	}
+
+	ballot := Ballot{Ciphertexts: make(map[int]Ciphertext, len(candidates)), Proofs: make(map[int]Proof, len(candidates))}
+	r := new(big.Int)
+	for _, c := range candidates {
+		ciphertext, rc, err := Encrypt(key, marks[c])
+		if err != nil {
+			return Ballot{}, err
+		}
+
+		proof, err := Prove(key, ciphertext, rc, marks[c], 0, 1, candidateContext(electionID, c))
+		if err != nil {
+			return Ballot{}, err
+		}
+
+		ballot.Ciphertexts[c], ballot.Proofs[c] = ciphertext, proof
+		r.Add(r, rc).Mod(r, Q)
+	}
+
+	sum, err := ballotSum(ballot, candidates)
+	if err != nil {
+		return Ballot{}, err
+	}
+
+	if ballot.SumProof, err = Prove(key, sum, r, len(marked), min, max, sumContext(electionID)); err != nil {
+		return Ballot{}, err
+	}
+
+	return ballot, nil
+}
+
+// ballotSum multiplies the ciphertexts of the candidates, in the same order for the prover and the verifier
+func ballotSum(ballot Ballot, candidates []int) (Ciphertext, error) {
+	sorted := append([]int{}, candidates...)
+	sort.Ints(sorted)
+
+	ciphertexts := make([]Ciphertext, 0, len(sorted))
+	for _, c := range sorted {
+		ciphertexts = append(ciphertexts, ballot.Ciphertexts[c])
+	}
+	return Multiply(ciphertexts...)
+}
+
+// VerifyBallot checks that the ballot of the election has a ciphertext of a 0 or a 1 for each of the candidates and
+// no others, and that it marks between min and max candidates
+func VerifyBallot(key *big.Int, electionID int, candidates []int, ballot Ballot, min, max int) error {
+	if len(ballot.Ciphertexts) != len(candidates) || len(ballot.Proofs) != len(candidates) {
+		return ErrMissingCandidate
+	}
+
+	for _, c := range candidates {
+		ciphertext, ok := ballot.Ciphertexts[c]
+		proof, okProof := ballot.Proofs[c]
+		if !ok || !okProof {
+			return ErrMissingCandidate
+		}
+
+		if err := Verify(key, ciphertext, 0, 1, proof, candidateContext(electionID, c)); err != nil {
+			return fmt.Errorf("candidate %d: %v", c, err)
+		}
+	}
+
+	sum, err := ballotSum(ballot, candidates)
+	if err != nil {
+		return err
+	}
+
+	if err := Verify(key, sum, min, max, ballot.SumProof, sumContext(electionID)); err != nil {
+		return fmt.Errorf("number of marks: %v", err)
+	}
+
+	return nil
+}
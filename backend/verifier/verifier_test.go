@@ -0,0 +1,179 @@
+package verifier
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func testKey(t *testing.T) *big.Int {
+	secret, err := RandomExponent()
+	if err != nil {
+		t.Fatalf("Could not generate secret: %s", err)
+	}
+	return new(big.Int).Exp(G, secret, P)
+}
+
+// isError tells whether err is target or was built from it, as VerifyBallot prefixes the errors with the candidate
+func isError(err, target error) bool {
+	return err != nil && strings.HasSuffix(err.Error(), target.Error())
+}
+
+func TestProof(t *testing.T) {
+	key := testKey(t)
+	for m := 0; m <= 3; m++ {
+		c, r, err := Encrypt(key, m)
+		if err != nil {
+			t.Fatalf("Could not encrypt: %s", err)
+		}
+
+		proof, err := Prove(key, c, r, m, 0, 3, "test")
+		if err != nil {
+			t.Fatalf("Could not prove: %s", err)
+		}
+
+		if err := Verify(key, c, 0, 3, proof, "test"); err != nil {
+			t.Errorf("Expected the proof of %d to be valid, but got: %s", m, err)
+		}
+		if err := Verify(key, c, 0, 3, proof, "another test"); err != ErrInvalidProof {
+			t.Errorf("Expected the proof of %d not to be valid in another context, but got: %v", m, err)
+		}
+		if err := Verify(key, c, 1, 3, proof, "test"); err != ErrInvalidProof {
+			t.Errorf("Expected the proof of %d not to be valid for another range, but got: %v", m, err)
+		}
+	}
+
+	c, r, err := Encrypt(key, 2)
+	if err != nil {
+		t.Fatalf("Could not encrypt: %s", err)
+	}
+	if _, err := Prove(key, c, r, 2, 0, 1, "test"); err != ErrOutOfRange {
+		t.Errorf("Expected an error proving a number out of the range, but got: %v", err)
+	}
+}
+
+func TestBallot(t *testing.T) {
+	key := testKey(t)
+	candidates := []int{3, 1, 2}
+	ballot, err := EncryptBallot(key, 1, candidates, []int{1, 2}, 1, 2)
+	if err != nil {
+		t.Fatalf("Could not encrypt ballot: %s", err)
+	}
+
+	if err := VerifyBallot(key, 1, candidates, ballot, 1, 2); err != nil {
+		t.Errorf("Expected the ballot to be valid, but got: %s", err)
+	}
+	if err := VerifyBallot(key, 2, candidates, ballot, 1, 2); !isError(err, ErrInvalidProof) {
+		t.Errorf("Expected the ballot not to be valid in another election, but got: %v", err)
+	}
+	if err := VerifyBallot(key, 1, candidates, ballot, 1, 1); !isError(err, ErrInvalidProof) {
+		t.Errorf("Expected the ballot not to be valid with less marks allowed, but got: %v", err)
+	}
+	if err := VerifyBallot(key, 1, []int{1, 2}, ballot, 1, 2); err != ErrMissingCandidate {
+		t.Errorf("Expected the ballot not to be valid with other candidates, but got: %v", err)
+	}
+
+	// a ciphertext of 2 with the proof of the ciphertext it replaces
+	swapped := Ballot{Ciphertexts: map[int]Ciphertext{}, Proofs: ballot.Proofs, SumProof: ballot.SumProof}
+	for c, ciphertext := range ballot.Ciphertexts {
+		swapped.Ciphertexts[c] = ciphertext
+	}
+	swapped.Ciphertexts[1], err = Multiply(ballot.Ciphertexts[1], ballot.Ciphertexts[2])
+	if err != nil {
+		t.Fatalf("Could not multiply ciphertexts: %s", err)
+	}
+	if err := VerifyBallot(key, 1, candidates, swapped, 1, 3); !isError(err, ErrInvalidProof) {
+		t.Errorf("Expected the ballot with a swapped ciphertext not to be valid, but got: %v", err)
+	}
+
+	invalid := swapped
+	invalid.Ciphertexts = map[int]Ciphertext{1: {A: "0", B: "1"}, 2: ballot.Ciphertexts[2], 3: ballot.Ciphertexts[3]}
+	if err := VerifyBallot(key, 1, candidates, invalid, 1, 2); !isError(err, ErrInvalidCiphertext) {
+		t.Errorf("Expected the ballot with a ciphertext out of the group not to be valid, but got: %v", err)
+	}
+
+	if _, err := ParseKey("0"); err != ErrInvalidKey {
+		t.Errorf("Expected an error parsing a key out of the group, but got: %v", err)
+	}
+}
+
+func TestDecryption(t *testing.T) {
+	share, err := RandomExponent()
+	if err != nil {
+		t.Fatalf("Could not generate share: %s", err)
+	}
+	verification := toHex(new(big.Int).Exp(G, share, P))
+	key := testKey(t)
+	tally := make(map[int]Ciphertext)
+	for c, m := range map[int]int{1: 3, 2: 0} {
+		if tally[c], _, err = Encrypt(key, m); err != nil {
+			t.Fatalf("Could not encrypt: %s", err)
+		}
+	}
+
+	partials, proofs, err := DecryptTally(share, 1, 2, tally)
+	if err != nil {
+		t.Fatalf("Could not decrypt tally: %s", err)
+	}
+	if err := VerifyTallyDecryption(verification, 1, 2, tally, partials, proofs); err != nil {
+		t.Errorf("Expected the partial decryption to be valid, but got: %s", err)
+	}
+	if err := VerifyTallyDecryption(verification, 1, 3, tally, partials, proofs); !isError(err, ErrInvalidProof) {
+		t.Errorf("Expected the partial decryption not to be valid for another trustee, but got: %v", err)
+	}
+	if err := VerifyTallyDecryption(toHex(key), 1, 2, tally, partials, proofs); !isError(err, ErrInvalidProof) {
+		t.Errorf("Expected the partial decryption not to be valid with another verification, but got: %v", err)
+	}
+	if err := VerifyTallyDecryption(verification, 1, 2, tally, map[int]string{1: partials[1]}, proofs); err != ErrMissingDecryption {
+		t.Errorf("Expected the partial decryption not to be valid with a missing candidate, but got: %v", err)
+	}
+
+	// the partial decryption of another candidate with its proof
+	swapped := map[int]string{1: partials[2], 2: partials[1]}
+	if err := VerifyTallyDecryption(verification, 1, 2, tally, swapped, proofs); !isError(err, ErrInvalidProof) {
+		t.Errorf("Expected the swapped partial decryptions not to be valid, but got: %v", err)
+	}
+}
+
+func TestInclusion(t *testing.T) {
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	root := hex.EncodeToString(HashMerkleNode(HashMerkleNode(a, b), c))
+	steps := []MerkleStep{{Hash: hex.EncodeToString(a), Left: true}, {Hash: hex.EncodeToString(c)}}
+	if err := VerifyInclusion(hex.EncodeToString(b), steps, root); err != nil {
+		t.Errorf("Expected the inclusion proof to be valid, but got: %s", err)
+	}
+	if err := VerifyInclusion(hex.EncodeToString(c), steps, root); err != ErrNotIncluded {
+		t.Errorf("Expected the inclusion proof not to be valid for another leaf, but got: %v", err)
+	}
+
+	steps[0].Left = false
+	if err := VerifyInclusion(hex.EncodeToString(b), steps, root); err != ErrNotIncluded {
+		t.Errorf("Expected the inclusion proof not to be valid with the siblings swapped, but got: %v", err)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+	key := hex.EncodeToString(public)
+
+	signature := hex.EncodeToString(ed25519.Sign(private, ReceiptMessage("receipt", "ballot")))
+	if err := VerifyReceipt(key, "receipt", "ballot", signature); err != nil {
+		t.Errorf("Expected the receipt signature to be valid, but got: %s", err)
+	}
+	if err := VerifyReceipt(key, "receipt", "another ballot", signature); err != ErrInvalidSignature {
+		t.Errorf("Expected the receipt signature not to be valid for another ballot, but got: %v", err)
+	}
+	if err := VerifyResults(key, []byte("receipt\nballot"), signature); err != ErrInvalidSignature {
+		t.Errorf("Expected the receipt signature not to be valid for results, but got: %v", err)
+	}
+	if err := VerifyReceipt("abc", "receipt", "ballot", signature); err != ErrInvalidPublicKey {
+		t.Errorf("Expected an error verifying with an invalid key, but got: %v", err)
+	}
+}